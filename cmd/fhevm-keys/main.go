@@ -0,0 +1,180 @@
+// Command fhevm-keys generates, verifies and inspects fhEVM key sets.
+//
+// Usage:
+//
+//	fhevm-keys generate -dir <keys dir> [-params <parameter set>] [-crs] [-no-cks]
+//	fhevm-keys verify -dir <keys dir>
+//	fhevm-keys fingerprint -dir <keys dir>
+//	fhevm-keys pubkey -dir <keys dir> [-out <file>] [-abi] [-evm-array]
+//
+// A keys directory holds the "sks", "pks" and optionally "cks" and "crs" files, along with a manifest, see
+// tfhe.KeyManifest. It can be used as FHEVM_GO_KEYS_DIR.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"PureChain/crypto"
+	"github.com/lukadas12345/rfhevm/fhevm"
+	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
+)
+
+const usage = `usage: fhevm-keys <command> [flags]
+
+commands:
+  generate     generate a key set to a directory, with a manifest
+  verify       verify the files of a keys directory against its manifest and load them
+  fingerprint  print the key set id and the hashes of the keys in a directory
+  pubkey       extract the public key in the format returned by the fhePubKey precompile method
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "generate":
+		err = generate(os.Args[2:])
+	case "verify":
+		err = verify(os.Args[2:])
+	case "fingerprint":
+		err = fingerprint(os.Args[2:])
+	case "pubkey":
+		err = pubkey(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fhevm-keys %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func generate(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	dir := flags.String("dir", "", "directory to write the keys to, must not hold keys already")
+	withCrs := flags.Bool("crs", false, "also generate CRS public parameters, needed to verify proven input lists")
+	noCks := flags.Bool("no-cks", false, "don't write the client key, e.g. when it is held by a KMS")
+	params := flags.String("params", tfhe.ParameterSetDefault.String(), "parameter set: default, multi-bit or compact-pk")
+	flags.Parse(args)
+	if *dir == "" {
+		return errors.New("-dir is required")
+	}
+	parameterSet, err := tfhe.ParseParameterSet(*params)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path.Join(*dir, tfhe.ServerKeyFileName)); err == nil {
+		return fmt.Errorf("%s already holds keys", *dir)
+	}
+
+	ks, err := tfhe.GenerateKeySetWithParameters(parameterSet, *withCrs)
+	if err != nil {
+		return err
+	}
+	manifest, err := tfhe.WriteKeySetToDir(ks, *dir, !*noCks)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("generated key set %s in %s\n", manifest.KeySetId, *dir)
+	printManifest(manifest)
+	return nil
+}
+
+func verify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	dir := flags.String("dir", "", "keys directory")
+	flags.Parse(args)
+	if *dir == "" {
+		return errors.New("-dir is required")
+	}
+	manifest, err := tfhe.VerifyKeyManifest(*dir)
+	if err != nil {
+		return err
+	}
+	// Loading checks that the keys deserialize and work together, see tfhe.KeySet.SelfTest().
+	if err := tfhe.InitGlobalKeysFromFiles(*dir, fhevm.NewDefaultLogger()); err != nil {
+		return err
+	}
+	fmt.Printf("key set %s in %s is valid\n", manifest.KeySetId, *dir)
+	return nil
+}
+
+func fingerprint(args []string) error {
+	flags := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	dir := flags.String("dir", "", "keys directory")
+	flags.Parse(args)
+	if *dir == "" {
+		return errors.New("-dir is required")
+	}
+	// Fingerprints are computed from the files, such that directories without a manifest can be inspected too.
+	pksBytes, err := os.ReadFile(path.Join(*dir, tfhe.PublicKeyFileName))
+	if err != nil {
+		return err
+	}
+	pksHash := crypto.Keccak256Hash(pksBytes)
+	fmt.Printf("keySetId: %x\n", pksHash[:4])
+	for _, name := range []string{tfhe.PublicKeyFileName, tfhe.ServerKeyFileName, tfhe.ClientKeyFileName, tfhe.PublicParamsFileName} {
+		bytes, err := os.ReadFile(path.Join(*dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", name, crypto.Keccak256Hash(bytes).Hex())
+	}
+	return nil
+}
+
+func pubkey(args []string) error {
+	flags := flag.NewFlagSet("pubkey", flag.ExitOnError)
+	dir := flags.String("dir", "", "keys directory")
+	out := flags.String("out", "", "file to write the public key to, printed in hex if empty")
+	abi := flags.Bool("abi", false, "ABI-encode the public key, as the fhePubKey precompile method returns it")
+	evmArray := flags.Bool("evm-array", false, "with -abi, encode the public key as an EVM array")
+	flags.Parse(args)
+	if *dir == "" {
+		return errors.New("-dir is required")
+	}
+	if err := tfhe.InitGlobalKeysFromFiles(*dir, fhevm.NewDefaultLogger()); err != nil {
+		return err
+	}
+	pksBytes, err := tfhe.SerializePublicKey()
+	if err != nil {
+		return err
+	}
+	if *abi {
+		pksBytes = fhevm.EncodeFhePubKeyOutput(pksBytes, *evmArray)
+	}
+	if *out == "" {
+		fmt.Println(hex.EncodeToString(pksBytes))
+		return nil
+	}
+	return os.WriteFile(*out, pksBytes, 0o644)
+}
+
+func printManifest(manifest *tfhe.KeyManifest) {
+	fmt.Printf("parameters: %s (%s, %s)\n", manifest.ParameterSet, manifest.Parameters, manifest.CompressionParameters)
+	names := make([]string, 0, len(manifest.Files))
+	for name := range manifest.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := manifest.Files[name]
+		fmt.Printf("%s: %s (%d bytes)\n", name, file.Keccak256.Hex(), file.Size)
+	}
+}
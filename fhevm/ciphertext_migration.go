@@ -0,0 +1,168 @@
+package fhevm
+
+import (
+	"errors"
+	"fmt"
+
+	"PureChain/common"
+	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
+)
+
+// Progress of a key set migration, see MigrateCiphertextsToKeySet().
+type KeySetMigrationProgress struct {
+	// Number of handles in the list that have been processed. A stopped migration resumes from this index.
+	Processed int
+	// Number of ciphertexts switched to the new key set and re-persisted.
+	Migrated int
+	// Number of handles that don't point to a ciphertext or whose ciphertext already is under the new key set.
+	Skipped int
+	// Total number of handles in the list.
+	Total int
+}
+
+// Returned by the progress callback of MigrateCiphertextsToKeySet() to stop the migration early, e.g. at the end of
+// a maintenance window. The migration can be resumed later from the returned progress.
+var ErrKeySetMigrationStopped = errors.New("key set migration stopped")
+
+var ErrKeySetMigrationBeforeFork = errors.New("key set migration applied before its fork block")
+
+// Switches the persisted ciphertexts at `handles` to the registered key set `toKeySetId` and re-persists them at the
+// same handles, such that contracts keep referring to them. A key switching key from the ciphertexts' key set to
+// `toKeySetId` must be registered, see tfhe.RegisterKeySwitchingKey().
+//
+// Handles are processed in order, starting at index `resumeFrom`, and at most `maxCount` of them are processed, zero
+// meaning all of them. `onProgress`, if not nil, is called after each handle. If it returns an error, the migration
+// stops and returns that error along with the progress so far. Passing the returned `Processed` count as
+// `resumeFrom` continues where the migration stopped. Migrating is idempotent, as ciphertexts already under
+// `toKeySetId` are skipped, so restarting from an earlier index is safe too.
+//
+// It rewrites consensus state outside of any transaction, so chains apply it as a state transition of fork blocks,
+// see KeySetMigrationFork, rather than from a single node.
+//
+// Ciphertexts with legacy metadata must be migrated with MigrateCiphertextMetadata() first, as their key set is not
+// recorded.
+func MigrateCiphertextsToKeySet(env EVMEnvironment, handles []common.Hash, toKeySetId uint32, resumeFrom int,
+	maxCount int, onProgress func(KeySetMigrationProgress) error) (KeySetMigrationProgress, error) {
+	logger := env.GetLogger()
+	progress := KeySetMigrationProgress{Processed: resumeFrom, Total: len(handles)}
+	if resumeFrom < 0 || resumeFrom > len(handles) {
+		return progress, fmt.Errorf("invalid key set migration resume index %d for %d handles", resumeFrom, len(handles))
+	}
+	if _, found := tfhe.GetKeySet(toKeySetId); !found {
+		return progress, fmt.Errorf("%w: %08x", tfhe.ErrUnknownKeySet, toKeySetId)
+	}
+	end := len(handles)
+	if maxCount > 0 && maxCount < end-resumeFrom {
+		end = resumeFrom + maxCount
+	}
+	for _, handle := range handles[resumeFrom:end] {
+		migrated, err := migrateCiphertextToKeySet(env, handle, toKeySetId)
+		if err != nil {
+			logger.Error("failed to migrate ciphertext to key set", "handle", handle.Hex(), "keySetId", toKeySetId, "err", err)
+			return progress, err
+		}
+		if migrated {
+			progress.Migrated++
+		} else {
+			progress.Skipped++
+		}
+		progress.Processed++
+		if onProgress != nil {
+			if err := onProgress(progress); err != nil {
+				return progress, err
+			}
+		}
+	}
+	logger.Info("ciphertexts migrated to key set", "keySetId", toKeySetId, "migrated", progress.Migrated,
+		"skipped", progress.Skipped, "processed", progress.Processed, "total", progress.Total)
+	return progress, nil
+}
+
+// A key set migration applied by all nodes as a state transition of consecutive fork blocks, in batches, such that
+// no block stalls on it. All nodes must use the same definition.
+type KeySetMigrationFork struct {
+	// Number of the block the migration starts at.
+	Block uint64
+	// Registered key set the ciphertexts are switched to.
+	ToKeySetId uint32
+	// Maximum number of handles processed per block, which bounds the time the migration adds to a block. Zero
+	// processes all handles at `Block`.
+	HandlesPerBlock int
+	// Handles of the persisted ciphertexts to switch, in order.
+	Handles []common.Hash
+}
+
+// Returns the number of the last block of the migration.
+func (fork *KeySetMigrationFork) LastBlock() uint64 {
+	if fork.HandlesPerBlock <= 0 || len(fork.Handles) == 0 {
+		return fork.Block
+	}
+	return fork.Block + uint64((len(fork.Handles)-1)/fork.HandlesPerBlock)
+}
+
+// Migrates the batch of `fork.Handles` assigned to the block `blockNumber`, see MigrateCiphertextsToKeySet(). Hosts
+// call it for every block from `fork.Block` to LastBlock(), on the state of the block before its first transaction,
+// e.g. next to other irregular state changes of a hard fork. Each block resumes where the previous one stopped, as
+// batches only depend on the block number. Key switching and persisting are deterministic, so all nodes with the
+// same key switching key reach the same state. An error leaves the batch partially migrated: hosts must then reject
+// the block, like any other failed state transition, rather than commit its state. `onProgress` is only meant for
+// reporting, as stopping a batch early fails the block too.
+//
+// Fails without changing the state before `fork.Block`, and does nothing after LastBlock().
+func (fork *KeySetMigrationFork) MigrateBlock(env EVMEnvironment, blockNumber uint64,
+	onProgress func(KeySetMigrationProgress) error) (KeySetMigrationProgress, error) {
+	if blockNumber < fork.Block {
+		return KeySetMigrationProgress{Total: len(fork.Handles)},
+			fmt.Errorf("%w: block %d, fork block %d", ErrKeySetMigrationBeforeFork, blockNumber, fork.Block)
+	}
+	if blockNumber > fork.LastBlock() {
+		return KeySetMigrationProgress{Processed: len(fork.Handles), Total: len(fork.Handles)}, nil
+	}
+	start := int(blockNumber-fork.Block) * fork.HandlesPerBlock
+	return MigrateCiphertextsToKeySet(env, fork.Handles, fork.ToKeySetId, start, fork.HandlesPerBlock, onProgress)
+}
+
+func migrateCiphertextToKeySet(env EVMEnvironment, handle common.Hash, toKeySetId uint32) (bool, error) {
+	metadata := loadCiphertextMetadata(env, handle)
+	if metadata == nil {
+		return false, nil
+	}
+	if metadata.version == legacyCiphertextMetadataVersion {
+		return false, errors.New("ciphertext has legacy metadata, migrate it with MigrateCiphertextMetadata() first")
+	}
+	if metadata.keySetId == toKeySetId {
+		return false, nil
+	}
+	ctBytes := readCiphertextBytes(env, handle, metadata.length)
+	if err := checkCiphertextIntegrity(metadata, ctBytes); err != nil {
+		return false, err
+	}
+	ct, err := deserializeStoredCiphertext(metadata, ctBytes)
+	if err != nil {
+		return false, err
+	}
+	switched, err := ct.SwitchKeySet(toKeySetId)
+	if err != nil {
+		return false, err
+	}
+	written, err := writeCiphertext(env, handle, switched)
+	if err != nil {
+		return false, err
+	}
+	clearStaleCiphertextSlots(env, handle, metadata.length, written.length)
+	delete(env.FhevmData().loadedCiphertexts, handle)
+	return true, nil
+}
+
+// Zeroes the ciphertext slots at `handle` that were used by a ciphertext of `oldLength` bytes, but not by its
+// replacement of `newLength` bytes.
+func clearStaleCiphertextSlots(env EVMEnvironment, handle common.Hash, oldLength uint64, newLength uint64) {
+	oldSlots := (oldLength + 31) / 32
+	newSlots := (newLength + 31) / 32
+	slot := newInt(handle.Bytes())
+	slot.AddUint64(slot, 1+newSlots)
+	for i := newSlots; i < oldSlots; i++ {
+		env.SetState(CiphertextStorageAddress, slot.Bytes32(), common.Hash{})
+		slot.AddUint64(slot, 1)
+	}
+}
@@ -0,0 +1,134 @@
+package fhevm
+
+import (
+	"runtime"
+	"sync"
+
+	"PureChain/common"
+	"PureChain/core/types"
+	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
+)
+
+// A persisted ciphertext loaded ahead of execution, see PrefetchCiphertexts().
+type prefetchedCiphertext struct {
+	// Metadata the ciphertext was loaded with. It includes the digest of the ciphertext, so the prefetched ciphertext
+	// is only used if the metadata in storage is still the same when the ciphertext is loaded.
+	metadata [32]byte
+	ct       *tfhe.TfheCiphertext
+}
+
+// Prefetches the ciphertexts a transaction is expected to load, given the storage slots it is expected to access,
+// e.g. its EIP-2930 access list or the slots accessed by a previous execution. Keys of the CiphertextStorageAddress
+// entries are handles, while keys of other contracts are slots that hold handles.
+//
+// Hosts call it before executing the transaction, after FhevmData.Reset(), so that loading ciphertexts during
+// execution doesn't read storage or deserialize them. Gas is the same whether ciphertexts are prefetched or not.
+// Returns the number of prefetched ciphertexts, see PrefetchCiphertextHandles().
+func PrefetchCiphertexts(env EVMEnvironment, accessList types.AccessList) int {
+	handles := make([]common.Hash, 0, accessList.StorageKeys())
+	for _, tuple := range accessList {
+		for _, key := range tuple.StorageKeys {
+			if tuple.Address == CiphertextStorageAddress {
+				handles = append(handles, key)
+			} else {
+				handles = append(handles, env.GetState(tuple.Address, key))
+			}
+		}
+	}
+	return PrefetchCiphertextHandles(env, handles)
+}
+
+// Prefetches the ciphertexts of `handles`, see PrefetchCiphertexts(). Handles that don't point to a ciphertext, that
+// are already loaded or that fail their integrity check are skipped, the latter failing again when loaded during
+// execution. Ciphertexts with legacy metadata are skipped too, as they have no digest to check them against storage
+// when loaded.
+//
+// Storage is read on the calling goroutine, as EVMEnvironment implementations are generally not safe for concurrent
+// use. Integrity checks and decompression, which dominate the cost of loading ciphertexts, run in parallel.
+func PrefetchCiphertextHandles(env EVMEnvironment, handles []common.Hash) int {
+	data := env.FhevmData()
+	type job struct {
+		handle   common.Hash
+		metadata [32]byte
+		ctBytes  []byte
+	}
+	var jobs []job
+	seen := make(map[common.Hash]bool)
+	for _, handle := range handles {
+		if handle == (common.Hash{}) || seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		if _, loaded := data.loadedCiphertexts[handle]; loaded {
+			continue
+		}
+		if _, prefetched := data.prefetchedCiphertexts[handle]; prefetched {
+			continue
+		}
+		metadataBytes := env.GetState(CiphertextStorageAddress, handle)
+		if metadataBytes == (common.Hash{}) {
+			continue
+		}
+		metadata := newCiphertextMetadata(metadataBytes)
+		if metadata.version == legacyCiphertextMetadataVersion || !tfhe.IsValidFheType(byte(metadata.fheUintType)) {
+			continue
+		}
+		// Slots that don't hold a handle can look like metadata, so their length is bounded before reading storage.
+		ks, found := tfhe.GetKeySet(metadata.keySetId)
+		if !found || metadata.length > uint64(ks.ExpandedCiphertextSize(metadata.fheUintType)) {
+			continue
+		}
+		jobs = append(jobs, job{handle, metadataBytes, readCiphertextBytes(env, handle, metadata.length)})
+	}
+
+	cts := make([]*tfhe.TfheCiphertext, len(jobs))
+	indexes := make(chan int, len(jobs))
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	var wg sync.WaitGroup
+	for w := 0; w < minInt(runtime.GOMAXPROCS(0), len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				metadata := newCiphertextMetadata(jobs[i].metadata)
+				if err := checkCiphertextIntegrity(metadata, jobs[i].ctBytes); err != nil {
+					continue
+				}
+				if ct, err := deserializeStoredCiphertext(metadata, jobs[i].ctBytes); err == nil {
+					cts[i] = ct
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	count := 0
+	for i, ct := range cts {
+		if ct == nil {
+			continue
+		}
+		if data.prefetchedCiphertexts == nil {
+			data.prefetchedCiphertexts = make(map[common.Hash]prefetchedCiphertext)
+		}
+		data.prefetchedCiphertexts[jobs[i].handle] = prefetchedCiphertext{jobs[i].metadata, ct}
+		count++
+	}
+	env.GetLogger().Debug("prefetched ciphertexts", "handles", len(handles), "prefetched", count)
+	return count
+}
+
+// Returns the ciphertext prefetched for `handle`, if it was prefetched with the given metadata, and forgets it.
+func (data *FhevmData) takePrefetchedCiphertext(handle common.Hash, metadata [32]byte) (*tfhe.TfheCiphertext, bool) {
+	prefetched, found := data.prefetchedCiphertexts[handle]
+	if !found {
+		return nil, false
+	}
+	delete(data.prefetchedCiphertexts, handle)
+	if prefetched.metadata != metadata {
+		return nil, false
+	}
+	return prefetched.ct, true
+}
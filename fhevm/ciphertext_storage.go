@@ -1,9 +1,12 @@
 package fhevm
 
 import (
+	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 
 	"PureChain/common"
+	"PureChain/crypto"
 	"github.com/holiman/uint256"
 	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
 )
@@ -23,24 +26,66 @@ func minUint64(a, b uint64) uint64 {
 }
 
 // Ciphertext metadata is stored in a single 32-byte slot.
-// Currently, we only utilize 9 bytes from the slot.
+//
+// Layout of the metadata slot:
+//   - byte 0: metadata version, see `ciphertextMetadataVersion`
+//   - byte 1: ciphertext type
+//   - byte 2: flags, see `ciphertextCompressedFlag`
+//   - byte 3: parameter set of the key set, see tfhe.ParameterSet. Zero, i.e. the default parameter set, for
+//     ciphertexts persisted before parameter sets could be selected
+//   - bytes 4..7: identifier of the key set the ciphertext is encrypted under, see tfhe.KeySet
+//   - bytes 8..11: length of the serialized ciphertext
+//   - bytes 12..31: digest of the serialized ciphertext, see `ciphertextDigest`
+//
+// Legacy metadata is unversioned and holds the length in bytes 24..31 and the type in bytes 16..23. Its byte 0 is
+// always zero, i.e. it has version 0. It can be upgraded in place with MigrateCiphertextMetadata().
+const ciphertextMetadataVersion uint8 = 1
+const legacyCiphertextMetadataVersion uint8 = 0
+
+// Set if the ciphertext is stored in compressed form, see tfhe.TfheCiphertext.SerializeCompressed(). Ciphertexts
+// persisted before compression was introduced are stored uncompressed.
+const ciphertextCompressedFlag uint8 = 1 << 0
+
+const ciphertextDigestLen = 20
+
 type ciphertextMetadata struct {
-	length      uint64
-	fheUintType tfhe.FheUintType
+	version      uint8
+	fheUintType  tfhe.FheUintType
+	compressed   bool
+	parameterSet tfhe.ParameterSet
+	keySetId     uint32
+	length       uint64
+	digest       [ciphertextDigestLen]byte
 }
 
 func (m ciphertextMetadata) serialize() [32]byte {
-	u := uint256.NewInt(0)
-	u[0] = m.length
-	u[1] = uint64(m.fheUintType)
-	return u.Bytes32()
+	var buf [32]byte
+	buf[0] = m.version
+	buf[1] = byte(m.fheUintType)
+	if m.compressed {
+		buf[2] |= ciphertextCompressedFlag
+	}
+	buf[3] = byte(m.parameterSet)
+	binary.BigEndian.PutUint32(buf[4:8], m.keySetId)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(m.length))
+	copy(buf[12:], m.digest[:])
+	return buf
 }
 
 func (m *ciphertextMetadata) deserialize(buf [32]byte) *ciphertextMetadata {
-	u := uint256.NewInt(0)
-	u.SetBytes(buf[:])
-	m.length = u[0]
-	m.fheUintType = tfhe.FheUintType(u[1])
+	m.version = buf[0]
+	if m.version == legacyCiphertextMetadataVersion {
+		u := uint256.NewInt(0)
+		u.SetBytes(buf[:])
+		*m = ciphertextMetadata{length: u[0], fheUintType: tfhe.FheUintType(u[1])}
+		return m
+	}
+	m.fheUintType = tfhe.FheUintType(buf[1])
+	m.compressed = buf[2]&ciphertextCompressedFlag != 0
+	m.parameterSet = tfhe.ParameterSet(buf[3])
+	m.keySetId = binary.BigEndian.Uint32(buf[4:8])
+	m.length = uint64(binary.BigEndian.Uint32(buf[8:12]))
+	copy(m.digest[:], buf[12:])
 	return m
 }
 
@@ -49,6 +94,12 @@ func newCiphertextMetadata(buf [32]byte) *ciphertextMetadata {
 	return m.deserialize(buf)
 }
 
+// Returns the digest of the given serialized ciphertext, as stored in its metadata.
+func ciphertextDigest(ctBytes []byte) (digest [ciphertextDigestLen]byte) {
+	copy(digest[:], crypto.Keccak256(ctBytes))
+	return
+}
+
 func isCiphertextPersisted(env EVMEnvironment, handle common.Hash) bool {
 	metadataInt := newInt(env.GetState(CiphertextStorageAddress, handle).Bytes())
 	return !metadataInt.IsZero()
@@ -78,8 +129,68 @@ func loadCiphertext(env EVMEnvironment, handle common.Hash) (ct *tfhe.TfheCipher
 		return nil, ColdSloadCostEIP2929
 	}
 	metadata := newCiphertextMetadata(metadataInt.Bytes32())
-	ctBytes := make([]byte, 0)
-	left := metadata.length
+	// A ciphertext prefetched with the same metadata, and therefore the same digest, is the one in storage.
+	ct, prefetched := env.FhevmData().takePrefetchedCiphertext(handle, metadataInt.Bytes32())
+	if !prefetched {
+		ctBytes := readCiphertextBytes(env, handle, metadata.length)
+		if err := checkCiphertextIntegrity(metadata, ctBytes); err != nil {
+			logger.Error("persisted ciphertext failed integrity check", "handle", handle.Hex(), "err", err)
+			return nil, ColdSloadCostEIP2929 + DeserializeCiphertextGas
+		}
+		var err error
+		if ct, err = deserializeStoredCiphertext(metadata, ctBytes); err != nil {
+			logger.Error("failed to deserialize ciphertext from storage", "err", err)
+			return nil, ColdSloadCostEIP2929 + DeserializeCiphertextGas
+		}
+	}
+	// The handle identifies the ciphertext, even if it was switched to another key set since it was persisted.
+	ct.Hash = &handle
+	attachNativeCiphertext(env, ct)
+	env.FhevmData().loadedCiphertexts[handle] = ct
+	if !metadata.compressed {
+		return ct, uncompressedCiphertextLoadGas(env, metadata)
+	}
+	return ct, env.FhevmParams().GasCosts.FheStorageSloadGas[ct.Type()]
+}
+
+// Returns the gas needed to load the ciphertext stored uncompressed described by `metadata`. Its stored length is its
+// expanded size, which is paid per 32-byte word. It never costs less than loading a compressed ciphertext of the same
+// type, as that would make keeping ciphertexts uncompressed cheaper.
+func uncompressedCiphertextLoadGas(env EVMEnvironment, metadata *ciphertextMetadata) uint64 {
+	costs := env.FhevmParams().GasCosts
+	words := (metadata.length + 31) / 32
+	gas := words * costs.FheStorageSloadUncompressedWordGas
+	if compressedGas := costs.FheStorageSloadGas[metadata.fheUintType]; gas < compressedGas {
+		return compressedGas
+	}
+	return gas
+}
+
+// Deserializes the stored ciphertext `ctBytes` described by `metadata`, under the key set recorded in the metadata.
+func deserializeStoredCiphertext(metadata *ciphertextMetadata, ctBytes []byte) (*tfhe.TfheCiphertext, error) {
+	// Legacy ciphertexts are encrypted under the active key set, see MigrateCiphertextMetadata().
+	keySetId := tfhe.GetKeySetId()
+	if metadata.version != legacyCiphertextMetadataVersion {
+		keySetId = metadata.keySetId
+	}
+	ct := new(tfhe.TfheCiphertext)
+	if metadata.compressed {
+		if err := ct.DeserializeCompressedWithKeySet(ctBytes, metadata.fheUintType, keySetId); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := ct.Deserialize(ctBytes, metadata.fheUintType); err != nil {
+			return nil, err
+		}
+		ct.KeySetId = keySetId
+	}
+	return ct, nil
+}
+
+// Reads `length` bytes of the ciphertext stored at `handle`. They start at the slot following the metadata slot.
+func readCiphertextBytes(env EVMEnvironment, handle common.Hash, length uint64) []byte {
+	ctBytes := make([]byte, 0, length)
+	left := length
 	idx := newInt(handle.Bytes())
 	idx.AddUint64(idx, 1)
 	for left > 0 {
@@ -89,32 +200,97 @@ func loadCiphertext(env EVMEnvironment, handle common.Hash) (ct *tfhe.TfheCipher
 		ctBytes = append(ctBytes, bytes[0:toAppend]...)
 		idx.AddUint64(idx, 1)
 	}
-	ct = new(tfhe.TfheCiphertext)
-	err := ct.Deserialize(ctBytes, metadata.fheUintType)
-	if err != nil {
-		logger.Error("failed to deserialize ciphertext from storage", "err", err)
-		return nil, ColdSloadCostEIP2929 + DeserializeCiphertextGas
+	return ctBytes
+}
+
+// Checks that a ciphertext read back from storage matches its metadata and that its key set is loaded. Legacy
+// metadata has no digest, so legacy ciphertexts can't be checked until they are migrated.
+func checkCiphertextIntegrity(metadata *ciphertextMetadata, ctBytes []byte) error {
+	switch metadata.version {
+	case legacyCiphertextMetadataVersion:
+		return nil
+	case ciphertextMetadataVersion:
+	default:
+		return fmt.Errorf("unsupported ciphertext metadata version %d", metadata.version)
 	}
-	env.FhevmData().loadedCiphertexts[handle] = ct
-	return ct, env.FhevmParams().GasCosts.FheStorageSloadGas[ct.Type()]
+	ks, found := tfhe.GetKeySet(metadata.keySetId)
+	if !found {
+		return fmt.Errorf("ciphertext encrypted under key set %08x, which is not loaded", metadata.keySetId)
+	}
+	if ks.ParameterSet() != metadata.parameterSet {
+		return fmt.Errorf("ciphertext has parameter set %s, but its key set %08x has %s", metadata.parameterSet,
+			metadata.keySetId, ks.ParameterSet())
+	}
+	if digest := ciphertextDigest(ctBytes); digest != metadata.digest {
+		return fmt.Errorf("ciphertext digest %x doesn't match metadata digest %x", digest, metadata.digest)
+	}
+	return nil
+}
+
+// Upgrades the legacy metadata of the ciphertext at `handle` to the current version, in place. Legacy ciphertexts
+// are assumed to be encrypted under the active key set. The ciphertext is deserialized first, such that a corrupted
+// ciphertext doesn't get a valid digest. Returns false if there is nothing to migrate, i.e. if `handle` doesn't point
+// to a ciphertext or if its metadata is already current.
+func MigrateCiphertextMetadata(env EVMEnvironment, handle common.Hash) (bool, error) {
+	metadata := loadCiphertextMetadata(env, handle)
+	if metadata == nil || metadata.version != legacyCiphertextMetadataVersion {
+		return false, nil
+	}
+	ctBytes := readCiphertextBytes(env, handle, metadata.length)
+	ct := new(tfhe.TfheCiphertext)
+	if err := ct.Deserialize(ctBytes, metadata.fheUintType); err != nil {
+		env.GetLogger().Error("failed to migrate ciphertext metadata", "handle", handle.Hex(), "err", err)
+		return false, err
+	}
+	metadata.version = ciphertextMetadataVersion
+	metadata.keySetId = tfhe.GetKeySetId()
+	metadata.parameterSet = tfhe.GetParameterSet()
+	metadata.digest = ciphertextDigest(ctBytes)
+	env.SetState(CiphertextStorageAddress, handle, metadata.serialize())
+	return true, nil
 }
 
 func insertCiphertextToMemory(env EVMEnvironment, handle common.Hash, ct *tfhe.TfheCiphertext) {
+	attachNativeCiphertext(env, ct)
 	env.FhevmData().loadedCiphertexts[handle] = ct
 }
 
-// Persist the given ciphertext.
-func persistCiphertext(env EVMEnvironment, handle common.Hash, ct *tfhe.TfheCiphertext) {
+// Persist the given ciphertext. Fails without persisting anything if the ciphertext can't be compressed, see
+// writeCiphertext().
+func persistCiphertext(env EVMEnvironment, handle common.Hash, ct *tfhe.TfheCiphertext) error {
 	logger := env.GetLogger()
 	if isCiphertextPersisted(env, handle) {
 		// Assuming a handle is a hash of the ciphertext, if metadata is already existing in storage it means the ciphertext is too.
 		logger.Info("ciphertext already persisted to storage", "handle", handle.Hex())
-		return
+		return nil
 	}
+	_, err := writeCiphertext(env, handle, ct)
+	return err
+}
 
+// Writes the given ciphertext and its metadata at `handle`, overwriting what is there. Returns the written metadata.
+//
+// Ciphertexts are stored compressed, as storage is priced by compressed size, see GasCosts.FheStorageSstoreGas.
+// Compression only fails if the server key has no compression keys, in which case it fails on all nodes and nothing
+// is written, rather than storing a bigger ciphertext than paid for.
+func writeCiphertext(env EVMEnvironment, handle common.Hash, ct *tfhe.TfheCiphertext) (ciphertextMetadata, error) {
+	logger := env.GetLogger()
 	metadata := ciphertextMetadata{}
-	metadata.length = uint64(tfhe.ExpandedFheCiphertextSize[ct.Type()])
+	metadata.version = ciphertextMetadataVersion
 	metadata.fheUintType = ct.Type()
+	metadata.keySetId = ct.KeySetId
+	if ks, found := tfhe.GetKeySet(ct.KeySetId); found {
+		metadata.parameterSet = ks.ParameterSet()
+	}
+	ctBytes, err := ct.SerializeCompressed()
+	if err != nil {
+		logger.Error("failed to compress ciphertext, not persisting it", "handle", handle.Hex(), "err", err)
+		return metadata, fmt.Errorf("failed to compress ciphertext for storage: %w", err)
+	}
+	metadata.compressed = true
+	metadata.length = uint64(len(ctBytes))
+	// The digest covers what is read back on load, i.e. exactly `length` bytes.
+	metadata.digest = ciphertextDigest(ctBytes[:metadata.length])
 
 	// Persist the metadata in storage.
 	env.SetState(CiphertextStorageAddress, handle, metadata.serialize())
@@ -126,11 +302,11 @@ func persistCiphertext(env EVMEnvironment, handle common.Hash, ct *tfhe.TfheCiph
 			"handle", hex.EncodeToString(handle.Bytes()),
 			"type", metadata.fheUintType,
 			"len", metadata.length,
+			"compressed", metadata.compressed,
 			"ciphertextSlot", hex.EncodeToString(ciphertextSlot.Bytes()))
 	}
 	ctPart32 := make([]byte, 32)
 	partIdx := 0
-	ctBytes := ct.Serialize()
 	for i, b := range ctBytes {
 		if i%32 == 0 && i != 0 {
 			env.SetState(CiphertextStorageAddress, ciphertextSlot.Bytes32(), common.BytesToHash(ctPart32))
@@ -144,6 +320,7 @@ func persistCiphertext(env EVMEnvironment, handle common.Hash, ct *tfhe.TfheCiph
 	if len(ctPart32) != 0 {
 		env.SetState(CiphertextStorageAddress, ciphertextSlot.Bytes32(), common.BytesToHash(ctPart32))
 	}
+	return metadata, nil
 }
 
 func GetCiphertextFromMemory(env EVMEnvironment, handle common.Hash) *tfhe.TfheCiphertext {
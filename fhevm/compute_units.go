@@ -0,0 +1,127 @@
+package fhevm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTxFheComputeLimitExceeded    = errors.New("transaction FHE compute limit exceeded")
+	ErrBlockFheComputeLimitExceeded = errors.New("block FHE compute limit exceeded")
+)
+
+// Returns the default compute units of FheLib methods, in percent of the gas of their operation. Methods that don't
+// compute on ciphertexts, e.g. fhePubKey or getCiphertext, are left out and don't consume compute units.
+//
+// Multiplication, division and remainder run long chains of sequential PBS, so their latency is higher than their gas
+// relative to additions, which is kept low for them to remain usable in contracts. They are weighted by their latency.
+func DefaultFheComputeUnitsPercent() map[string]uint64 {
+	percent := make(map[string]uint64)
+	for _, method := range []string{
+		"fheAdd", "fheSub", "fheMin", "fheMax", "fheRand", "fheRandBounded", "cast", "fheLe", "fheLt", "fheEq",
+		"fheGe", "fheGt", "fheShl", "fheShr", "fheRotl", "fheRotr", "fheNe", "fheNeg", "fheNot", "fheBitAnd",
+		"fheBitOr", "fheBitXor", "fheIfThenElse", "fheArrayEq", "trivialEncrypt", "verifyCiphertext",
+	} {
+		percent[method] = 100
+	}
+	percent["fheMul"] = 200
+	percent["fheDiv"] = 300
+	percent["fheRem"] = 300
+	return percent
+}
+
+// Returns the FHE compute units of a call to the method that required `gas`. They are derived from the gas of the
+// call, scaled by the percent of the method in FhevmParams.FheComputeUnitsPercent, such that methods whose latency is
+// not reflected by their gas can be weighted without repricing them. Compute units are the same on all nodes, as gas
+// only depends on the input and on the state.
+func (fheLibMethod *FheLibMethod) ComputeUnits(environment EVMEnvironment, gas uint64) uint64 {
+	percent := environment.FhevmParams().FheComputeUnitsPercent[fheLibMethod.name]
+	if percent == 0 {
+		return 0
+	}
+	return gas * percent / 100
+}
+
+// Returns the FHE compute units consumed by the current transaction.
+func (data *FhevmData) TxFheComputeUnits() uint64 {
+	return data.txFheComputeUnits
+}
+
+// Returns the FHE compute units consumed by the current block, including the current transaction. Block builders read
+// it after every transaction to decide whether to include more transactions in the block.
+func (data *FhevmData) BlockFheComputeUnits() uint64 {
+	return data.blockFheComputeUnits
+}
+
+// Sets the FHE compute units consumed by the current block. Hosts call it with 0 at the start of every block, unlike
+// Reset() that is called for every transaction. Hosts that create a new FhevmData for every transaction call it with
+// the units consumed by the previous transactions of the block, and block builders that drop a transaction call it
+// with the units consumed before it.
+func (data *FhevmData) SetBlockFheComputeUnits(units uint64) {
+	data.blockFheComputeUnits = units
+}
+
+// FHE compute units consumed at some point of a block, see FhevmData.FheComputeUnitsSnapshot().
+type FheComputeUnitsSnapshot struct {
+	tx    uint64
+	block uint64
+}
+
+// Returns the FHE compute units consumed so far. Hosts take it along with every StateDB snapshot, i.e. when entering
+// a call or a contract creation, and restore it with RevertFheComputeUnits() where they revert the StateDB, such that
+// reverted calls and transactions don't consume compute units.
+func (data *FhevmData) FheComputeUnitsSnapshot() FheComputeUnitsSnapshot {
+	return FheComputeUnitsSnapshot{tx: data.txFheComputeUnits, block: data.blockFheComputeUnits}
+}
+
+// Restores the FHE compute units consumed when `snapshot` was taken.
+func (data *FhevmData) RevertFheComputeUnits(snapshot FheComputeUnitsSnapshot) {
+	data.txFheComputeUnits = snapshot.tx
+	data.blockFheComputeUnits = snapshot.block
+}
+
+// Fails if consuming `units` FHE compute units would make the transaction or the block exceed its limit. A zero limit
+// disables it.
+func checkFheComputeUnits(environment EVMEnvironment, units uint64) error {
+	if units == 0 {
+		return nil
+	}
+	data := environment.FhevmData()
+	params := environment.FhevmParams()
+	if max := params.MaxFheComputeUnitsPerTx; max != 0 && (units > max || data.txFheComputeUnits > max-units) {
+		return fmt.Errorf("%w: %d units consumed, %d more needed, limit is %d",
+			ErrTxFheComputeLimitExceeded, data.txFheComputeUnits, units, max)
+	}
+	if max := params.MaxFheComputeUnitsPerBlock; max != 0 && (units > max || data.blockFheComputeUnits > max-units) {
+		return fmt.Errorf("%w: %d units consumed, %d more needed, limit is %d",
+			ErrBlockFheComputeLimitExceeded, data.blockFheComputeUnits, units, max)
+	}
+	return nil
+}
+
+// Consumes `units` FHE compute units, checked with checkFheComputeUnits() before the call that succeeded.
+func consumeFheComputeUnits(environment EVMEnvironment, units uint64) {
+	data := environment.FhevmData()
+	data.txFheComputeUnits += units
+	data.blockFheComputeUnits += units
+}
+
+// The gas of the last FheLib call priced by FheLibRequiredGas(), such that FheLibRun() doesn't parse and price the
+// same call again to derive its compute units.
+type pricedFheLibCall struct {
+	input []byte
+	gas   uint64
+}
+
+// Returns the gas of the FheLib call with `input`, the function signature included. The EVM calls RequiredGas() right
+// before Run(), so this is the gas it computed, unless the call was run without being priced.
+func fheLibCallGas(environment EVMEnvironment, fheLibMethod *FheLibMethod, input []byte) uint64 {
+	data := environment.FhevmData()
+	priced := data.pricedFheLibCall
+	data.pricedFheLibCall = pricedFheLibCall{}
+	if priced.input != nil && bytes.Equal(priced.input, input) {
+		return priced.gas
+	}
+	return fheLibMethod.RequiredGas(environment, input[4:])
+}
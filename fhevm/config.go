@@ -0,0 +1,95 @@
+package fhevm
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"PureChain/common"
+	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
+)
+
+// Configuration of an fhEVM instance. Hosts build it explicitly, or from environment variables with ConfigFromEnv(),
+// and call Init() before executing transactions.
+type Config struct {
+	// Directory the key sets are loaded from, see tfhe.InitGlobalKeysFromFiles(). Keys are not loaded if empty, e.g.
+	// if the host loads or generates them itself.
+	KeysDir string
+	// Parameter set of the keys. Init() fails if the active key set loaded from KeysDir has another one, as the gas
+	// costs in Params are meant for it.
+	ParameterSet tfhe.ParameterSet
+	// Parameters to be returned by EVMEnvironment.FhevmParams(): gas costs, the TFHEExecutor contract address, KMS
+	// settings and caches.
+	Params FhevmParams
+	// Logger key loading reports through, see tfhe.InitGlobalKeysFromFiles(). NewDefaultLogger() is used if nil.
+	Logger Logger
+}
+
+func DefaultConfig() Config {
+	return DefaultConfigForParameterSet(tfhe.ParameterSetDefault)
+}
+
+// Returns the default config for keys of the parameter set `p`, see DefaultFhevmParamsForParameterSet().
+func DefaultConfigForParameterSet(p tfhe.ParameterSet) Config {
+	return Config{ParameterSet: p, Params: DefaultFhevmParamsForParameterSet(p)}
+}
+
+// Returns the default config, with keys loaded from FHEVM_GO_KEYS_DIR, the TFHEExecutor contract address read from
+// TFHE_EXECUTOR_CONTRACT_ADDRESS and the KMS endpoint read from KMS_ENDPOINT_ADDR. The parameter set is read from
+// FHEVM_GO_PARAMETER_SET, e.g. "multi-bit", and is the default one if unset. The size of the result cache is read from
+// FHEVM_GO_RESULT_CACHE_BYTES, which is disabled if unset. Only TFHE_EXECUTOR_CONTRACT_ADDRESS is required.
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+	if name, found := os.LookupEnv("FHEVM_GO_PARAMETER_SET"); found {
+		p, err := tfhe.ParseParameterSet(name)
+		if err != nil {
+			return config, fmt.Errorf("invalid FHEVM_GO_PARAMETER_SET: %v", err)
+		}
+		config = DefaultConfigForParameterSet(p)
+	}
+	config.KeysDir = os.Getenv("FHEVM_GO_KEYS_DIR")
+	if size, found := os.LookupEnv("FHEVM_GO_RESULT_CACHE_BYTES"); found {
+		maxBytes, err := strconv.ParseUint(size, 10, 64)
+		if err != nil {
+			return config, fmt.Errorf("invalid FHEVM_GO_RESULT_CACHE_BYTES: %v", err)
+		}
+		config.Params.MaxResultCacheBytes = maxBytes
+	}
+	addr, found := os.LookupEnv("TFHE_EXECUTOR_CONTRACT_ADDRESS")
+	if !found {
+		return config, fmt.Errorf("TFHE_EXECUTOR_CONTRACT_ADDRESS not found")
+	}
+	if !common.IsHexAddress(addr) {
+		return config, fmt.Errorf("invalid TFHE_EXECUTOR_CONTRACT_ADDRESS: %s", addr)
+	}
+	config.Params.TfheExecutorContractAddress = common.HexToAddress(addr)
+	config.Params.Kms.EndpointAddr = os.Getenv("KMS_ENDPOINT_ADDR")
+	return config, nil
+}
+
+// Loads the keys of the config and returns the parameters to be returned by EVMEnvironment.FhevmParams().
+// Keys are shared by all instances in the process, as ciphertexts refer to the key set they are encrypted under by
+// id. Loading keys that are already loaded is a no-op, so several instances can be initialized with the same config.
+// They share the result cache too, which is created by the first call.
+func (config *Config) Init() (FhevmParams, error) {
+	if config.Params.TfheExecutorContractAddress == (common.Address{}) {
+		return config.Params, fmt.Errorf("TFHEExecutor contract address is not configured")
+	}
+	if config.Params.ResultCache == nil && config.Params.MaxResultCacheBytes != 0 {
+		config.Params.ResultCache = NewResultCache(config.Params.MaxResultCacheBytes)
+	}
+	if config.KeysDir != "" {
+		logger := config.Logger
+		if logger == nil {
+			logger = NewDefaultLogger()
+		}
+		if err := tfhe.InitGlobalKeysFromFiles(config.KeysDir, logger); err != nil {
+			return config.Params, err
+		}
+		if p := tfhe.GetParameterSet(); p != config.ParameterSet {
+			return config.Params, fmt.Errorf("keys in %s have the %s parameter set, config expects %s", config.KeysDir,
+				p, config.ParameterSet)
+		}
+	}
+	return config.Params, nil
+}
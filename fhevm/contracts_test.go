@@ -3,17 +3,21 @@ package fhevm
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
+	"sync"
 	"testing"
 
 	"PureChain/common"
 	"PureChain/core/rawdb"
 	"PureChain/core/state"
+	"PureChain/core/types"
 	"PureChain/core/vm"
 	"PureChain/crypto"
 	"github.com/holiman/uint256"
+	fhevm_crypto "github.com/lukadas12345/rfhevm/fhevm/crypto"
 	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
 )
 
@@ -25,6 +29,9 @@ type MockEVMEnvironment struct {
 	ethCall     bool
 	readOnly    bool
 	fhevmParams FhevmParams
+	blockSeed   common.Hash
+	txHash      common.Hash
+	chainID     *big.Int
 }
 
 func (*MockEVMEnvironment) OtelContext() context.Context {
@@ -40,8 +47,12 @@ func (environment *MockEVMEnvironment) SetState(addr common.Address, key common.
 	environment.stateDb.SetState(addr, key, value)
 }
 
-func (environment *MockEVMEnvironment) GetNonce(common.Address) uint64 {
-	return 0
+func (environment *MockEVMEnvironment) GetNonce(addr common.Address) uint64 {
+	return environment.stateDb.GetNonce(addr)
+}
+
+func (environment *MockEVMEnvironment) SetNonce(addr common.Address, nonce uint64) {
+	environment.stateDb.SetNonce(addr, nonce)
 }
 
 func (environment *MockEVMEnvironment) AddBalance(addr common.Address, amount *big.Int) {
@@ -56,6 +67,14 @@ func (environment *MockEVMEnvironment) Suicide(addr common.Address) bool {
 	return environment.stateDb.Suicide(addr)
 }
 
+func (environment *MockEVMEnvironment) Snapshot() int {
+	return environment.stateDb.Snapshot()
+}
+
+func (environment *MockEVMEnvironment) RevertToSnapshot(snapshot int) {
+	environment.stateDb.RevertToSnapshot(snapshot)
+}
+
 func (environment *MockEVMEnvironment) GetDepth() int {
 	return environment.depth
 }
@@ -64,6 +83,18 @@ func (environment *MockEVMEnvironment) GetLogger() Logger {
 	return NewDefaultLogger()
 }
 
+func (environment *MockEVMEnvironment) GetBlockRandomSeed() common.Hash {
+	return environment.blockSeed
+}
+
+func (environment *MockEVMEnvironment) GetTxHash() common.Hash {
+	return environment.txHash
+}
+
+func (environment *MockEVMEnvironment) GetChainID() *big.Int {
+	return environment.chainID
+}
+
 func (environment *MockEVMEnvironment) IsCommitting() bool {
 	return environment.commit
 }
@@ -77,11 +108,20 @@ func (environment *MockEVMEnvironment) IsReadOnly() bool {
 }
 
 func (environment *MockEVMEnvironment) CreateContract(caller common.Address, code []byte, gas uint64, value *big.Int, address common.Address) ([]byte, common.Address, uint64, error) {
-	return make([]byte, 0), common.Address{}, 0, nil
+	// As the EVM, increment the nonce of the caller before checking for a collision.
+	environment.stateDb.SetNonce(caller, environment.stateDb.GetNonce(caller)+1)
+	if environment.stateDb.GetNonce(address) != 0 || len(environment.stateDb.GetCode(address)) != 0 {
+		return nil, common.Address{}, 0, vm.ErrContractAddressCollision
+	}
+	environment.stateDb.CreateAccount(address)
+	environment.stateDb.SetNonce(address, 1)
+	environment.stateDb.SetCode(address, code)
+	environment.stateDb.AddBalance(address, value)
+	return make([]byte, 0), address, gas, nil
 }
 
 func (environment *MockEVMEnvironment) CreateContract2(caller common.Address, code []byte, codeHash common.Hash, gas uint64, value *big.Int, address common.Address) ([]byte, common.Address, uint64, error) {
-	return make([]byte, 0), common.Address{}, 0, nil
+	return environment.CreateContract(caller, code, gas, value, address)
 }
 
 func (environment *MockEVMEnvironment) FhevmData() *FhevmData {
@@ -96,11 +136,54 @@ func (environment *MockEVMEnvironment) EVMEnvironment() EVMEnvironment {
 	return environment
 }
 
+type MockStack struct {
+	values []uint256.Int
+}
+
+func (s *MockStack) Pop() uint256.Int {
+	v := s.values[len(s.values)-1]
+	s.values = s.values[:len(s.values)-1]
+	return v
+}
+
+func (s *MockStack) Peek() *uint256.Int {
+	return &s.values[len(s.values)-1]
+}
+
+type MockContract struct {
+	address common.Address
+}
+
+func (c *MockContract) Address() common.Address {
+	return c.address
+}
+
+type MockScopeContext struct {
+	stack    *MockStack
+	contract *MockContract
+}
+
+func (s *MockScopeContext) GetMemory() Memory {
+	return nil
+}
+
+func (s *MockScopeContext) GetStack() Stack {
+	return s.stack
+}
+
+func (s *MockScopeContext) GetContract() Contract {
+	return s.contract
+}
+
+var tfheExecutorContractAddress = common.HexToAddress("0x05fD9B5EFE0a996095f42Ed7e77c390810CF660c")
+
 func newTestEVMEnvironment() *MockEVMEnvironment {
 	fhevmData := NewFhevmData()
 	db := rawdb.NewMemoryDatabase()
 	state, _ := state.New(common.Hash{}, state.NewDatabase(db), nil)
-	return &MockEVMEnvironment{fhevmData: &fhevmData, stateDb: state, commit: true, fhevmParams: DefaultFhevmParams()}
+	fhevmParams := DefaultFhevmParams()
+	fhevmParams.TfheExecutorContractAddress = tfheExecutorContractAddress
+	return &MockEVMEnvironment{fhevmData: &fhevmData, stateDb: state, commit: true, fhevmParams: fhevmParams, chainID: big.NewInt(testChainID)}
 }
 
 // generate keys if not present
@@ -194,14 +277,23 @@ func toLibPrecompileInputNoScalar(method string, hashes ...common.Hash) []byte {
 	return ret
 }
 
+// Builds input for a scalar operation where the scalar is the left operand, i.e. `scalar op ciphertext`.
+func toLibPrecompileInputScalarLeft(method string, scalar common.Hash, ct common.Hash) []byte {
+	ret := toLibPrecompileInput(method, true, scalar, ct)
+	ret[4+64+1] = 1
+	return ret
+}
+
 func createInputList(values []big.Int, types []tfhe.FheUintType, listFheUintType tfhe.FheUintType) (handles [][32]byte, ciphertext []byte) {
+	var provenList []byte
 	if listFheUintType == tfhe.FheUint160 {
-		ciphertext, _ = tfhe.EncryptAndSerializeCompact160List(values)
+		provenList, _ = tfhe.EncryptAndProveCompact160List(values, testInputMetadata)
 	} else if listFheUintType == tfhe.FheUint2048 {
-		ciphertext, _ = tfhe.EncryptAndSerializeCompact2048List(values)
+		provenList, _ = tfhe.EncryptAndProveCompact2048List(values, testInputMetadata)
 	} else {
 		panic("unsupported list type")
 	}
+	ciphertext, _ = EncodeInputList(listFheUintType, len(values), provenList)
 	ciphertextHash := crypto.Keccak256Hash(ciphertext).Bytes()
 	handles = make([][32]byte, 0)
 	for i := range types {
@@ -216,13 +308,15 @@ func createInputList(values []big.Int, types []tfhe.FheUintType, listFheUintType
 }
 
 func createInputListWithBadIndex(values []big.Int, types []tfhe.FheUintType, listFheUintType tfhe.FheUintType) (handles [][32]byte, ciphertext []byte) {
+	var provenList []byte
 	if listFheUintType == tfhe.FheUint160 {
-		ciphertext, _ = tfhe.EncryptAndSerializeCompact160List(values)
+		provenList, _ = tfhe.EncryptAndProveCompact160List(values, testInputMetadata)
 	} else if listFheUintType == tfhe.FheUint2048 {
 		panic("")
 	} else {
 		panic("unsupported list type")
 	}
+	ciphertext, _ = EncodeInputList(listFheUintType, len(values), provenList)
 	ciphertextHash := crypto.Keccak256Hash(ciphertext).Bytes()
 	handles = make([][32]byte, 0)
 	for i := range types {
@@ -236,19 +330,54 @@ func createInputListWithBadIndex(values []big.Int, types []tfhe.FheUintType, lis
 	return
 }
 
+func createMixedInputList(values []big.Int, types []tfhe.FheUintType) (handles [][32]byte, ciphertext []byte) {
+	provenList, err := tfhe.EncryptAndProveCompactList(values, types, testInputMetadata)
+	if err != nil {
+		panic(err)
+	}
+	ciphertext, _ = EncodeMixedInputList(types, provenList)
+	ciphertextHash := crypto.Keccak256Hash(ciphertext).Bytes()
+	handles = make([][32]byte, 0)
+	for i := range types {
+		index := byte(i)
+		handle := crypto.Keccak256Hash(append(ciphertextHash, index))
+		handle[29] = index
+		handle[30] = byte(types[i])
+		handle[31] = 0
+		handles = append(handles, handle)
+	}
+	return
+}
+
+const testChainID = 8009
+
+var testInputUserAddress = common.HexToAddress("0x8f2B7c3B1e0D6a4e5c9A2d1F0b3E4c5D6a7B8c9D")
+var testInputContractAddress = common.HexToAddress("0x6819e3aDc291bd7f8c1DcA3C7F0B4F1c3B8f6c6a")
+
+// Input lists created by the test helpers are proven for the test user and the test contract on the test chain.
+var testInputMetadata = InputProofMetadata(big.NewInt(testChainID), testInputContractAddress, testInputUserAddress)
+
+// Packs verifyCiphertext input for the test user and the test contract.
 func packInputList(handle [32]byte, ciphertext []byte, fheUintType tfhe.FheUintType) []byte {
-	input, err := verifyCipertextMethod.Inputs.Pack(handle, [20]byte{}, [20]byte{}, ciphertext, [1]byte{byte(fheUintType)})
+	return packBoundInputList(handle, ciphertext, fheUintType, testInputUserAddress, testInputContractAddress)
+}
+
+func packBoundInputList(handle [32]byte, ciphertext []byte, fheUintType tfhe.FheUintType, user common.Address, contract common.Address) []byte {
+	input, err := verifyCipertextMethod.Inputs.Pack(handle, user, contract, ciphertext, [1]byte{byte(fheUintType)})
 	if err != nil {
 		panic(err)
 	}
 	return input
 }
 
+// Size limit given to DeserializeCompact() when loading test ciphertexts.
+const testMaxCompactCiphertextBytes uint64 = 1024 * 1024
+
 func loadCiphertextInTestMemory(environment EVMEnvironment, value uint64, depth int, t tfhe.FheUintType) *tfhe.TfheCiphertext {
 	// Simulate as if the ciphertext is compact and comes externally.
 	ser := tfhe.EncryptAndSerializeCompact(uint64(value), t)
 	ct := new(tfhe.TfheCiphertext)
-	err := ct.DeserializeCompact(ser, t)
+	err := ct.DeserializeCompact(ser, t, testMaxCompactCiphertextBytes)
 	if err != nil {
 		panic(err)
 	}
@@ -276,10 +405,10 @@ func VerifyCiphertextList(t *testing.T, listFheUintType tfhe.FheUintType, fheUin
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	if len(environment.fhevmData.expandedInputCiphertexts) != 1 {
-		t.Fatalf("expected 1 input list ciphertext, got %d", len(environment.fhevmData.expandedInputCiphertexts))
+	if len(environment.fhevmData.inputListCache.lists) != 1 {
+		t.Fatalf("expected 1 input list ciphertext, got %d", len(environment.fhevmData.inputListCache.lists))
 	}
-	for _, expandedCiphertexts := range environment.fhevmData.expandedInputCiphertexts {
+	for _, expandedCiphertexts := range environment.fhevmData.inputListCache.lists {
 		if len(expandedCiphertexts) != 2 {
 			t.Fatalf("expected 2 expanded ciphertexts, got %d", len(expandedCiphertexts))
 		}
@@ -344,8 +473,8 @@ func TestVerifyCiphertextBadType(t *testing.T) {
 	if err == nil {
 		t.Fatalf("verifyCiphertext must have failed on bad type")
 	}
-	if len(environment.fhevmData.expandedInputCiphertexts) != 0 {
-		t.Fatalf("expected 0 expanded input ciphertexts, got %d", len(environment.fhevmData.expandedInputCiphertexts))
+	if len(environment.fhevmData.inputListCache.lists) != 0 {
+		t.Fatalf("expected 0 expanded input ciphertexts, got %d", len(environment.fhevmData.inputListCache.lists))
 	}
 	if len(environment.fhevmData.loadedCiphertexts) != 0 {
 		t.Fatalf("expected 0 loaded ciphertexts, got %d", len(environment.fhevmData.loadedCiphertexts))
@@ -367,8 +496,8 @@ func TestVerifyCiphertextBadTypeInHandle(t *testing.T) {
 	if err == nil {
 		t.Fatalf("verifyCiphertext must have failed on bad type in handle")
 	}
-	if len(environment.fhevmData.expandedInputCiphertexts) != 0 {
-		t.Fatalf("expected 0 expanded input ciphertexts, got %d", len(environment.fhevmData.expandedInputCiphertexts))
+	if len(environment.fhevmData.inputListCache.lists) != 0 {
+		t.Fatalf("expected 0 expanded input ciphertexts, got %d", len(environment.fhevmData.inputListCache.lists))
 	}
 	if len(environment.fhevmData.loadedCiphertexts) != 0 {
 		t.Fatalf("expected 0 loaded ciphertexts, got %d", len(environment.fhevmData.loadedCiphertexts))
@@ -390,8 +519,8 @@ func TestVerifyCiphertextTypeMismatchInHandle(t *testing.T) {
 	if err == nil {
 		t.Fatalf("verifyCiphertext must have failed on type mismatch in handle")
 	}
-	if len(environment.fhevmData.expandedInputCiphertexts) != 0 {
-		t.Fatalf("expected 0 expanded input ciphertexts, got %d", len(environment.fhevmData.expandedInputCiphertexts))
+	if len(environment.fhevmData.inputListCache.lists) != 0 {
+		t.Fatalf("expected 0 expanded input ciphertexts, got %d", len(environment.fhevmData.inputListCache.lists))
 	}
 	if len(environment.fhevmData.loadedCiphertexts) != 0 {
 		t.Fatalf("expected 0 loaded ciphertexts, got %d", len(environment.fhevmData.loadedCiphertexts))
@@ -413,8 +542,8 @@ func TestVerifyCiphertextBadHashInHandle(t *testing.T) {
 	if err == nil {
 		t.Fatalf("verifyCiphertext must have failed on bad hash in handle")
 	}
-	if len(environment.fhevmData.expandedInputCiphertexts) != 0 {
-		t.Fatalf("expected 0 expanded input ciphertexts, got %d", len(environment.fhevmData.expandedInputCiphertexts))
+	if len(environment.fhevmData.inputListCache.lists) != 0 {
+		t.Fatalf("expected 0 expanded input ciphertexts, got %d", len(environment.fhevmData.inputListCache.lists))
 	}
 	if len(environment.fhevmData.loadedCiphertexts) != 0 {
 		t.Fatalf("expected 0 loaded ciphertexts, got %d", len(environment.fhevmData.loadedCiphertexts))
@@ -434,14 +563,686 @@ func TestVerifyCiphertextIndexOutOfRangeInHandle(t *testing.T) {
 	if err == nil {
 		t.Fatalf("verifyCiphertext must have failed on index out of range in handle")
 	}
-	if len(environment.fhevmData.expandedInputCiphertexts) != 0 {
-		t.Fatalf("expected 0 expanded input ciphertexts, got %d", len(environment.fhevmData.expandedInputCiphertexts))
+	if len(environment.fhevmData.inputListCache.lists) != 0 {
+		t.Fatalf("expected 0 expanded input ciphertexts, got %d", len(environment.fhevmData.inputListCache.lists))
+	}
+	if len(environment.fhevmData.loadedCiphertexts) != 0 {
+		t.Fatalf("expected 0 loaded ciphertexts, got %d", len(environment.fhevmData.loadedCiphertexts))
+	}
+}
+
+func VerifyCiphertextBindingMismatch(t *testing.T, input []byte, chainID *big.Int) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	environment.chainID = chainID
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	_, err := verifyCiphertextRun(environment, addr, addr, input, readOnly, nil)
+	if !errors.Is(err, tfhe.ErrInvalidProof) {
+		t.Fatalf("verifyCiphertext must have failed on an input that is not bound to the user, contract and chain, got %v", err)
+	}
+	if len(environment.fhevmData.loadedCiphertexts) != 0 {
+		t.Fatalf("expected 0 loaded ciphertexts, got %d", len(environment.fhevmData.loadedCiphertexts))
+	}
+}
+
+func TestVerifyCiphertextReplayedByOtherUser(t *testing.T) {
+	handles, ciphertext := createInputList([]big.Int{*big.NewInt(42)}, []tfhe.FheUintType{tfhe.FheUint32}, tfhe.FheUint160)
+	otherUser := common.HexToAddress("0x000000000000000000000000000000000000b0b0")
+	input := packBoundInputList(handles[0], ciphertext, tfhe.FheUint32, otherUser, testInputContractAddress)
+	VerifyCiphertextBindingMismatch(t, input, big.NewInt(testChainID))
+}
+
+func TestVerifyCiphertextReplayedIntoOtherContract(t *testing.T) {
+	handles, ciphertext := createInputList([]big.Int{*big.NewInt(42)}, []tfhe.FheUintType{tfhe.FheUint32}, tfhe.FheUint160)
+	otherContract := common.HexToAddress("0x000000000000000000000000000000000000c0c0")
+	input := packBoundInputList(handles[0], ciphertext, tfhe.FheUint32, testInputUserAddress, otherContract)
+	VerifyCiphertextBindingMismatch(t, input, big.NewInt(testChainID))
+}
+
+func TestVerifyCiphertextReplayedOnOtherChain(t *testing.T) {
+	handles, ciphertext := createInputList([]big.Int{*big.NewInt(42)}, []tfhe.FheUintType{tfhe.FheUint32}, tfhe.FheUint160)
+	input := packInputList(handles[0], ciphertext, tfhe.FheUint32)
+	VerifyCiphertextBindingMismatch(t, input, big.NewInt(testChainID+1))
+}
+
+// A list already expanded for its user in the transaction can't be replayed by another user either.
+func TestVerifyCiphertextReplayedInSameTransaction(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	handles, ciphertext := createInputList([]big.Int{*big.NewInt(42)}, []tfhe.FheUintType{tfhe.FheUint32}, tfhe.FheUint160)
+	if _, err := verifyCiphertextRun(environment, addr, addr, packInputList(handles[0], ciphertext, tfhe.FheUint32), readOnly, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	otherUser := common.HexToAddress("0x000000000000000000000000000000000000b0b0")
+	input := packBoundInputList(handles[0], ciphertext, tfhe.FheUint32, otherUser, testInputContractAddress)
+	gasCosts := environment.FhevmParams().GasCosts
+	if gas := verifyCiphertextRequiredGas(environment, input); gas == gasCosts.FheVerifyCached[tfhe.FheUint32] {
+		t.Fatalf("a list expanded for another user must not be priced as cached")
+	}
+	if _, err := verifyCiphertextRun(environment, addr, addr, input, readOnly, nil); !errors.Is(err, tfhe.ErrInvalidProof) {
+		t.Fatalf("verifyCiphertext must have failed on a list replayed by another user, got %v", err)
+	}
+}
+
+func TestVerifyCiphertextRequiredGas(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	gasCosts := environment.FhevmParams().GasCosts
+	handles, ciphertext := createInputList([]big.Int{*big.NewInt(42), *big.NewInt(43)}, []tfhe.FheUintType{tfhe.FheUint32, tfhe.FheUint32}, tfhe.FheUint160)
+	// The first handle of the list pays for the proof verification of the whole list.
+	input := packInputList(handles[0], ciphertext, tfhe.FheUint32)
+	expected := gasCosts.FheVerify[tfhe.FheUint32] + gasCosts.FheVerifyProofBase + 2*gasCosts.FheVerifyProofPerCiphertext[tfhe.FheUint160]
+	if gas := verifyCiphertextRequiredGas(environment, input); gas != expected {
+		t.Fatalf("verifyCiphertext gas %d != expected %d", gas, expected)
+	}
+	if _, err := verifyCiphertextRun(environment, tfheExecutorContractAddress, tfheExecutorContractAddress, input, false, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	input = packInputList(handles[1], ciphertext, tfhe.FheUint32)
+	expected = gasCosts.FheVerifyCached[tfhe.FheUint32]
+	if gas := verifyCiphertextRequiredGas(environment, input); gas != expected {
+		t.Fatalf("verifyCiphertext gas %d != expected %d for an already expanded list", gas, expected)
+	}
+}
+
+func TestVerifyCiphertextUnprovenList(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	unprovenList, _ := tfhe.EncryptAndSerializeCompact160List([]big.Int{*big.NewInt(42)})
+	ciphertext, _ := EncodeInputList(tfhe.FheUint160, 1, unprovenList)
+	handle := crypto.Keccak256Hash(append(crypto.Keccak256Hash(ciphertext).Bytes(), 0))
+	handle[29] = 0
+	handle[30] = byte(tfhe.FheUint32)
+	handle[31] = 0
+	input := packInputList(handle, ciphertext, tfhe.FheUint32)
+	_, err := verifyCiphertextRun(environment, addr, addr, input, readOnly, nil)
+	if err == nil {
+		t.Fatalf("verifyCiphertext must have failed on a list without a proof of knowledge")
+	}
+	if len(environment.fhevmData.loadedCiphertexts) != 0 {
+		t.Fatalf("expected 0 loaded ciphertexts, got %d", len(environment.fhevmData.loadedCiphertexts))
+	}
+}
+
+func TestVerifyCiphertextHeaderCountMismatch(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	provenList, _ := tfhe.EncryptAndProveCompact160List([]big.Int{*big.NewInt(42)}, testInputMetadata)
+	// The header claims 2 ciphertexts, whereas the list only has 1.
+	ciphertext, _ := EncodeInputList(tfhe.FheUint160, 2, provenList)
+	handle := crypto.Keccak256Hash(append(crypto.Keccak256Hash(ciphertext).Bytes(), 0))
+	handle[29] = 0
+	handle[30] = byte(tfhe.FheUint32)
+	handle[31] = 0
+	input := packInputList(handle, ciphertext, tfhe.FheUint32)
+	_, err := verifyCiphertextRun(environment, addr, addr, input, readOnly, nil)
+	if !errors.Is(err, tfhe.ErrListMismatch) {
+		t.Fatalf("verifyCiphertext must have failed on a header that doesn't match the list, got %v", err)
+	}
+}
+
+func TestVerifyCiphertextUndercountedHeader(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	provenList, _ := tfhe.EncryptAndProveCompact160List([]big.Int{*big.NewInt(42), *big.NewInt(43), *big.NewInt(44)}, testInputMetadata)
+	// The header claims 1 ciphertext, whereas the list has 3, so that only 1 would be paid for.
+	ciphertext, _ := EncodeInputList(tfhe.FheUint160, 1, provenList)
+	handle := crypto.Keccak256Hash(append(crypto.Keccak256Hash(ciphertext).Bytes(), 0))
+	handle[29] = 0
+	handle[30] = byte(tfhe.FheUint4)
+	handle[31] = 0
+	input := packInputList(handle, ciphertext, tfhe.FheUint4)
+	_, err := verifyCiphertextRun(environment, addr, addr, input, readOnly, nil)
+	if !errors.Is(err, tfhe.ErrListMismatch) {
+		t.Fatalf("verifyCiphertext must have failed on an undercounted header, got %v", err)
+	}
+	if len(environment.fhevmData.inputListCache.lists) != 0 {
+		t.Fatalf("expected 0 input lists, got %d", len(environment.fhevmData.inputListCache.lists))
+	}
+}
+
+func TestVerifyCiphertextMixedListUndercountedHeader(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	in2048, _ := new(big.Int).SetString("9f24d93621347ca0832d1a3980750eea1edd3edac274a90128356fb8caa11bd2", 16)
+	provenList, err := tfhe.EncryptAndProveCompactList([]big.Int{*big.NewInt(7), *in2048}, []tfhe.FheUintType{tfhe.FheUint4, tfhe.FheUint2048}, testInputMetadata)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// The header only declares the cheap FheUint4 element, hiding the FheUint2048 one.
+	ciphertext, _ := EncodeMixedInputList([]tfhe.FheUintType{tfhe.FheUint4}, provenList)
+	handle := crypto.Keccak256Hash(append(crypto.Keccak256Hash(ciphertext).Bytes(), 0))
+	handle[29] = 0
+	handle[30] = byte(tfhe.FheUint4)
+	handle[31] = 0
+	input := packInputList(handle, ciphertext, tfhe.FheUint4)
+	_, err = verifyCiphertextRun(environment, addr, addr, input, readOnly, nil)
+	if !errors.Is(err, tfhe.ErrListMismatch) {
+		t.Fatalf("verifyCiphertext must have failed on an undercounted header, got %v", err)
+	}
+}
+
+func TestVerifyCiphertextMixedList(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	in2048, _ := new(big.Int).SetString("9f24d93621347ca0832d1a3980750eea1edd3edac274a90128356fb8caa11bd2", 16)
+	values := []big.Int{*big.NewInt(1), *big.NewInt(9), *big.NewInt(200), *big.NewInt(70000), *in2048}
+	types := []tfhe.FheUintType{tfhe.FheBool, tfhe.FheUint4, tfhe.FheUint8, tfhe.FheUint32, tfhe.FheUint2048}
+	handles, ciphertext := createMixedInputList(values, types)
+	for i, handle := range handles {
+		input := packInputList(handle, ciphertext, types[i])
+		out, err := verifyCiphertextRun(environment, addr, addr, input, readOnly, nil)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !bytes.Equal(out, handle[:]) {
+			t.Fatalf("output from verifyCipertext is not equal to input handle")
+		}
+		ct, _ := loadCiphertext(environment, handle)
+		if ct == nil {
+			t.Fatalf("verifyCiphertext must have verified given ciphertext")
+		}
+		if ct.Type() != types[i] {
+			t.Fatalf("verifyCiphertext returned type %d, expected %d", ct.Type(), types[i])
+		}
+		decrypted, err := ct.Decrypt()
+		if err != nil || decrypted.Cmp(&values[i]) != 0 {
+			t.Fatalf("verifyCiphertext decrypted value %v, expected %v", decrypted, &values[i])
+		}
+	}
+	if len(environment.fhevmData.inputListCache.lists) != 1 {
+		t.Fatalf("expected 1 input list, got %d", len(environment.fhevmData.inputListCache.lists))
+	}
+}
+
+func TestVerifyCiphertextMixedListTypeMismatch(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	_, ciphertext := createMixedInputList([]big.Int{*big.NewInt(7)}, []tfhe.FheUintType{tfhe.FheUint8})
+	// Mixed-type lists are never cast, so the handle must have the exact element type.
+	handle := crypto.Keccak256Hash(append(crypto.Keccak256Hash(ciphertext).Bytes(), 0))
+	handle[29] = 0
+	handle[30] = byte(tfhe.FheUint32)
+	handle[31] = 0
+	input := packInputList(handle, ciphertext, tfhe.FheUint32)
+	_, err := verifyCiphertextRun(environment, addr, addr, input, readOnly, nil)
+	if err == nil {
+		t.Fatalf("verifyCiphertext must have failed on a handle type that differs from the element type")
 	}
 	if len(environment.fhevmData.loadedCiphertexts) != 0 {
 		t.Fatalf("expected 0 loaded ciphertexts, got %d", len(environment.fhevmData.loadedCiphertexts))
 	}
 }
 
+func TestVerifyCiphertextMixedListRequiredGas(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	gasCosts := environment.FhevmParams().GasCosts
+	types := []tfhe.FheUintType{tfhe.FheUint8, tfhe.FheUint2048}
+	handles, ciphertext := createMixedInputList([]big.Int{*big.NewInt(42), *big.NewInt(43)}, types)
+	input := packInputList(handles[0], ciphertext, tfhe.FheUint8)
+	expected := gasCosts.FheVerify[tfhe.FheUint8] + gasCosts.FheVerifyProofBase +
+		gasCosts.FheVerifyProofPerCiphertext[tfhe.FheUint8] + gasCosts.FheVerifyProofPerCiphertext[tfhe.FheUint2048]
+	if gas := verifyCiphertextRequiredGas(environment, input); gas != expected {
+		t.Fatalf("verifyCiphertext gas %d != expected %d", gas, expected)
+	}
+}
+
+func TestVerifyCiphertextGasEstimationDoesNotExpand(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	environment.commit = false
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	gasCosts := environment.FhevmParams().GasCosts
+	handles, ciphertext := createInputList([]big.Int{*big.NewInt(42), *big.NewInt(43)}, []tfhe.FheUintType{tfhe.FheUint32, tfhe.FheUint32}, tfhe.FheUint160)
+	input1 := packInputList(handles[0], ciphertext, tfhe.FheUint32)
+	gas1 := verifyCiphertextRequiredGas(environment, input1)
+	if _, err := verifyCiphertextRun(environment, addr, addr, input1, readOnly, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	input2 := packInputList(handles[1], ciphertext, tfhe.FheUint32)
+	gas2 := verifyCiphertextRequiredGas(environment, input2)
+	if _, err := verifyCiphertextRun(environment, addr, addr, input2, readOnly, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(environment.fhevmData.inputListCache.lists) != 0 {
+		t.Fatalf("expected no expanded input ciphertexts during gas estimation, got %d", len(environment.fhevmData.inputListCache.lists))
+	}
+	expected1 := gasCosts.FheVerify[tfhe.FheUint32] + gasCosts.FheVerifyProofBase + 2*gasCosts.FheVerifyProofPerCiphertext[tfhe.FheUint160]
+	expected2 := gasCosts.FheVerifyCached[tfhe.FheUint32]
+	if gas1 != expected1 || gas2 != expected2 {
+		t.Fatalf("expected only the first handle to pay for the proof, got %d and %d", gas1, gas2)
+	}
+}
+
+func TestInputListCacheEviction(t *testing.T) {
+	cache := inputListCache{}
+	cts := []*tfhe.TfheCiphertext{{Serialization: make([]byte, 10)}}
+	cache.insert(common.Hash{1}, cts, expandedInputListSize(cts), 25)
+	cache.insert(common.Hash{2}, cts, expandedInputListSize(cts), 25)
+	if cache.bytes != 20 || !cache.contains(common.Hash{1}) || !cache.contains(common.Hash{2}) {
+		t.Fatalf("expected both lists to be cached, cached bytes: %d", cache.bytes)
+	}
+	// Inserting a third list evicts the oldest one.
+	cache.insert(common.Hash{3}, cts, expandedInputListSize(cts), 25)
+	if cache.bytes != 20 || cache.contains(common.Hash{1}) || !cache.contains(common.Hash{2}) || !cache.contains(common.Hash{3}) {
+		t.Fatalf("expected the oldest list to be evicted, cached bytes: %d", cache.bytes)
+	}
+	if _, found := cache.get(common.Hash{1}); found {
+		t.Fatalf("expected expanded ciphertexts of the evicted list to be dropped")
+	}
+	// Lists bigger than the cache are not cached.
+	cache.insert(common.Hash{4}, nil, 26, 25)
+	if cache.contains(common.Hash{4}) || cache.bytes != 20 {
+		t.Fatalf("expected a list bigger than the cache not to be cached")
+	}
+	// Estimated lists have no expanded ciphertexts.
+	cache.insert(common.Hash{5}, nil, 5, 25)
+	if !cache.contains(common.Hash{5}) {
+		t.Fatalf("expected an estimated list to be cached")
+	}
+	if _, found := cache.get(common.Hash{5}); found {
+		t.Fatalf("expected no expanded ciphertexts for an estimated list")
+	}
+}
+
+func TestVerifyCiphertextInputListTooLarge(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	handles, ciphertext := createInputList([]big.Int{*big.NewInt(42)}, []tfhe.FheUintType{tfhe.FheUint32}, tfhe.FheUint160)
+	environment.fhevmParams.MaxInputListBytes = uint64(len(ciphertext) - 1)
+	input := packInputList(handles[0], ciphertext, tfhe.FheUint32)
+	if gas := verifyCiphertextRequiredGas(environment, input); gas != 0 {
+		t.Fatalf("expected 0 gas for an input list over the size limit, got %d", gas)
+	}
+	_, err := verifyCiphertextRun(environment, addr, addr, input, readOnly, nil)
+	if !errors.Is(err, tfhe.ErrInvalidInputSize) {
+		t.Fatalf("verifyCiphertext must have failed on an input list over the size limit, got %v", err)
+	}
+	if len(environment.fhevmData.inputListCache.lists) != 0 {
+		t.Fatalf("expected no expanded input list")
+	}
+}
+
+func TestVerifyCiphertextListNotCachedWhenTooBig(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	environment.fhevmParams.MaxInputListCacheBytes = 1
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	handles, ciphertext := createInputList([]big.Int{*big.NewInt(42)}, []tfhe.FheUintType{tfhe.FheUint32}, tfhe.FheUint160)
+	input := packInputList(handles[0], ciphertext, tfhe.FheUint32)
+	if _, err := verifyCiphertextRun(environment, addr, addr, input, readOnly, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(environment.fhevmData.inputListCache.lists) != 0 {
+		t.Fatalf("expected the list not to be cached")
+	}
+	gasCosts := environment.FhevmParams().GasCosts
+	expected := gasCosts.FheVerify[tfhe.FheUint32] + gasCosts.FheVerifyProofBase + gasCosts.FheVerifyProofPerCiphertext[tfhe.FheUint160]
+	if gas := verifyCiphertextRequiredGas(environment, input); gas != expected {
+		t.Fatalf("expected full verification gas %d for a list that is not cached, got %d", expected, gas)
+	}
+}
+
+func TestFhevmDataReset(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	environment.fhevmParams.MaxNativeCiphertextCacheBytes = 256 * 1024 * 1024
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	handles, ciphertext := createInputList([]big.Int{*big.NewInt(42)}, []tfhe.FheUintType{tfhe.FheUint32}, tfhe.FheUint160)
+	input := packInputList(handles[0], ciphertext, tfhe.FheUint32)
+	if _, err := verifyCiphertextRun(environment, addr, addr, input, readOnly, nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if environment.fhevmData.nativeCiphertexts == nil {
+		t.Fatalf("expected native ciphertexts to be cached before reset")
+	}
+	environment.FhevmData().Reset()
+	if len(environment.fhevmData.loadedCiphertexts) != 0 {
+		t.Fatalf("expected no loaded ciphertexts after reset, got %d", len(environment.fhevmData.loadedCiphertexts))
+	}
+	if environment.fhevmData.inputListCache.contains(crypto.Keccak256Hash(ciphertext)) || environment.fhevmData.inputListCache.bytes != 0 {
+		t.Fatalf("expected an empty input list cache after reset")
+	}
+	if environment.fhevmData.nativeCiphertexts != nil {
+		t.Fatalf("expected native ciphertexts to be released after reset")
+	}
+}
+
+func TestFheComputeLimits(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	lhsHash := loadCiphertextInTestMemory(environment, 2, depth, tfhe.FheUint8).GetHash()
+	rhsHash := loadCiphertextInTestMemory(environment, 3, depth, tfhe.FheUint8).GetHash()
+	input := toLibPrecompileInput("fheMul(uint256,uint256,bytes1)", false, lhsHash, rhsHash)
+	gas := environment.fhevmParams.GasCosts.FheMul[tfhe.FheUint8]
+	if requiredGas := FheLibRequiredGas(environment, input); requiredGas != gas {
+		t.Fatalf("expected required gas %d, got %d", gas, requiredGas)
+	}
+	// Multiplications are weighted by their latency.
+	units := gas * environment.fhevmParams.FheComputeUnitsPercent["fheMul"] / 100
+	if units <= gas {
+		t.Fatalf("expected fheMul to consume more compute units than its gas, got %d for %d gas", units, gas)
+	}
+	environment.fhevmParams.MaxFheComputeUnitsPerTx = 2 * units
+	environment.fhevmParams.MaxFheComputeUnitsPerBlock = 3 * units
+	for i := 0; i < 2; i++ {
+		if _, err := FheLibRun(environment, addr, addr, input, readOnly); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if _, err := FheLibRun(environment, addr, addr, input, readOnly); !errors.Is(err, ErrTxFheComputeLimitExceeded) {
+		t.Fatalf("expected the transaction limit to be exceeded, got %v", err)
+	}
+	if environment.FhevmData().TxFheComputeUnits() != 2*units || environment.FhevmData().BlockFheComputeUnits() != 2*units {
+		t.Fatalf("expected %d units consumed, got %d and %d", 2*units,
+			environment.FhevmData().TxFheComputeUnits(), environment.FhevmData().BlockFheComputeUnits())
+	}
+
+	// Compute units of the block survive the transaction boundary.
+	environment.FhevmData().Reset()
+	lhsHash = loadCiphertextInTestMemory(environment, 2, depth, tfhe.FheUint8).GetHash()
+	rhsHash = loadCiphertextInTestMemory(environment, 3, depth, tfhe.FheUint8).GetHash()
+	if _, err := FheLibRun(environment, addr, addr, input, readOnly); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := FheLibRun(environment, addr, addr, input, readOnly); !errors.Is(err, ErrBlockFheComputeLimitExceeded) {
+		t.Fatalf("expected the block limit to be exceeded, got %v", err)
+	}
+	if environment.FhevmData().TxFheComputeUnits() != units || environment.FhevmData().BlockFheComputeUnits() != 3*units {
+		t.Fatalf("unexpected units consumed, got %d and %d",
+			environment.FhevmData().TxFheComputeUnits(), environment.FhevmData().BlockFheComputeUnits())
+	}
+
+	// Methods that don't compute on ciphertexts don't consume compute units.
+	environment.FhevmData().SetBlockFheComputeUnits(3 * units)
+	if _, err := FheLibRun(environment, addr, addr, toLibPrecompileInputNoScalar("fhePubKeyHash()"), readOnly); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestFheComputeUnitsOnlyConsumedOnSuccess(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	lhsHash := loadCiphertextInTestMemory(environment, 2, depth, tfhe.FheUint8).GetHash()
+	// The right operand is not a ciphertext, so the call fails.
+	input := toLibPrecompileInput("fheAdd(uint256,uint256,bytes1)", false, lhsHash, common.Hash{1})
+	FheLibRequiredGas(environment, input)
+	if _, err := FheLibRun(environment, addr, addr, input, readOnly); err == nil {
+		t.Fatalf("expected fheAdd to fail on a non-existent operand")
+	}
+	if environment.FhevmData().TxFheComputeUnits() != 0 || environment.FhevmData().BlockFheComputeUnits() != 0 {
+		t.Fatalf("expected no units consumed by a failed call, got %d and %d",
+			environment.FhevmData().TxFheComputeUnits(), environment.FhevmData().BlockFheComputeUnits())
+	}
+}
+
+func TestFheComputeUnitsReuseRequiredGas(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	lhsHash := loadCiphertextInTestMemory(environment, 2, depth, tfhe.FheUint8).GetHash()
+	rhsHash := loadCiphertextInTestMemory(environment, 3, depth, tfhe.FheUint8).GetHash()
+	input := toLibPrecompileInput("fheAdd(uint256,uint256,bytes1)", false, lhsHash, rhsHash)
+	gas := FheLibRequiredGas(environment, input)
+	// Run derives the units from the gas the EVM computed, even if pricing the call again would give another result.
+	environment.FhevmData().pricedFheLibCall.gas = 2 * gas
+	if _, err := FheLibRun(environment, addr, addr, input, readOnly); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if units := environment.FhevmData().TxFheComputeUnits(); units != 2*gas {
+		t.Fatalf("expected %d units consumed, got %d", 2*gas, units)
+	}
+	if environment.FhevmData().pricedFheLibCall.input != nil {
+		t.Fatalf("expected the priced call to be cleared once run")
+	}
+}
+
+func TestFheComputeUnitsRevert(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	lhsHash := loadCiphertextInTestMemory(environment, 2, depth, tfhe.FheUint8).GetHash()
+	rhsHash := loadCiphertextInTestMemory(environment, 3, depth, tfhe.FheUint8).GetHash()
+	input := toLibPrecompileInput("fheAdd(uint256,uint256,bytes1)", false, lhsHash, rhsHash)
+	environment.FhevmData().SetBlockFheComputeUnits(7)
+	snapshot := environment.FhevmData().FheComputeUnitsSnapshot()
+	if _, err := FheLibRun(environment, addr, addr, input, readOnly); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if environment.FhevmData().TxFheComputeUnits() == 0 {
+		t.Fatalf("expected units consumed by fheAdd")
+	}
+	// The host reverts the call, and the units it consumed with it.
+	environment.FhevmData().RevertFheComputeUnits(snapshot)
+	if environment.FhevmData().TxFheComputeUnits() != 0 || environment.FhevmData().BlockFheComputeUnits() != 7 {
+		t.Fatalf("expected 0 and 7 units after revert, got %d and %d",
+			environment.FhevmData().TxFheComputeUnits(), environment.FhevmData().BlockFheComputeUnits())
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	depth := 1
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	cache := NewResultCache(64 * 1024 * 1024)
+	var outs [][]byte
+	// A second EVM instance computing the same operation is served from the cache.
+	for i := 0; i < 2; i++ {
+		environment := newTestEVMEnvironment()
+		environment.depth = depth
+		environment.fhevmParams.ResultCache = cache
+		lhsHash := loadCiphertextInTestMemory(environment, 20, depth, tfhe.FheUint8).GetHash()
+		rhsHash := loadCiphertextInTestMemory(environment, 22, depth, tfhe.FheUint8).GetHash()
+		out, err := fheAddRun(environment, addr, addr, toPrecompileInput(false, lhsHash, rhsHash), readOnly, nil)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		res, _ := loadCiphertext(environment, common.BytesToHash(out))
+		if res == nil {
+			t.Fatalf("output ciphertext is not found in loadedCiphertexts")
+		}
+		decrypted, err := res.Decrypt()
+		if err != nil || decrypted.Uint64() != 42 {
+			t.Fatalf("invalid decrypted result, decrypted %v != expected 42", decrypted.Uint64())
+		}
+		outs = append(outs, out)
+	}
+	if !bytes.Equal(outs[0], outs[1]) {
+		t.Fatalf("expected the same result handle from the cache")
+	}
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 || stats.Bytes == 0 {
+		t.Fatalf("unexpected result cache stats: %+v", stats)
+	}
+
+	// Scalars and operations are part of the key.
+	ct := new(tfhe.TfheCiphertext).Encrypt(*big.NewInt(1), tfhe.FheUint8)
+	keys := []common.Hash{
+		resultCacheKey("ScalarAdd", big.NewInt(1), ct),
+		resultCacheKey("ScalarAdd", big.NewInt(2), ct),
+		resultCacheKey("ScalarSub", big.NewInt(1), ct),
+		resultCacheKey("ScalarAdd", big.NewInt(0), ct),
+		resultCacheKey("ScalarAdd", nil, ct),
+	}
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			if keys[i] == keys[j] {
+				t.Fatalf("keys %d and %d collide", i, j)
+			}
+		}
+	}
+
+	// A cache with room for a single result evicts the least recently used one.
+	small := NewResultCache(uint64(len(ct.Serialize())))
+	small.insert(keys[0], ct)
+	small.insert(keys[1], ct)
+	if _, found := small.get(keys[0]); found {
+		t.Fatalf("expected the least recently used result to be evicted")
+	}
+	if stats := small.Stats(); stats.Evictions != 1 || stats.Entries != 1 {
+		t.Fatalf("unexpected result cache stats: %+v", stats)
+	}
+}
+
+// Meant to be run with the race detector: EVM instances run FheLib methods on several goroutines, sharing keys and a
+// result cache, while the active key set is looked up and activated again.
+func TestFheLibRunConcurrent(t *testing.T) {
+	const goroutines = 8
+	const iterations = 4
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	cache := NewResultCache(64 * 1024 * 1024)
+	keySetId := tfhe.GetKeySetId()
+	done := make(chan struct{})
+	var keys sync.WaitGroup
+	keys.Add(1)
+	go func() {
+		defer keys.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := tfhe.ActivateKeySet(keySetId); err != nil {
+				t.Errorf("ActivateKeySet failed: %v", err)
+				return
+			}
+			tfhe.GetKeySetIds()
+			tfhe.GetExpandedFheCiphertextSize(tfhe.FheUint8)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				depth := 1
+				environment := newTestEVMEnvironment()
+				environment.depth = depth
+				environment.fhevmParams.ResultCache = cache
+				lhs, rhs := uint64(g%2+1), uint64(i+1)
+				lhsHash := loadCiphertextInTestMemory(environment, lhs, depth, tfhe.FheUint8).GetHash()
+				rhsHash := loadCiphertextInTestMemory(environment, rhs, depth, tfhe.FheUint8).GetHash()
+				input := toLibPrecompileInput("fheAdd(uint256,uint256,bytes1)", false, lhsHash, rhsHash)
+				out, err := FheLibRun(environment, addr, addr, input, readOnly)
+				if err != nil {
+					t.Errorf("fheAdd failed: %v", err)
+					return
+				}
+				sumHash := common.BytesToHash(out)
+				input = toLibPrecompileInput("fheMul(uint256,uint256,bytes1)", true, sumHash, common.BytesToHash([]byte{3}))
+				out, err = FheLibRun(environment, addr, addr, input, readOnly)
+				if err != nil {
+					t.Errorf("fheMul failed: %v", err)
+					return
+				}
+				res, _ := loadCiphertext(environment, common.BytesToHash(out))
+				if res == nil {
+					t.Errorf("output ciphertext is not found in loadedCiphertexts")
+					return
+				}
+				decrypted, err := res.Decrypt()
+				if expected := (lhs + rhs) * 3; err != nil || decrypted.Uint64() != expected {
+					t.Errorf("invalid decrypted result, decrypted %v != expected %v", decrypted.Uint64(), expected)
+				}
+				environment.FhevmData().Release()
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(done)
+	keys.Wait()
+	if stats := cache.Stats(); stats.Hits+stats.Misses != 2*goroutines*iterations {
+		t.Fatalf("expected %d result cache lookups, got %+v", 2*goroutines*iterations, stats)
+	}
+}
+
+func TestParseInputListHeader(t *testing.T) {
+	list := []byte{0xde, 0xad}
+	cases := []struct {
+		header []byte
+		valid  bool
+	}{
+		{[]byte{inputListHeaderV1, byte(tfhe.FheUint160), 25}, true},
+		{[]byte{inputListHeaderV1, byte(tfhe.FheUint2048), 2}, true},
+		{[]byte{inputListHeaderV2 + 1, byte(tfhe.FheUint160), 1}, false},
+		{[]byte{inputListHeaderV1, byte(tfhe.FheUint64), 1}, false},
+		{[]byte{inputListHeaderV1, byte(tfhe.FheUint160), 0}, false},
+		{[]byte{inputListHeaderV1, byte(tfhe.FheUint160), 26}, false},
+		{[]byte{inputListHeaderV1, byte(tfhe.FheUint2048), 3}, false},
+		{[]byte{inputListHeaderV2, 3, byte(tfhe.FheBool), byte(tfhe.FheUint64), byte(tfhe.FheUint2048)}, true},
+		{[]byte{inputListHeaderV2, 0}, false},
+		{[]byte{inputListHeaderV2, 2, byte(tfhe.FheUint8), 42}, false},
+		{[]byte{inputListHeaderV2, 3, byte(tfhe.FheUint2048), byte(tfhe.FheUint2048), byte(tfhe.FheBool)}, false},
+	}
+	for i, c := range cases {
+		header, rest, err := parseInputListHeader(append(c.header, list...))
+		if c.valid {
+			if err != nil {
+				t.Fatalf("case %d: unexpected error %v", i, err)
+			}
+			if header.version != c.header[0] || !bytes.Equal(rest, list) {
+				t.Fatalf("case %d: unexpected header %+v", i, header)
+			}
+			if header.version == inputListHeaderV1 && (header.count() != int(c.header[2]) || header.types[0] != tfhe.FheUintType(c.header[1])) {
+				t.Fatalf("case %d: unexpected header %+v", i, header)
+			}
+			if header.version == inputListHeaderV2 && (header.count() != int(c.header[1]) || header.types[2] != tfhe.FheUint2048) {
+				t.Fatalf("case %d: unexpected header %+v", i, header)
+			}
+		} else if err == nil {
+			t.Fatalf("case %d: expected error", i)
+		}
+	}
+	if _, _, err := parseInputListHeader([]byte{inputListHeaderV1, byte(tfhe.FheUint160), 1}); err == nil {
+		t.Fatalf("expected error on a header without a list")
+	}
+}
+
 func TrivialEncrypt(t *testing.T, fheUintType tfhe.FheUintType) {
 	var value big.Int
 	switch fheUintType {
@@ -1515,6 +2316,50 @@ func FheLibRem(t *testing.T, fheUintType tfhe.FheUintType, scalar bool) {
 	}
 }
 
+func FheLibScalarLeft(t *testing.T, fheUintType tfhe.FheUintType) {
+	cases := []struct {
+		signature string
+		lhs       uint64
+		rhs       uint64
+		expected  uint64
+	}{
+		{"fheSub(uint256,uint256,bytes1)", 7, 3, 4},
+		{"fheDiv(uint256,uint256,bytes1)", 7, 3, 2},
+		{"fheRem(uint256,uint256,bytes1)", 7, 3, 1},
+		{"fheShl(uint256,uint256,bytes1)", 1, 2, 4},
+		{"fheShr(uint256,uint256,bytes1)", 8, 2, 2},
+		{"fheRotl(uint256,uint256,bytes1)", 1, 1, 2},
+		{"fheRotr(uint256,uint256,bytes1)", 2, 1, 1},
+		{"fheLe(uint256,uint256,bytes1)", 7, 3, 0},
+		{"fheLt(uint256,uint256,bytes1)", 3, 7, 1},
+		{"fheGe(uint256,uint256,bytes1)", 3, 7, 0},
+		{"fheGt(uint256,uint256,bytes1)", 7, 3, 1},
+		{"fheAdd(uint256,uint256,bytes1)", 7, 3, 10},
+	}
+	depth := 1
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	for _, c := range cases {
+		environment := newTestEVMEnvironment()
+		environment.depth = depth
+		scalarHash := common.BytesToHash(big.NewInt(int64(c.lhs)).Bytes())
+		rhsHash := loadCiphertextInTestMemory(environment, c.rhs, depth, fheUintType).GetHash()
+		input := toLibPrecompileInputScalarLeft(c.signature, scalarHash, rhsHash)
+		out, err := FheLibRun(environment, addr, addr, input, readOnly)
+		if err != nil {
+			t.Fatalf("%s: %s", c.signature, err.Error())
+		}
+		res, _ := loadCiphertext(environment, common.BytesToHash(out))
+		if res == nil {
+			t.Fatalf("%s: output ciphertext is not found in loadedCiphertexts", c.signature)
+		}
+		decrypted, err := res.Decrypt()
+		if err != nil || decrypted.Uint64() != c.expected {
+			t.Fatalf("%s: invalid decrypted result, decrypted %v != expected %v", c.signature, decrypted.Uint64(), c.expected)
+		}
+	}
+}
+
 func FheLibBitAnd(t *testing.T, fheUintType tfhe.FheUintType, scalar bool) {
 	var lhs, rhs uint64
 	switch fheUintType {
@@ -3865,6 +4710,26 @@ func TestFheLibRandBounded64(t *testing.T) {
 	FheLibRandBounded(t, tfhe.FheUint64, 64)
 }
 
+func TestFheLibRandBoundedNonPowerOf2_4(t *testing.T) {
+	FheLibRandBounded(t, tfhe.FheUint4, 3)
+}
+
+func TestFheLibRandBoundedNonPowerOf2_8(t *testing.T) {
+	FheLibRandBounded(t, tfhe.FheUint8, 6)
+}
+
+func TestFheLibRandBoundedNonPowerOf2_16(t *testing.T) {
+	FheLibRandBounded(t, tfhe.FheUint16, 1000)
+}
+
+func TestFheLibRandBoundedNonPowerOf2_32(t *testing.T) {
+	FheLibRandBounded(t, tfhe.FheUint32, 100003)
+}
+
+func TestFheLibRandBoundedNonPowerOf2_64(t *testing.T) {
+	FheLibRandBounded(t, tfhe.FheUint64, 0xFFFFFFFFFFFFFFFF)
+}
+
 func TestFheLibIfThenElse8(t *testing.T) {
 	FheLibIfThenElse(t, tfhe.FheUint8, 1)
 	FheLibIfThenElse(t, tfhe.FheUint8, 0)
@@ -3885,6 +4750,82 @@ func TestFheLibIfThenElse64(t *testing.T) {
 	FheLibIfThenElse(t, tfhe.FheUint64, 0)
 }
 
+func TestFheLibScalarLeft4(t *testing.T) {
+	FheLibScalarLeft(t, tfhe.FheUint4)
+}
+
+func TestFheLibScalarLeft8(t *testing.T) {
+	FheLibScalarLeft(t, tfhe.FheUint8)
+}
+
+func TestFheLibScalarLeft16(t *testing.T) {
+	FheLibScalarLeft(t, tfhe.FheUint16)
+}
+
+func TestFheLibScalarLeft32(t *testing.T) {
+	FheLibScalarLeft(t, tfhe.FheUint32)
+}
+
+func TestFheLibScalarLeft64(t *testing.T) {
+	FheLibScalarLeft(t, tfhe.FheUint64)
+}
+
+func TestFheScalarLeftRequiredGas(t *testing.T) {
+	depth := 1
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	ctHash := loadCiphertextInTestMemory(environment, 3, depth, tfhe.FheUint8).GetHash()
+	scalarHash := common.BytesToHash(big.NewInt(7).Bytes())
+	gasCosts := environment.FhevmParams().GasCosts
+	scalarRight := toPrecompileInput(true, ctHash, scalarHash)
+	scalarLeft := append(toPrecompileInput(true, scalarHash, ctHash), 1)
+	if gas := fheDivRequiredGas(environment, scalarRight); gas != gasCosts.FheScalarDiv[tfhe.FheUint8] {
+		t.Fatalf("scalar div gas %d != expected %d", gas, gasCosts.FheScalarDiv[tfhe.FheUint8])
+	}
+	if gas := fheDivRequiredGas(environment, scalarLeft); gas != gasCosts.FheDiv[tfhe.FheUint8] {
+		t.Fatalf("scalar-left div gas %d != expected %d", gas, gasCosts.FheDiv[tfhe.FheUint8])
+	}
+	if gas := fheShlRequiredGas(environment, scalarLeft); gas != gasCosts.FheShift[tfhe.FheUint8] {
+		t.Fatalf("scalar-left shl gas %d != expected %d", gas, gasCosts.FheShift[tfhe.FheUint8])
+	}
+	if gas := fheSubRequiredGas(environment, scalarRight); gas != gasCosts.FheAddSub[tfhe.FheUint8] {
+		t.Fatalf("scalar sub gas %d != expected %d", gas, gasCosts.FheAddSub[tfhe.FheUint8])
+	}
+	expected := gasCosts.FheNeg[tfhe.FheUint8] + gasCosts.FheAddSub[tfhe.FheUint8]
+	if gas := fheSubRequiredGas(environment, scalarLeft); gas != expected {
+		t.Fatalf("scalar-left sub gas %d != expected %d", gas, expected)
+	}
+	if gas := fheLeRequiredGas(environment, scalarLeft); gas != gasCosts.FheLe[tfhe.FheUint8] {
+		t.Fatalf("scalar-left le gas %d != expected %d", gas, gasCosts.FheLe[tfhe.FheUint8])
+	}
+}
+
+func TestFheScalarLeftFlagValidation(t *testing.T) {
+	depth := 1
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	ctHash := loadCiphertextInTestMemory(environment, 3, depth, tfhe.FheUint8).GetHash()
+	otherCtHash := loadCiphertextInTestMemory(environment, 7, depth, tfhe.FheUint8).GetHash()
+	scalarHash := common.BytesToHash(big.NewInt(7).Bytes())
+	badFlag := toLibPrecompileInputScalarLeft("fheSub(uint256,uint256,bytes1)", scalarHash, ctHash)
+	badFlag[4+64+1] = 2
+	if _, err := FheLibRun(environment, addr, addr, badFlag, readOnly); err == nil {
+		t.Fatalf("fheSub must have failed on a scalar-left flag that is neither 0 nor 1")
+	}
+	nonScalar := toLibPrecompileInput("fheSub(uint256,uint256,bytes1)", false, otherCtHash, ctHash)
+	nonScalar[4+64+1] = 1
+	if _, err := FheLibRun(environment, addr, addr, nonScalar, readOnly); err == nil {
+		t.Fatalf("fheSub must have failed on a scalar-left flag set on a non-scalar operation")
+	}
+	for _, input := range [][]byte{badFlag[4:], nonScalar[4:]} {
+		if _, err := isScalarOp(input[:66]); err == nil {
+			t.Fatalf("isScalarOp must have failed on scalar-left flag %d with scalar byte %d", input[65], input[64])
+		}
+	}
+}
+
 func TestFheLibTrivialEncrypt8(t *testing.T) {
 	LibTrivialEncrypt(t, tfhe.FheUint8)
 }
@@ -4559,36 +5500,243 @@ func TestFheScalarMax4(t *testing.T) {
 	FheMax(t, tfhe.FheUint4, true)
 }
 
-func TestFheScalarMax8(t *testing.T) {
-	FheMax(t, tfhe.FheUint8, true)
+func TestFheScalarMax8(t *testing.T) {
+	FheMax(t, tfhe.FheUint8, true)
+}
+
+func TestFheScalarMax16(t *testing.T) {
+	FheMax(t, tfhe.FheUint16, true)
+}
+
+func TestFheScalarMax32(t *testing.T) {
+	FheMax(t, tfhe.FheUint32, true)
+}
+
+func TestFheScalarMax64(t *testing.T) {
+	FheMax(t, tfhe.FheUint64, true)
+}
+
+func TestFheRand8(t *testing.T) {
+	FheRand(t, tfhe.FheUint8)
+}
+
+func TestFheRand16(t *testing.T) {
+	FheRand(t, tfhe.FheUint16)
+}
+
+func TestFheRand32(t *testing.T) {
+	FheRand(t, tfhe.FheUint32)
+}
+
+func TestFheRand64(t *testing.T) {
+	FheRand(t, tfhe.FheUint64)
+}
+
+func TestFheRandBool(t *testing.T) {
+	FheRand(t, tfhe.FheBool)
+}
+
+func TestFheRand128(t *testing.T) {
+	FheRand(t, tfhe.FheUint128)
+}
+
+func TestFheRand160(t *testing.T) {
+	FheRand(t, tfhe.FheUint160)
+}
+
+func TestFheRandDeterministic(t *testing.T) {
+	depth := 1
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	environment1 := newTestEVMEnvironment()
+	environment1.depth = depth
+	environment2 := newTestEVMEnvironment()
+	environment2.depth = depth
+	out1, err := fheRandRun(environment1, addr, addr, []byte{byte(tfhe.FheUint8)}, readOnly, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	out2, err := fheRandRun(environment2, addr, addr, []byte{byte(tfhe.FheUint8)}, readOnly, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !bytes.Equal(out1, out2) {
+		t.Fatalf("fheRand expected the same result for the same caller and nonce")
+	}
+	out3, err := fheRandRun(environment1, addr, addr, []byte{byte(tfhe.FheUint8)}, readOnly, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if bytes.Equal(out1, out3) {
+		t.Fatalf("fheRand expected a different result after the nonce is incremented")
+	}
+}
+
+func TestFheRandBlockSeedAndTxHash(t *testing.T) {
+	depth := 1
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	rand := func(blockSeed common.Hash, txHash common.Hash) []byte {
+		environment := newTestEVMEnvironment()
+		environment.depth = depth
+		environment.blockSeed = blockSeed
+		environment.txHash = txHash
+		out, err := fheRandRun(environment, addr, addr, []byte{byte(tfhe.FheUint8)}, readOnly, nil)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return out
+	}
+	out := rand(common.Hash{1}, common.Hash{2})
+	if !bytes.Equal(out, rand(common.Hash{1}, common.Hash{2})) {
+		t.Fatalf("fheRand expected the same result for the same block seed and transaction hash")
+	}
+	if bytes.Equal(out, rand(common.Hash{3}, common.Hash{2})) {
+		t.Fatalf("fheRand expected a different result for a different block seed")
+	}
+	if bytes.Equal(out, rand(common.Hash{1}, common.Hash{3})) {
+		t.Fatalf("fheRand expected a different result for a different transaction hash")
+	}
 }
 
-func TestFheScalarMax16(t *testing.T) {
-	FheMax(t, tfhe.FheUint16, true)
+func TestFheRandGasEstimationIgnoresSeed(t *testing.T) {
+	depth := 1
+	addr := tfheExecutorContractAddress
+	readOnly := false
+	environment := newTestEVMEnvironment()
+	environment.depth = depth
+	environment.commit = false
+	environment.blockSeed = common.Hash{1}
+	input := []byte{byte(tfhe.FheUint8)}
+	gas := fheRandRequiredGas(environment, input)
+	_, err := fheRandRun(environment, addr, addr, input, readOnly, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	environment.blockSeed = common.Hash{2}
+	if fheRandRequiredGas(environment, input) != gas {
+		t.Fatalf("fheRand gas must not depend on the block seed")
+	}
+	protectedStorage := fhevm_crypto.CreateProtectedStorageContractAddress(addr)
+	if environment.GetState(protectedStorage, rngNonceKey) != (common.Hash{}) {
+		t.Fatalf("fheRand must not increment the RNG nonce during gas estimation")
+	}
 }
 
-func TestFheScalarMax32(t *testing.T) {
-	FheMax(t, tfhe.FheUint32, true)
+func TestCreateProtectedStorage(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	caller := common.BytesToAddress([]byte{0x12, 0x34})
+	_, contractAddr, gas, err := Create(environment, caller, []byte{0x00}, 1000, big.NewInt(0))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if gas != 1000 {
+		t.Fatalf("expected all gas to be left over, got %d", gas)
+	}
+	protectedStorage := fhevm_crypto.CreateProtectedStorageContractAddress(contractAddr)
+	if environment.GetNonce(contractAddr) == 0 || environment.GetNonce(protectedStorage) == 0 {
+		t.Fatalf("expected both the contract and its protected storage to be created")
+	}
+	metadata := loadProtectedStorageMetadata(environment, contractAddr)
+	if metadata == nil || metadata.version != protectedStorageVersion || metadata.keySetId != tfhe.GetKeySetId() {
+		t.Fatalf("unexpected protected storage metadata %+v", metadata)
+	}
+	if keySetId, found := ContractKeySetId(environment, contractAddr); !found || keySetId != tfhe.GetKeySetId() {
+		t.Fatalf("unexpected contract key set %08x, found: %v", keySetId, found)
+	}
 }
 
-func TestFheScalarMax64(t *testing.T) {
-	FheMax(t, tfhe.FheUint64, true)
+func TestCreateFailureLeavesNoProtectedStorage(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	caller := common.BytesToAddress([]byte{0x12, 0x34})
+	contractAddr := crypto.CreateAddress(caller, environment.GetNonce(caller))
+	environment.stateDb.SetNonce(contractAddr, 1)
+	if _, _, _, err := Create(environment, caller, []byte{0x00}, 1000, big.NewInt(0)); err != vm.ErrContractAddressCollision {
+		t.Fatalf("expected a contract address collision, got %v", err)
+	}
+	protectedStorage := fhevm_crypto.CreateProtectedStorageContractAddress(contractAddr)
+	if environment.GetNonce(protectedStorage) != 0 || loadProtectedStorageMetadata(environment, contractAddr) != nil {
+		t.Fatalf("expected no protected storage after a failed deployment")
+	}
+	if environment.GetNonce(caller) != 1 {
+		t.Fatalf("expected a failed deployment to increment the caller nonce, got %d", environment.GetNonce(caller))
+	}
 }
 
-func TestFheRand8(t *testing.T) {
-	FheRand(t, tfhe.FheUint8)
+func TestCreateProtectedStorageFailureLeavesNoContract(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	caller := common.BytesToAddress([]byte{0x12, 0x34})
+	contractAddr := crypto.CreateAddress(caller, environment.GetNonce(caller))
+	protectedStorage := fhevm_crypto.CreateProtectedStorageContractAddress(contractAddr)
+	environment.stateDb.SetCode(protectedStorage, []byte{0x00})
+	_, _, gas, err := Create(environment, caller, []byte{0x00}, 1000, big.NewInt(0))
+	if err != vm.ErrContractAddressCollision || gas != 0 {
+		t.Fatalf("expected a protected storage address collision consuming all gas, got %v, gas %d", err, gas)
+	}
+	if environment.GetNonce(contractAddr) != 0 || loadProtectedStorageMetadata(environment, contractAddr) != nil {
+		t.Fatalf("expected no contract after a failed protected storage creation")
+	}
+	if environment.GetNonce(caller) != 1 {
+		t.Fatalf("expected a failed deployment to increment the caller nonce, got %d", environment.GetNonce(caller))
+	}
 }
 
-func TestFheRand16(t *testing.T) {
-	FheRand(t, tfhe.FheUint16)
+func TestCreate2ProtectedStorage(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	caller := common.BytesToAddress([]byte{0x12, 0x34})
+	code := []byte{0x00}
+	salt := uint256.NewInt(42)
+	_, contractAddr, _, err := Create2(environment, caller, code, 1000, big.NewInt(0), salt)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if contractAddr != crypto.CreateAddress2(caller, salt.Bytes32(), crypto.Keccak256(code)) {
+		t.Fatalf("unexpected contract address %s", contractAddr.Hex())
+	}
+	if loadProtectedStorageMetadata(environment, contractAddr) == nil {
+		t.Fatalf("expected protected storage metadata to be stored")
+	}
+	// Creating the same contract again must fail on the contract itself and not on its protected storage.
+	_, _, _, err = Create2(environment, caller, code, 1000, big.NewInt(0), salt)
+	if err != vm.ErrContractAddressCollision {
+		t.Fatalf("expected a contract address collision, got %v", err)
+	}
 }
 
-func TestFheRand32(t *testing.T) {
-	FheRand(t, tfhe.FheUint32)
+func TestOpSelfdestructDestroysProtectedStorage(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	caller := common.BytesToAddress([]byte{0x12, 0x34})
+	_, contractAddr, _, err := Create(environment, caller, []byte{0x00}, 1000, big.NewInt(10))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	protectedStorage := fhevm_crypto.CreateProtectedStorageContractAddress(contractAddr)
+	environment.AddBalance(protectedStorage, big.NewInt(5))
+	beneficiary := common.BytesToAddress([]byte{0x56, 0x78})
+	if gas := SelfdestructProtectedStorageGas(environment, contractAddr, beneficiary); gas != ColdAccountAccessCostEIP2929+SelfdestructGasEIP150 {
+		t.Fatalf("unexpected protected storage selfdestruct gas %d", gas)
+	}
+	scope := &MockScopeContext{stack: &MockStack{values: []uint256.Int{*new(uint256.Int).SetBytes(beneficiary.Bytes())}}, contract: &MockContract{contractAddr}}
+	pc := uint64(0)
+	if _, err := OpSelfdestruct(&pc, environment, scope); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !environment.stateDb.HasSuicided(contractAddr) || !environment.stateDb.HasSuicided(protectedStorage) {
+		t.Fatalf("expected both the contract and its protected storage to be destroyed")
+	}
+	if environment.GetBalance(beneficiary).Cmp(big.NewInt(15)) != 0 {
+		t.Fatalf("expected beneficiary to receive both balances, got %s", environment.GetBalance(beneficiary))
+	}
 }
 
-func TestFheRand64(t *testing.T) {
-	FheRand(t, tfhe.FheUint64)
+func TestOpSelfdestructReadOnly(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	environment.readOnly = true
+	scope := &MockScopeContext{stack: &MockStack{values: []uint256.Int{*uint256.NewInt(1)}}, contract: &MockContract{}}
+	pc := uint64(0)
+	if _, err := OpSelfdestruct(&pc, environment, scope); err != ErrWriteProtection {
+		t.Fatalf("expected write protection error, got %v", err)
+	}
 }
 
 func TestUnknownCiphertextHandle(t *testing.T) {
@@ -4680,9 +5828,8 @@ func FheRandBoundedInvalidBound(t *testing.T, fheUintType tfhe.FheUintType, boun
 
 func TestFheRandBoundedInvalidBound8(t *testing.T) {
 	FheRandBoundedInvalidBound(t, tfhe.FheUint8, uint256.NewInt(0))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint8, uint256.NewInt(3))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint8, uint256.NewInt(98))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint8, uint256.NewInt(0xFF))
+	FheRandBoundedInvalidBound(t, tfhe.FheUint8, uint256.NewInt(0x101))
+	FheRandBoundedInvalidBound(t, tfhe.FheUint8, uint256.NewInt(0x200))
 	moreThan64Bits := uint256.NewInt(0xFFFFFFFFFFFFFFFF)
 	moreThan64Bits.Add(moreThan64Bits, uint256.NewInt(1))
 	FheRandBoundedInvalidBound(t, tfhe.FheUint8, moreThan64Bits)
@@ -4690,9 +5837,8 @@ func TestFheRandBoundedInvalidBound8(t *testing.T) {
 
 func TestFheRandBoundedInvalidBound16(t *testing.T) {
 	FheRandBoundedInvalidBound(t, tfhe.FheUint16, uint256.NewInt(0))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint16, uint256.NewInt(999))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint16, uint256.NewInt(448))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint16, uint256.NewInt(0xFFFF))
+	FheRandBoundedInvalidBound(t, tfhe.FheUint16, uint256.NewInt(0x10001))
+	FheRandBoundedInvalidBound(t, tfhe.FheUint16, uint256.NewInt(0x20000))
 	moreThan64Bits := uint256.NewInt(0xFFFFFFFFFFFFFFFF)
 	moreThan64Bits.Add(moreThan64Bits, uint256.NewInt(1))
 	FheRandBoundedInvalidBound(t, tfhe.FheUint16, moreThan64Bits)
@@ -4700,9 +5846,8 @@ func TestFheRandBoundedInvalidBound16(t *testing.T) {
 
 func TestFheRandBoundedInvalidBound32(t *testing.T) {
 	FheRandBoundedInvalidBound(t, tfhe.FheUint32, uint256.NewInt(0))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint32, uint256.NewInt(111999))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint32, uint256.NewInt(448884))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint32, uint256.NewInt(0xFFFFFFFF))
+	FheRandBoundedInvalidBound(t, tfhe.FheUint32, uint256.NewInt(0x100000001))
+	FheRandBoundedInvalidBound(t, tfhe.FheUint32, uint256.NewInt(0x200000000))
 	moreThan64Bits := uint256.NewInt(0xFFFFFFFFFFFFFFFF)
 	moreThan64Bits.Add(moreThan64Bits, uint256.NewInt(1))
 	FheRandBoundedInvalidBound(t, tfhe.FheUint32, moreThan64Bits)
@@ -4710,14 +5855,40 @@ func TestFheRandBoundedInvalidBound32(t *testing.T) {
 
 func TestFheRandBoundedInvalidBound64(t *testing.T) {
 	FheRandBoundedInvalidBound(t, tfhe.FheUint64, uint256.NewInt(0))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint64, uint256.NewInt(111999))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint64, uint256.NewInt(448884))
-	FheRandBoundedInvalidBound(t, tfhe.FheUint64, uint256.NewInt(0xFFFFFFFFFFFFFFFF))
 	moreThan64Bits := uint256.NewInt(0xFFFFFFFFFFFFFFFF)
-	moreThan64Bits.Add(moreThan64Bits, uint256.NewInt(1))
+	moreThan64Bits.Add(moreThan64Bits, uint256.NewInt(2))
+	FheRandBoundedInvalidBound(t, tfhe.FheUint64, moreThan64Bits)
 	FheRandBoundedInvalidBound(t, tfhe.FheUint32, moreThan64Bits)
 }
 
+func TestFheRandBoundedInvalidBound160(t *testing.T) {
+	moreThan160Bits := new(uint256.Int).Lsh(uint256.NewInt(1), 160)
+	moreThan160Bits.AddUint64(moreThan160Bits, 1)
+	FheRandBoundedInvalidBound(t, tfhe.FheUint160, moreThan160Bits)
+	FheRandBoundedInvalidBound(t, tfhe.FheBool, uint256.NewInt(2))
+}
+
+func TestFheRandBoundedRequiredGas(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	gasCosts := environment.FhevmParams().GasCosts
+	powerOf2 := uint256.NewInt(64).Bytes32()
+	input := append(powerOf2[:], byte(tfhe.FheUint16))
+	if gas := fheRandBoundedRequiredGas(environment, input); gas != gasCosts.FheRand[tfhe.FheUint16] {
+		t.Fatalf("power of 2 bound gas %d != expected %d", gas, gasCosts.FheRand[tfhe.FheUint16])
+	}
+	notPowerOf2 := uint256.NewInt(6).Bytes32()
+	input = append(notPowerOf2[:], byte(tfhe.FheUint16))
+	if gas := fheRandBoundedRequiredGas(environment, input); gas != gasCosts.FheRandBounded[tfhe.FheUint16] {
+		t.Fatalf("non power of 2 bound gas %d != expected %d", gas, gasCosts.FheRandBounded[tfhe.FheUint16])
+	}
+	wide := new(uint256.Int).Lsh(uint256.NewInt(1), 140)
+	wideBound := wide.AddUint64(wide, 1).Bytes32()
+	input = append(wideBound[:], byte(tfhe.FheUint160))
+	if gas := fheRandBoundedRequiredGas(environment, input); gas != gasCosts.FheRandBoundedWide {
+		t.Fatalf("wide bound gas %d != expected %d", gas, gasCosts.FheRandBoundedWide)
+	}
+}
+
 func TestFheRandEthCall(t *testing.T) {
 	depth := 1
 	environment := newTestEVMEnvironment()
@@ -4801,6 +5972,371 @@ func TestFheLibGetCiphertextNonExistentHandle(t *testing.T) {
 	}
 }
 
+// Serializes metadata in the legacy, unversioned layout.
+func serializeLegacyCiphertextMetadata(length uint64, fheUintType tfhe.FheUintType) [32]byte {
+	u := uint256.NewInt(0)
+	u[0] = length
+	u[1] = uint64(fheUintType)
+	return u.Bytes32()
+}
+
+// Persists the given ciphertext the way it was persisted before metadata versioning: uncompressed, with legacy metadata.
+func persistLegacyCiphertext(environment EVMEnvironment, handle common.Hash, ct *tfhe.TfheCiphertext) {
+	length := uint64(tfhe.ExpandedFheCiphertextSize[ct.Type()])
+	environment.SetState(CiphertextStorageAddress, handle, serializeLegacyCiphertextMetadata(length, ct.Type()))
+	ctBytes := make([]byte, length)
+	copy(ctBytes, ct.Serialize())
+	slot := newInt(handle.Bytes())
+	for i := 0; i < len(ctBytes); i += 32 {
+		slot.AddUint64(slot, 1)
+		environment.SetState(CiphertextStorageAddress, slot.Bytes32(), common.BytesToHash(ctBytes[i:minInt(i+32, len(ctBytes))]))
+	}
+}
+
+func TestCiphertextMetadataSerialization(t *testing.T) {
+	m := ciphertextMetadata{
+		version:     ciphertextMetadataVersion,
+		fheUintType: tfhe.FheUint64,
+		compressed:  true,
+		keySetId:    0xdeadbeef,
+		length:      12345,
+		digest:      ciphertextDigest([]byte{1, 2, 3}),
+	}
+	if got := newCiphertextMetadata(m.serialize()); *got != m {
+		t.Fatalf("metadata round trip failed: %+v != %+v", *got, m)
+	}
+	legacy := newCiphertextMetadata(serializeLegacyCiphertextMetadata(12345, tfhe.FheUint64))
+	if legacy.version != legacyCiphertextMetadataVersion || legacy.length != 12345 || legacy.fheUintType != tfhe.FheUint64 {
+		t.Fatalf("unexpected legacy metadata %+v", *legacy)
+	}
+}
+
+func TestPersistCiphertextCompressed(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	ct := new(tfhe.TfheCiphertext).TrivialEncrypt(*big.NewInt(42), tfhe.FheUint64)
+	handle := ct.GetHash()
+	persistCiphertext(environment, handle, ct)
+	metadata := loadCiphertextMetadata(environment, handle)
+	if !metadata.compressed || metadata.length >= uint64(tfhe.ExpandedFheCiphertextSize[tfhe.FheUint64]) {
+		t.Fatalf("expected a compressed ciphertext smaller than the expanded size, got %+v", *metadata)
+	}
+	loaded, gas := loadCiphertext(environment, handle)
+	if loaded == nil || loaded.GetHash() != handle {
+		t.Fatalf("loadCiphertext failed on a compressed ciphertext")
+	}
+	if gas != environment.FhevmParams().GasCosts.FheStorageSloadGas[tfhe.FheUint64] {
+		t.Fatalf("unexpected load gas %d", gas)
+	}
+	decrypted, err := loaded.Decrypt()
+	if err != nil || decrypted.Uint64() != 42 {
+		t.Fatalf("decrypted value %v != 42", decrypted)
+	}
+}
+
+func TestCompressedAndUncompressedCiphertextsCoexist(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	compressed := new(tfhe.TfheCiphertext).TrivialEncrypt(*big.NewInt(1), tfhe.FheUint8)
+	uncompressed := new(tfhe.TfheCiphertext).TrivialEncrypt(*big.NewInt(2), tfhe.FheUint8)
+	persistCiphertext(environment, compressed.GetHash(), compressed)
+	persistLegacyCiphertext(environment, uncompressed.GetHash(), uncompressed)
+	costs := environment.FhevmParams().GasCosts
+	uncompressedWords := (uint64(tfhe.ExpandedFheCiphertextSize[tfhe.FheUint8]) + 31) / 32
+	expectedGas := map[common.Hash]uint64{
+		compressed.GetHash():   costs.FheStorageSloadGas[tfhe.FheUint8],
+		uncompressed.GetHash(): max(uncompressedWords*costs.FheStorageSloadUncompressedWordGas, costs.FheStorageSloadGas[tfhe.FheUint8]),
+	}
+	for handle, expected := range expectedGas {
+		loaded, gas := loadCiphertext(environment, handle)
+		if loaded == nil || loaded.GetHash() != handle {
+			t.Fatalf("loadCiphertext failed on handle %s", handle.Hex())
+		}
+		// Uncompressed ciphertexts are priced by their expanded size.
+		if gas != expected {
+			t.Fatalf("load gas %d != %d on handle %s", gas, expected, handle.Hex())
+		}
+	}
+}
+
+func TestUncompressedCiphertextLoadGasFollowsExpandedSize(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	costs := environment.FhevmParams().GasCosts
+	gasOf := func(fheUintType tfhe.FheUintType) uint64 {
+		metadata := &ciphertextMetadata{fheUintType: fheUintType, length: uint64(tfhe.ExpandedFheCiphertextSize[fheUintType])}
+		return uncompressedCiphertextLoadGas(environment, metadata)
+	}
+	for _, fheUintType := range []tfhe.FheUintType{tfhe.FheBool, tfhe.FheUint8, tfhe.FheUint160, tfhe.FheUint2048} {
+		if gasOf(fheUintType) < costs.FheStorageSloadGas[fheUintType] {
+			t.Fatalf("uncompressed %s load gas %d is less than the compressed one %d", fheUintType, gasOf(fheUintType), costs.FheStorageSloadGas[fheUintType])
+		}
+	}
+	words2048 := (uint64(tfhe.ExpandedFheCiphertextSize[tfhe.FheUint2048]) + 31) / 32
+	if gasOf(tfhe.FheUint2048) != words2048*costs.FheStorageSloadUncompressedWordGas {
+		t.Fatalf("uncompressed FheUint2048 load gas %d is not priced per word of its expanded size", gasOf(tfhe.FheUint2048))
+	}
+}
+
+func TestLoadCiphertextDetectsCorruption(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	ct := new(tfhe.TfheCiphertext).TrivialEncrypt(*big.NewInt(42), tfhe.FheUint32)
+	handle := ct.GetHash()
+	persistCiphertext(environment, handle, ct)
+	metadata := loadCiphertextMetadata(environment, handle)
+	if metadata.version != ciphertextMetadataVersion || metadata.keySetId != tfhe.GetKeySetId() {
+		t.Fatalf("unexpected metadata %+v", *metadata)
+	}
+	// Flip a byte of the ciphertext in storage.
+	slot := newInt(handle.Bytes())
+	slot.AddUint64(slot, 1)
+	part := environment.GetState(CiphertextStorageAddress, slot.Bytes32())
+	part[0] ^= 0xff
+	environment.SetState(CiphertextStorageAddress, slot.Bytes32(), part)
+	if loaded, _ := loadCiphertext(environment, handle); loaded != nil {
+		t.Fatalf("loadCiphertext must have failed on a corrupted ciphertext")
+	}
+}
+
+func TestPrefetchCiphertexts(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	ct := new(tfhe.TfheCiphertext).TrivialEncrypt(*big.NewInt(42), tfhe.FheUint32)
+	handle := ct.GetHash()
+	persistCiphertext(environment, handle, ct)
+	other := new(tfhe.TfheCiphertext).TrivialEncrypt(*big.NewInt(7), tfhe.FheUint8)
+	otherHandle := other.GetHash()
+	persistCiphertext(environment, otherHandle, other)
+	// A contract holds the other handle in its storage.
+	contract := common.HexToAddress("0x1000")
+	slot := common.BytesToHash([]byte{1})
+	environment.SetState(contract, slot, otherHandle)
+	ctSlot := newInt(handle.Bytes())
+	ctSlot.AddUint64(ctSlot, 1)
+
+	accessList := types.AccessList{
+		{Address: CiphertextStorageAddress, StorageKeys: []common.Hash{handle, ctSlot.Bytes32()}},
+		{Address: contract, StorageKeys: []common.Hash{slot, common.BytesToHash([]byte{2})}},
+	}
+	if n := PrefetchCiphertexts(environment, accessList); n != 2 {
+		t.Fatalf("expected 2 prefetched ciphertexts, got %d", n)
+	}
+
+	loaded, gas := loadCiphertext(environment, handle)
+	if loaded == nil || loaded.GetHash() != handle {
+		t.Fatalf("loadCiphertext failed on a prefetched ciphertext")
+	}
+	if gas != environment.FhevmParams().GasCosts.FheStorageSloadGas[tfhe.FheUint32] {
+		t.Fatalf("expected the same load gas for prefetched ciphertexts, got %d", gas)
+	}
+	if decrypted, err := loaded.Decrypt(); err != nil || decrypted.Uint64() != 42 {
+		t.Fatalf("decrypted value %v != 42", decrypted.Uint64())
+	}
+	if _, found := environment.FhevmData().prefetchedCiphertexts[handle]; found {
+		t.Fatalf("expected the prefetched ciphertext to be taken when loaded")
+	}
+
+	// A prefetched ciphertext is not used once its metadata changed in storage.
+	metadata := loadCiphertextMetadata(environment, otherHandle)
+	metadata.keySetId++
+	environment.SetState(CiphertextStorageAddress, otherHandle, metadata.serialize())
+	if loaded, _ := loadCiphertext(environment, otherHandle); loaded != nil {
+		t.Fatalf("loadCiphertext must have failed on a ciphertext from another key set")
+	}
+
+	environment.FhevmData().Reset()
+	if environment.FhevmData().prefetchedCiphertexts != nil {
+		t.Fatalf("expected no prefetched ciphertexts after reset")
+	}
+}
+
+func TestLoadCiphertextKeySetMismatch(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	ct := new(tfhe.TfheCiphertext).TrivialEncrypt(*big.NewInt(42), tfhe.FheUint32)
+	handle := ct.GetHash()
+	persistCiphertext(environment, handle, ct)
+	metadata := loadCiphertextMetadata(environment, handle)
+	metadata.keySetId++
+	environment.SetState(CiphertextStorageAddress, handle, metadata.serialize())
+	if loaded, _ := loadCiphertext(environment, handle); loaded != nil {
+		t.Fatalf("loadCiphertext must have failed on a ciphertext from another key set")
+	}
+}
+
+func TestLoadCiphertextFromRotatedKeySet(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	active := tfhe.GetKeySetId()
+	ks, err := tfhe.GenerateKeySet()
+	if err != nil {
+		t.Fatalf("GenerateKeySet failed: %v", err)
+	}
+	if err := tfhe.ActivateKeySet(ks.Id()); err != nil {
+		t.Fatalf("ActivateKeySet failed: %v", err)
+	}
+	ct := new(tfhe.TfheCiphertext).Encrypt(*big.NewInt(7), tfhe.FheUint16)
+	if err := tfhe.ActivateKeySet(active); err != nil {
+		t.Fatalf("ActivateKeySet failed: %v", err)
+	}
+	handle := ct.GetHash()
+	persistCiphertext(environment, handle, ct)
+	if metadata := loadCiphertextMetadata(environment, handle); metadata.keySetId != ks.Id() {
+		t.Fatalf("metadata key set %08x != %08x", metadata.keySetId, ks.Id())
+	}
+
+	// Ciphertexts from a key set that is loaded, but not active, remain usable.
+	loaded, _ := loadCiphertext(environment, handle)
+	if loaded == nil || loaded.KeySetId != ks.Id() {
+		t.Fatalf("loadCiphertext failed on a ciphertext from a rotated key set")
+	}
+	decrypted, err := loaded.Decrypt()
+	if err != nil || decrypted.Uint64() != 7 {
+		t.Fatalf("decrypted value %v != 7, err: %v", decrypted, err)
+	}
+
+	// Mixing key sets is rejected.
+	other := new(tfhe.TfheCiphertext).Encrypt(*big.NewInt(1), tfhe.FheUint16)
+	if _, err := loaded.Add(other); !errors.Is(err, tfhe.ErrKeySetMismatch) {
+		t.Fatalf("expected ErrKeySetMismatch, got: %v", err)
+	}
+}
+
+func TestMigrateCiphertextsToKeySet(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	ks, err := tfhe.GenerateKeySet()
+	if err != nil {
+		t.Fatalf("GenerateKeySet failed: %v", err)
+	}
+	if _, err := tfhe.GenerateKeySwitchingKey(tfhe.GetKeySetId(), ks.Id()); err != nil {
+		t.Fatalf("GenerateKeySwitchingKey failed: %v", err)
+	}
+	values := []uint64{3, 5, 8}
+	handles := make([]common.Hash, 0, len(values)+1)
+	for _, value := range values {
+		ct := new(tfhe.TfheCiphertext).Encrypt(*big.NewInt(int64(value)), tfhe.FheUint8)
+		persistCiphertext(environment, ct.GetHash(), ct)
+		handles = append(handles, ct.GetHash())
+	}
+	// Handles that don't point to a ciphertext are skipped.
+	handles = append(handles, common.BytesToHash([]byte{1}))
+
+	// Stop after the first two handles, as if the maintenance window ended.
+	progress, err := MigrateCiphertextsToKeySet(environment, handles, ks.Id(), 0, 0, func(p KeySetMigrationProgress) error {
+		if p.Processed == 2 {
+			return ErrKeySetMigrationStopped
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrKeySetMigrationStopped) || progress.Processed != 2 || progress.Migrated != 2 {
+		t.Fatalf("unexpected progress %+v, err: %v", progress, err)
+	}
+	progress, err = MigrateCiphertextsToKeySet(environment, handles, ks.Id(), progress.Processed, 0, nil)
+	if err != nil || progress.Processed != len(handles) || progress.Migrated != 1 || progress.Skipped != 1 {
+		t.Fatalf("unexpected progress %+v, err: %v", progress, err)
+	}
+
+	// Migrated ciphertexts keep their handles and values.
+	for i, value := range values {
+		if metadata := loadCiphertextMetadata(environment, handles[i]); metadata.keySetId != ks.Id() {
+			t.Fatalf("metadata key set %08x != %08x", metadata.keySetId, ks.Id())
+		}
+		loaded, _ := loadCiphertext(environment, handles[i])
+		if loaded == nil || loaded.GetHash() != handles[i] || loaded.KeySetId != ks.Id() {
+			t.Fatalf("loadCiphertext failed on a migrated ciphertext")
+		}
+		decrypted, err := loaded.Decrypt()
+		if err != nil || decrypted.Uint64() != value {
+			t.Fatalf("decrypted value %v != %d, err: %v", decrypted, value, err)
+		}
+	}
+
+	// Restarting from the beginning is a no-op.
+	progress, err = MigrateCiphertextsToKeySet(environment, handles, ks.Id(), 0, 0, nil)
+	if err != nil || progress.Migrated != 0 || progress.Skipped != len(handles) {
+		t.Fatalf("unexpected progress %+v, err: %v", progress, err)
+	}
+}
+
+func TestKeySetMigrationForkBatches(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	ks, err := tfhe.GenerateKeySet()
+	if err != nil {
+		t.Fatalf("GenerateKeySet failed: %v", err)
+	}
+	if _, err := tfhe.GenerateKeySwitchingKey(tfhe.GetKeySetId(), ks.Id()); err != nil {
+		t.Fatalf("GenerateKeySwitchingKey failed: %v", err)
+	}
+	handles := make([]common.Hash, 0, 5)
+	for value := int64(0); value < 5; value++ {
+		ct := new(tfhe.TfheCiphertext).Encrypt(*big.NewInt(value), tfhe.FheUint8)
+		persistCiphertext(environment, ct.GetHash(), ct)
+		handles = append(handles, ct.GetHash())
+	}
+	fork := KeySetMigrationFork{Block: 100, ToKeySetId: ks.Id(), HandlesPerBlock: 2, Handles: handles}
+	if fork.LastBlock() != 102 {
+		t.Fatalf("expected the migration to end at block 102, got %d", fork.LastBlock())
+	}
+
+	// Before the fork, the state is left untouched.
+	if _, err := fork.MigrateBlock(environment, 99, nil); !errors.Is(err, ErrKeySetMigrationBeforeFork) {
+		t.Fatalf("expected ErrKeySetMigrationBeforeFork, got %v", err)
+	}
+	if metadata := loadCiphertextMetadata(environment, handles[0]); metadata.keySetId == ks.Id() {
+		t.Fatalf("ciphertext migrated before the fork block")
+	}
+
+	// Every block migrates its own batch.
+	for i, processed := range []int{2, 4, 5, 5} {
+		block := fork.Block + uint64(i)
+		progress, err := fork.MigrateBlock(environment, block, nil)
+		if err != nil || progress.Processed != processed || progress.Total != len(handles) {
+			t.Fatalf("unexpected progress %+v at block %d, err: %v", progress, block, err)
+		}
+	}
+	for _, handle := range handles {
+		if metadata := loadCiphertextMetadata(environment, handle); metadata.keySetId != ks.Id() {
+			t.Fatalf("metadata key set %08x != %08x", metadata.keySetId, ks.Id())
+		}
+	}
+}
+
+func TestMigrateCiphertextsToKeySetRejectsLegacyMetadata(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	ct := new(tfhe.TfheCiphertext).TrivialEncrypt(*big.NewInt(1), tfhe.FheUint8)
+	persistLegacyCiphertext(environment, ct.GetHash(), ct)
+	progress, err := MigrateCiphertextsToKeySet(environment, []common.Hash{ct.GetHash()}, tfhe.GetKeySetId(), 0, 0, nil)
+	if err == nil || progress.Processed != 0 {
+		t.Fatalf("expected migration to fail, progress %+v", progress)
+	}
+}
+
+func TestMigrateCiphertextMetadata(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	ct := new(tfhe.TfheCiphertext).TrivialEncrypt(*big.NewInt(42), tfhe.FheUint32)
+	handle := ct.GetHash()
+	persistLegacyCiphertext(environment, handle, ct)
+
+	// Legacy ciphertexts are still loadable before migration.
+	if loaded, _ := loadCiphertext(environment, handle); loaded == nil || loaded.GetHash() != handle {
+		t.Fatalf("loadCiphertext failed on a legacy ciphertext")
+	}
+	migrated, err := MigrateCiphertextMetadata(environment, handle)
+	if err != nil || !migrated {
+		t.Fatalf("MigrateCiphertextMetadata failed: migrated=%v err=%v", migrated, err)
+	}
+	metadata := loadCiphertextMetadata(environment, handle)
+	if metadata.version != ciphertextMetadataVersion || metadata.compressed || metadata.keySetId != tfhe.GetKeySetId() {
+		t.Fatalf("unexpected migrated metadata %+v", *metadata)
+	}
+	environment.fhevmData.loadedCiphertexts = make(map[common.Hash]*tfhe.TfheCiphertext)
+	if loaded, _ := loadCiphertext(environment, handle); loaded == nil || loaded.GetHash() != handle {
+		t.Fatalf("loadCiphertext failed on a migrated ciphertext")
+	}
+	migrated, err = MigrateCiphertextMetadata(environment, handle)
+	if err != nil || migrated {
+		t.Fatalf("MigrateCiphertextMetadata must be a no-op on current metadata: migrated=%v err=%v", migrated, err)
+	}
+	migrated, err = MigrateCiphertextMetadata(environment, common.Hash{0x01})
+	if err != nil || migrated {
+		t.Fatalf("MigrateCiphertextMetadata must be a no-op on a non-existent handle: migrated=%v err=%v", migrated, err)
+	}
+}
+
 func FheLibGetCiphertext(t *testing.T, fheUintType tfhe.FheUintType) {
 	environment := newTestEVMEnvironment()
 	addr := tfheExecutorContractAddress
@@ -5050,3 +6586,135 @@ func TesFheArrayEqNoRhs32(t *testing.T) {
 func TestFheArrayEqNoRhs64(t *testing.T) {
 	FheArrayEqNoRhs(t, tfhe.FheUint64)
 }
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("FHEVM_GO_KEYS_DIR", "")
+	t.Setenv("TFHE_EXECUTOR_CONTRACT_ADDRESS", tfheExecutorContractAddress.Hex())
+	t.Setenv("KMS_ENDPOINT_ADDR", "localhost:50051")
+	config, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv failed: %v", err)
+	}
+	params, err := config.Init()
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if params.TfheExecutorContractAddress != tfheExecutorContractAddress || params.Kms.EndpointAddr != "localhost:50051" {
+		t.Fatalf("unexpected params %+v", params)
+	}
+
+	t.Setenv("TFHE_EXECUTOR_CONTRACT_ADDRESS", "not an address")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatalf("ConfigFromEnv must fail on an invalid TFHE_EXECUTOR_CONTRACT_ADDRESS")
+	}
+}
+
+func TestConfigFromEnvParameterSet(t *testing.T) {
+	t.Setenv("TFHE_EXECUTOR_CONTRACT_ADDRESS", tfheExecutorContractAddress.Hex())
+	t.Setenv("FHEVM_GO_PARAMETER_SET", "multi-bit")
+	config, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv failed: %v", err)
+	}
+	if config.ParameterSet != tfhe.ParameterSetMultiBit {
+		t.Fatalf("expected the multi-bit parameter set, got %s", config.ParameterSet)
+	}
+	defaultCosts := DefaultGasCosts()
+	if config.Params.GasCosts.FheMul[tfhe.FheUint32] >= defaultCosts.FheMul[tfhe.FheUint32] {
+		t.Fatalf("multi-bit operations must be cheaper than default ones")
+	}
+	if config.Params.GasCosts.FheStorageSstoreGas[tfhe.FheUint32] != defaultCosts.FheStorageSstoreGas[tfhe.FheUint32] {
+		t.Fatalf("storage costs must not depend on the parameter set")
+	}
+
+	t.Setenv("FHEVM_GO_PARAMETER_SET", "unknown")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatalf("ConfigFromEnv must fail on an unknown FHEVM_GO_PARAMETER_SET")
+	}
+}
+
+func TestCiphertextMetadataParameterSet(t *testing.T) {
+	metadata := ciphertextMetadata{version: ciphertextMetadataVersion, fheUintType: tfhe.FheUint8,
+		parameterSet: tfhe.ParameterSetCompactPk, keySetId: tfhe.GetKeySetId(), length: 64}
+	if deserialized := newCiphertextMetadata(metadata.serialize()); *deserialized != metadata {
+		t.Fatalf("metadata doesn't round trip, got %+v, expected %+v", *deserialized, metadata)
+	}
+	// The active key set has the default parameter set, so the ciphertext can't be under it.
+	ctBytes := make([]byte, metadata.length)
+	metadata.digest = ciphertextDigest(ctBytes)
+	if err := checkCiphertextIntegrity(&metadata, ctBytes); err == nil {
+		t.Fatalf("integrity check must fail for a parameter set other than the key set's")
+	}
+}
+
+func TestConfigInitRequiresExecutorAddress(t *testing.T) {
+	config := DefaultConfig()
+	if _, err := config.Init(); err == nil {
+		t.Fatalf("Init must fail without a TFHEExecutor contract address")
+	}
+}
+
+func TestFheLibRunRejectsOtherCallers(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	environment.fhevmParams.TfheExecutorContractAddress = common.HexToAddress("0x01")
+	input := toLibPrecompileInput("fheAdd(uint256,uint256,bytes1)", false, common.Hash{}, common.Hash{})
+	if _, err := FheLibRun(environment, tfheExecutorContractAddress, tfheExecutorContractAddress, input, false); err == nil {
+		t.Fatalf("FheLibRun must reject callers other than the configured TFHEExecutor contract")
+	}
+}
+
+func TestFheLibKeyInfoMethods(t *testing.T) {
+	environment := newTestEVMEnvironment()
+	// Key info methods are safe to call from any address.
+	caller := common.HexToAddress("0x01")
+	run := func(method string, args ...common.Hash) []byte {
+		out, err := FheLibRun(environment, caller, caller, toLibPrecompileInputNoScalar(method, args...), true)
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		return out
+	}
+	decodeBytes := func(out []byte) []byte {
+		length := new(big.Int).SetBytes(out[32:64]).Uint64()
+		return out[64 : 64+length]
+	}
+
+	if hash := common.BytesToHash(run("fhePubKeyHash()")); hash != tfhe.GetPksHash() {
+		t.Fatalf("fhePubKeyHash returned %s, expected %s", hash.Hex(), tfhe.GetPksHash().Hex())
+	}
+	if id := new(big.Int).SetBytes(run("fheKeySetId()")).Uint64(); id != uint64(tfhe.GetKeySetId()) {
+		t.Fatalf("fheKeySetId returned %08x, expected %08x", id, tfhe.GetKeySetId())
+	}
+	if params := string(decodeBytes(run("fheKeyParameters()"))); params != tfhe.GetParameterSet().ParametersName() {
+		t.Fatalf("fheKeyParameters returned %s, expected %s", params, tfhe.GetParameterSet().ParametersName())
+	}
+
+	// Paging through the key with a fixed chunk length yields the key the hash commits to.
+	size := new(big.Int).SetBytes(run("fhePubKeySize()")).Uint64()
+	chunkLength := common.BigToHash(big.NewInt(MaxFhePubKeyChunkBytes))
+	pksBytes := make([]byte, 0, size)
+	for offset := uint64(0); offset < size; offset += MaxFhePubKeyChunkBytes {
+		chunk := decodeBytes(run("fhePubKeyChunk(uint256,uint256)", common.BigToHash(new(big.Int).SetUint64(offset)), chunkLength))
+		if len(chunk) == 0 {
+			t.Fatalf("fhePubKeyChunk returned an empty chunk at offset %d", offset)
+		}
+		pksBytes = append(pksBytes, chunk...)
+	}
+	if uint64(len(pksBytes)) != size {
+		t.Fatalf("public key chunks have %d bytes, expected %d", len(pksBytes), size)
+	}
+	if crypto.Keccak256Hash(pksBytes) != tfhe.GetPksHash() {
+		t.Fatalf("public key chunks don't hash to the public key hash")
+	}
+
+	tooLong := common.BigToHash(big.NewInt(MaxFhePubKeyChunkBytes + 1))
+	input := toLibPrecompileInputNoScalar("fhePubKeyChunk(uint256,uint256)", common.Hash{}, tooLong)
+	if _, err := FheLibRun(environment, caller, caller, input, true); err == nil {
+		t.Fatalf("fhePubKeyChunk must reject lengths above MaxFhePubKeyChunkBytes")
+	}
+	pastEnd := common.BigToHash(new(big.Int).SetUint64(size + 1))
+	input = toLibPrecompileInputNoScalar("fhePubKeyChunk(uint256,uint256)", pastEnd, chunkLength)
+	if _, err := FheLibRun(environment, caller, caller, input, true); err == nil {
+		t.Fatalf("fhePubKeyChunk must reject offsets past the end of the public key")
+	}
+}
@@ -57,6 +57,7 @@ func insertRandomCiphertext(environment EVMEnvironment, t tfhe.FheUintType) []by
 	handle := common.BytesToHash(ctHashBytes)
 	ct := new(tfhe.TfheCiphertext)
 	ct.FheUintType = t
+	ct.KeySetId = tfhe.GetKeySetId()
 	ct.Hash = &handle
 	insertCiphertextToMemory(environment, handle, ct)
 	temp := nextCtHash.Clone()
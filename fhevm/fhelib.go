@@ -3,6 +3,7 @@ package fhevm
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"math/big"
 
 	"PureChain/common"
@@ -62,7 +63,7 @@ var fhelibMethods = []*FheLibMethod{
 	{
 		name:                "fheSub",
 		argTypes:            "(uint256,uint256,bytes1)",
-		requiredGasFunction: fheAddSubRequiredGas,
+		requiredGasFunction: fheSubRequiredGas,
 		runFunction:         fheSubRun,
 	},
 	{
@@ -221,6 +222,36 @@ var fhelibMethods = []*FheLibMethod{
 		requiredGasFunction: fhePubKeyRequiredGas,
 		runFunction:         fhePubKeyRun,
 	},
+	{
+		name:                "fhePubKeyHash",
+		argTypes:            "()",
+		requiredGasFunction: fheKeyInfoRequiredGas,
+		runFunction:         fhePubKeyHashRun,
+	},
+	{
+		name:                "fhePubKeySize",
+		argTypes:            "()",
+		requiredGasFunction: fheKeyInfoRequiredGas,
+		runFunction:         fhePubKeySizeRun,
+	},
+	{
+		name:                "fhePubKeyChunk",
+		argTypes:            "(uint256,uint256)",
+		requiredGasFunction: fhePubKeyChunkRequiredGas,
+		runFunction:         fhePubKeyChunkRun,
+	},
+	{
+		name:                "fheKeySetId",
+		argTypes:            "()",
+		requiredGasFunction: fheKeyInfoRequiredGas,
+		runFunction:         fheKeySetIdRun,
+	},
+	{
+		name:                "fheKeyParameters",
+		argTypes:            "()",
+		requiredGasFunction: fheKeyInfoRequiredGas,
+		runFunction:         fheKeyParametersRun,
+	},
 	{
 		name:                "trivialEncrypt",
 		argTypes:            "(uint256,bytes1)",
@@ -242,7 +273,8 @@ var fhelibMethods = []*FheLibMethod{
 }
 
 func isSafeFromAnyCaller(method string) bool {
-	if method == "fhePubKey" || method == "getCiphertext" {
+	switch method {
+	case "fhePubKey", "fhePubKeyHash", "fhePubKeySize", "fhePubKeyChunk", "fheKeySetId", "fheKeyParameters", "getCiphertext":
 		return true
 	}
 	return false
@@ -289,8 +321,16 @@ func toEVMBytes(input []byte) []byte {
 	return ret
 }
 
+// Returns the ABI encoding of a single `bytes` or `string` return value.
+func toABIBytesOutput(input []byte) []byte {
+	ret := make([]byte, 32, len(input)+64)
+	ret[31] = 0x20
+	ret = append(ret, toEVMBytes(input)...)
+	return padArrayTo32Multiple(ret)
+}
+
 func load2Ciphertexts(environment EVMEnvironment, input []byte) (lhs *tfhe.TfheCiphertext, rhs *tfhe.TfheCiphertext, loadGas uint64, err error) {
-	if len(input) != 65 {
+	if len(input) != 65 && len(input) != 66 {
 		return nil, nil, 0, errors.New("input needs to contain two 256-bit sized values and 1 8-bit value")
 	}
 	loadGasLhs := uint64(0)
@@ -308,14 +348,30 @@ func load2Ciphertexts(environment EVMEnvironment, input []byte) (lhs *tfhe.TfheC
 	return
 }
 
+// Fails if the scalar-left flag, see isScalarLeftOp(), is neither 0 nor 1, or if it is set on a non-scalar operation.
 func isScalarOp(input []byte) (bool, error) {
-	if len(input) != 65 {
+	if len(input) != 65 && len(input) != 66 {
 		return false, errors.New("input needs to contain two 256-bit sized values and 1 8-bit value")
 	}
 	isScalar := (input[64] == 1)
+	if len(input) == 66 {
+		if input[65] > 1 {
+			return false, fmt.Errorf("invalid scalar-left flag %d", input[65])
+		}
+		if input[65] == 1 && !isScalar {
+			return false, errors.New("scalar-left flag set on a non-scalar operation")
+		}
+	}
 	return isScalar, nil
 }
 
+// A scalar operation can optionally carry a second flag byte, right after the scalar byte, telling that
+// the scalar is the left operand, i.e. `scalar op ciphertext`. In that case, the scalar comes first in the input.
+// The flag is validated by isScalarOp().
+func isScalarLeftOp(input []byte) bool {
+	return len(input) == 66 && input[64] == 1 && input[65] == 1
+}
+
 func load3Ciphertexts(environment EVMEnvironment, input []byte) (first *tfhe.TfheCiphertext, second *tfhe.TfheCiphertext, third *tfhe.TfheCiphertext, loadGas uint64, err error) {
 	if len(input) != 96 {
 		return nil, nil, nil, 0, errors.New("input needs to contain three 256-bit sized values")
@@ -340,15 +396,21 @@ func load3Ciphertexts(environment EVMEnvironment, input []byte) (first *tfhe.Tfh
 	return
 }
 
+// Returns the ciphertext operand as `lhs` and the scalar one as `rhs`, regardless of their position in the input.
+// Callers of non-commutative operations must check isScalarLeftOp() to know the actual order.
 func getScalarOperands(environment EVMEnvironment, input []byte) (lhs *tfhe.TfheCiphertext, rhs *big.Int, loadGas uint64, err error) {
-	if len(input) != 65 {
+	if len(input) != 65 && len(input) != 66 {
 		return nil, nil, 0, errors.New("input needs to contain two 256-bit sized values and 1 8-bit value")
 	}
-	lhs, loadGas = loadCiphertext(environment, common.BytesToHash(input[0:32]))
+	ctBytes, scalarBytes := input[0:32], input[32:64]
+	if isScalarLeftOp(input) {
+		ctBytes, scalarBytes = input[32:64], input[0:32]
+	}
+	lhs, loadGas = loadCiphertext(environment, common.BytesToHash(ctBytes))
 	if lhs == nil {
 		return nil, nil, loadGas, errors.New("failed to load ciphertext")
 	}
 	rhs = &big.Int{}
-	rhs.SetBytes(input[32:64])
+	rhs.SetBytes(scalarBytes)
 	return
 }
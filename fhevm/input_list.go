@@ -0,0 +1,193 @@
+package fhevm
+
+import (
+	"fmt"
+
+	"PureChain/common"
+	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
+)
+
+// Input lists are serialized proven compact lists prefixed with a small header. The header allows knowing the
+// size of a list without deserializing and expanding it, e.g. to compute gas.
+//
+// Header layout, version 1 (all ciphertexts have the list type and are cast to the handle type when verified):
+//   - byte 0: header version, i.e. 1
+//   - byte 1: list type, i.e. FheUint160 or FheUint2048
+//   - byte 2: number of ciphertexts in the list
+//
+// Header layout, version 2 (mixed-type lists, every ciphertext is encrypted at its own type and is never cast):
+//   - byte 0: header version, i.e. 2
+//   - byte 1: number of ciphertexts in the list
+//   - one byte per ciphertext: its type
+//
+// The header is checked against the actual list when the list is expanded.
+const inputListHeaderV1 byte = 1
+const inputListHeaderV2 byte = 2
+const inputListHeaderV1Len = 3
+
+type inputListHeader struct {
+	version byte
+	// Type of each ciphertext in the list. In version 1 lists, all ciphertexts have the list type.
+	types []tfhe.FheUintType
+}
+
+func (h *inputListHeader) count() int {
+	return len(h.types)
+}
+
+// Returns true if ciphertexts from the list are cast to the handle type when verified.
+func (h *inputListHeader) castsToHandleType() bool {
+	return h.version == inputListHeaderV1
+}
+
+func isValidInputListType(t tfhe.FheUintType) bool {
+	return t == tfhe.FheUint160 || t == tfhe.FheUint2048
+}
+
+// Parses the header of the given input list and returns it together with the serialized compact list that follows it.
+func parseInputListHeader(inputList []byte) (*inputListHeader, []byte, error) {
+	if len(inputList) < 2 {
+		return nil, nil, fmt.Errorf("parseInputListHeader input list too short: %d", len(inputList))
+	}
+	header := inputListHeader{version: inputList[0]}
+	var headerLen int
+	switch header.version {
+	case inputListHeaderV1:
+		if len(inputList) < inputListHeaderV1Len {
+			return nil, nil, fmt.Errorf("parseInputListHeader input list too short: %d", len(inputList))
+		}
+		listType := tfhe.FheUintType(inputList[1])
+		if !isValidInputListType(listType) {
+			return nil, nil, fmt.Errorf("parseInputListHeader invalid list type: %d", inputList[1])
+		}
+		header.types = make([]tfhe.FheUintType, inputList[2])
+		for i := range header.types {
+			header.types[i] = listType
+		}
+		headerLen = inputListHeaderV1Len
+	case inputListHeaderV2:
+		count := int(inputList[1])
+		headerLen = 2 + count
+		if len(inputList) < headerLen {
+			return nil, nil, fmt.Errorf("parseInputListHeader input list too short: %d", len(inputList))
+		}
+		header.types = make([]tfhe.FheUintType, count)
+		for i := range header.types {
+			if !tfhe.IsValidFheType(inputList[2+i]) {
+				return nil, nil, fmt.Errorf("parseInputListHeader invalid type at index %d: %d", i, inputList[2+i])
+			}
+			header.types[i] = tfhe.FheUintType(inputList[2+i])
+		}
+	default:
+		return nil, nil, fmt.Errorf("parseInputListHeader unsupported header version: %d", inputList[0])
+	}
+	if header.count() == 0 {
+		return nil, nil, fmt.Errorf("parseInputListHeader empty list")
+	}
+	if len(inputList) == headerLen {
+		return nil, nil, fmt.Errorf("parseInputListHeader no list after the header")
+	}
+	// A single proof can't cover more bits than the CRS supports.
+	bits := uint(0)
+	for _, t := range header.types {
+		bits += t.NumBits()
+	}
+	if bits > tfhe.CrsMaxNumBits {
+		return nil, nil, fmt.Errorf("parseInputListHeader list of %d bits exceeds %d bits", bits, tfhe.CrsMaxNumBits)
+	}
+	return &header, inputList[headerLen:], nil
+}
+
+// Prefixes the given serialized proven compact list with its version 1 header. Meant to be used on the client side.
+func EncodeInputList(listType tfhe.FheUintType, count int, provenList []byte) ([]byte, error) {
+	if !isValidInputListType(listType) {
+		return nil, fmt.Errorf("EncodeInputList invalid list type: %d", listType)
+	}
+	if count <= 0 || count > 255 {
+		return nil, fmt.Errorf("EncodeInputList invalid count: %d", count)
+	}
+	inputList := make([]byte, 0, inputListHeaderV1Len+len(provenList))
+	inputList = append(inputList, inputListHeaderV1, byte(listType), byte(count))
+	return append(inputList, provenList...), nil
+}
+
+// Prefixes the given serialized proven mixed-type compact list, as returned by tfhe.EncryptAndProveCompactList(), with
+// its version 2 header. `types` are the types the list was encrypted with. Meant to be used on the client side.
+func EncodeMixedInputList(types []tfhe.FheUintType, provenList []byte) ([]byte, error) {
+	if len(types) == 0 || len(types) > 255 {
+		return nil, fmt.Errorf("EncodeMixedInputList invalid count: %d", len(types))
+	}
+	inputList := make([]byte, 0, 2+len(types)+len(provenList))
+	inputList = append(inputList, inputListHeaderV2, byte(len(types)))
+	for _, t := range types {
+		if !tfhe.IsValidFheType(byte(t)) {
+			return nil, fmt.Errorf("EncodeMixedInputList invalid type: %d", t)
+		}
+		inputList = append(inputList, byte(t))
+	}
+	return append(inputList, provenList...), nil
+}
+
+// A bounded cache of expanded input lists, keyed by the hash of the input list and of the metadata its proof is
+// verified against, see verifyCiphertextInput.cacheKey. It only lives for the duration of a transaction. A list being
+// in the cache means its proof has been verified for that metadata in the current transaction, so subsequent handles
+// from that list are cheaper. Therefore, eviction must be deterministic: oldest lists are evicted first.
+type inputListCache struct {
+	// Expanded ciphertexts by key.
+	lists map[common.Hash][]*tfhe.TfheCiphertext
+	// Size of the expanded ciphertexts by key, in bytes. During gas estimation, lists are not expanded
+	// and only their size is recorded here.
+	sizes map[common.Hash]uint64
+	// Keys in insertion order.
+	order []common.Hash
+	// Total size of the cached lists, in bytes.
+	bytes uint64
+}
+
+func (c *inputListCache) contains(key common.Hash) bool {
+	_, found := c.sizes[key]
+	return found
+}
+
+func (c *inputListCache) get(key common.Hash) ([]*tfhe.TfheCiphertext, bool) {
+	cts, found := c.lists[key]
+	return cts, found
+}
+
+// Inserts a list of the given size, evicting the oldest lists such that the cache doesn't exceed `maxBytes`. Lists
+// bigger than `maxBytes` are not cached. `cts` is nil during gas estimation.
+func (c *inputListCache) insert(key common.Hash, cts []*tfhe.TfheCiphertext, size uint64, maxBytes uint64) {
+	if c.contains(key) || size > maxBytes {
+		return
+	}
+	if c.sizes == nil {
+		c.sizes = make(map[common.Hash]uint64)
+		c.lists = make(map[common.Hash][]*tfhe.TfheCiphertext)
+	}
+	for c.bytes+size > maxBytes {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		c.bytes -= c.sizes[oldest]
+		delete(c.sizes, oldest)
+		delete(c.lists, oldest)
+	}
+	c.sizes[key] = size
+	if cts != nil {
+		c.lists[key] = cts
+	}
+	c.order = append(c.order, key)
+	c.bytes += size
+}
+
+func (c *inputListCache) reset() {
+	*c = inputListCache{}
+}
+
+// Returns the size of the given expanded list, in bytes.
+func expandedInputListSize(cts []*tfhe.TfheCiphertext) uint64 {
+	size := uint64(0)
+	for _, ct := range cts {
+		size += uint64(len(ct.Serialize()))
+	}
+	return size
+}
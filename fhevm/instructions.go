@@ -1,7 +1,10 @@
 package fhevm
 
 import (
+	"math/big"
+
 	"PureChain/common"
+	fhevm_crypto "github.com/lukadas12345/rfhevm/fhevm/crypto"
 	"go.opentelemetry.io/otel"
 )
 
@@ -22,10 +25,32 @@ func OpSstore(pc *uint64, env EVMEnvironment, scope ScopeContext) ([]byte, error
 	if newValHash != oldValHash && env.IsCommitting() {
 		ct := GetCiphertextFromMemory(env, newValHash)
 		if ct != nil {
-			persistCiphertext(env, newValHash, ct)
+			if err := persistCiphertext(env, newValHash, ct); err != nil {
+				return nil, err
+			}
 		}
 	}
 	// Set the SSTORE's value in the actual contract.
 	env.SetState(scope.GetContract().Address(), loc.Bytes32(), newValHash)
 	return nil, nil
 }
+
+// Self-destructs the current contract together with its protected storage. Balances of both go to the beneficiary.
+// The host is expected to stop execution after this function returns without an error.
+func OpSelfdestruct(pc *uint64, env EVMEnvironment, scope ScopeContext) ([]byte, error) {
+	if otelCtx := env.OtelContext(); otelCtx != nil {
+		_, span := otel.Tracer("fhevm").Start(otelCtx, "OpSelfdestruct")
+		defer span.End()
+	}
+	if env.IsReadOnly() {
+		return nil, ErrWriteProtection
+	}
+	beneficiary := scope.GetStack().Pop()
+	contractAddr := scope.GetContract().Address()
+	protectedStorage := fhevm_crypto.CreateProtectedStorageContractAddress(contractAddr)
+	balance := new(big.Int).Add(env.GetBalance(contractAddr), env.GetBalance(protectedStorage))
+	env.AddBalance(beneficiary.Bytes20(), balance)
+	env.Suicide(contractAddr)
+	env.Suicide(protectedStorage)
+	return nil, nil
+}
@@ -14,17 +14,32 @@ type EVMEnvironment interface {
 	GetState(common.Address, common.Hash) common.Hash
 	SetState(common.Address, common.Hash, common.Hash)
 	GetNonce(common.Address) uint64
+	SetNonce(common.Address, uint64)
 	AddBalance(common.Address, *big.Int)
 	GetBalance(common.Address) *big.Int
 
 	Suicide(common.Address) bool
 
+	// Takes a snapshot of the state and reverts to it, e.g. with StateDB.Snapshot() and StateDB.RevertToSnapshot().
+	Snapshot() int
+	RevertToSnapshot(int)
+
 	// EVM call stack depth
 	GetDepth() int
 
 	// EVM Logger
 	GetLogger() Logger
 
+	// Randomness related functions
+	// Returns the per-block randomness seed supplied by the node, e.g. a VRF output or the RANDAO value of the block.
+	// It must be the same on all nodes executing the block.
+	GetBlockRandomSeed() common.Hash
+	// Returns the hash of the transaction currently being executed.
+	GetTxHash() common.Hash
+
+	// Returns the chain id, used to bind inputs to the chain they are meant for.
+	GetChainID() *big.Int
+
 	// TODO: clarify meaning of the following
 	IsCommitting() bool
 	IsEthCall() bool
@@ -43,12 +58,28 @@ type EVMEnvironment interface {
 	OtelContext() context.Context
 }
 
+// Per-transaction state of an EVM instance. Unlike keys and the result cache, it is not safe for concurrent use, so
+// EVM instances executing concurrently, e.g. block execution, eth_calls and gas estimation, must each have their own.
 type FhevmData struct {
 	// A map from a ciphertext hash to the ciphertext itself.
 	loadedCiphertexts map[common.Hash]*tfhe.TfheCiphertext
 
-	// A map from the hash of the ciphertext list to an array of expanded ciphertexts.
-	expandedInputCiphertexts map[common.Hash][]*tfhe.TfheCiphertext
+	// A bounded cache from the hash of the input list to an array of expanded ciphertexts.
+	inputListCache inputListCache
+
+	// Deserialized ciphertexts kept alive across operations, created on first use.
+	nativeCiphertexts *tfhe.NativeCiphertextCache
+
+	// Persisted ciphertexts loaded ahead of execution, by handle, see PrefetchCiphertexts().
+	prefetchedCiphertexts map[common.Hash]prefetchedCiphertext
+
+	// FHE compute units consumed by the current transaction and by the current block, see consumeFheComputeUnits().
+	// The block one is not cleared by Reset().
+	txFheComputeUnits    uint64
+	blockFheComputeUnits uint64
+
+	// The last FheLib call priced by the EVM, see fheLibCallGas().
+	pricedFheLibCall pricedFheLibCall
 
 	nextCiphertextHashOnGasEst uint256.Int
 }
@@ -58,3 +89,36 @@ func NewFhevmData() FhevmData {
 		loadedCiphertexts: make(map[common.Hash]*tfhe.TfheCiphertext),
 	}
 }
+
+// Clears all per-transaction state. Hosts that reuse the same FhevmData for multiple transactions must call it at
+// every transaction boundary.
+func (data *FhevmData) Reset() {
+	data.loadedCiphertexts = make(map[common.Hash]*tfhe.TfheCiphertext)
+	data.inputListCache.reset()
+	data.prefetchedCiphertexts = nil
+	data.txFheComputeUnits = 0
+	data.pricedFheLibCall = pricedFheLibCall{}
+	data.Release()
+	data.nextCiphertextHashOnGasEst.Clear()
+}
+
+// Destroys the native ciphertexts kept alive during the transaction. Hosts that create a new FhevmData for every
+// transaction must call it once the transaction is done, as native ciphertexts are not garbage collected. Reset()
+// calls it too.
+func (data *FhevmData) Release() {
+	data.nativeCiphertexts.Release()
+	data.nativeCiphertexts = nil
+}
+
+// Makes `ct` keep its native ciphertext alive across operations, unless the cache is disabled.
+func attachNativeCiphertext(env EVMEnvironment, ct *tfhe.TfheCiphertext) {
+	data := env.FhevmData()
+	if data.nativeCiphertexts == nil {
+		maxBytes := env.FhevmParams().MaxNativeCiphertextCacheBytes
+		if maxBytes == 0 {
+			return
+		}
+		data.nativeCiphertexts = tfhe.NewNativeCiphertextCache(maxBytes)
+	}
+	data.nativeCiphertexts.Attach(ct)
+}
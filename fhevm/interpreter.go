@@ -58,7 +58,7 @@ func (vc *verifiedCiphertext) fheUintType() tfhe.FheUintType {
 
 // Returns the serialization of the verified ciphertext
 func (vc *verifiedCiphertext) serialization() []byte {
-	return vc.ciphertext.Serialization
+	return vc.ciphertext.Serialize()
 }
 
 // Returns the hash of the verified ciphertext
@@ -5,11 +5,12 @@ import (
 	"errors"
 
 	"PureChain/common"
+	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
 	"go.opentelemetry.io/otel/trace"
 )
 
 func fheAddRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -37,7 +38,9 @@ func fheAddRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.Add(rhs)
+		result, err := memoizeResult(environment, "Add", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Add(rhs)
+		})
 		if err != nil {
 			logger.Error("fheAdd failed", "err", err)
 			return nil, err
@@ -61,7 +64,9 @@ func fheAddRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarAdd(rhs)
+		result, err := memoizeResult(environment, "ScalarAdd", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.ScalarAdd(rhs)
+		})
 		if err != nil {
 			logger.Error("fheAdd failed", "err", err)
 			return nil, err
@@ -75,7 +80,7 @@ func fheAddRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 }
 
 func fheSubRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -103,7 +108,9 @@ func fheSubRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.Sub(rhs)
+		result, err := memoizeResult(environment, "Sub", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Sub(rhs)
+		})
 		if err != nil {
 			logger.Error("fheSub failed", "err", err)
 			return nil, err
@@ -120,14 +127,23 @@ func fheSubRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			logger.Error("fheSub scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarSub(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftSub", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftSub(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarSub", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarSub(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheSub failed", "err", err)
 			return nil, err
@@ -135,13 +151,13 @@ func fheSubRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheSub scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheSub scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
 
 func fheMulRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -169,7 +185,9 @@ func fheMulRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.Mul(rhs)
+		result, err := memoizeResult(environment, "Mul", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Mul(rhs)
+		})
 		if err != nil {
 			logger.Error("fheMul failed", "err", err)
 			return nil, err
@@ -193,7 +211,9 @@ func fheMulRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarMul(rhs)
+		result, err := memoizeResult(environment, "ScalarMul", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.ScalarMul(rhs)
+		})
 		if err != nil {
 			logger.Error("fheMul failed", "err", err)
 			return nil, err
@@ -207,7 +227,7 @@ func fheMulRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 }
 
 func fheDivRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -227,14 +247,23 @@ func fheDivRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			logger.Error("fheDiv scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarDiv(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftDiv", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftDiv(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarDiv", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarDiv(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheDiv failed", "err", err)
 			return nil, err
@@ -242,13 +271,13 @@ func fheDivRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheDiv scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheDiv scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
 
 func fheRemRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -268,14 +297,23 @@ func fheRemRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			logger.Error("fheRem scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarRem(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftRem", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftRem(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarRem", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarRem(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheRem failed", "err", err)
 			return nil, err
@@ -283,7 +321,7 @@ func fheRemRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheRem scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheRem scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
@@ -7,7 +7,7 @@ import (
 )
 
 func fheAddSubRequiredGas(environment EVMEnvironment, input []byte) uint64 {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 	isScalar, err := isScalarOp(input)
@@ -38,8 +38,24 @@ func fheAddSubRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 	return environment.FhevmParams().GasCosts.FheAddSub[lhs.Type()] + loadGas
 }
 
+func fheSubRequiredGas(environment EVMEnvironment, input []byte) uint64 {
+	input = input[:minInt(66, len(input))]
+
+	gas := fheAddSubRequiredGas(environment, input)
+	if isScalar, err := isScalarOp(input); err != nil || !isScalar || !isScalarLeftOp(input) {
+		return gas
+	}
+	// A scalar on the left is subtracted by negating the ciphertext and adding the scalar to it. The ciphertext is in
+	// memory by now, so it is not paid for twice.
+	lhs, _, _, err := getScalarOperands(environment, input)
+	if err != nil {
+		return gas
+	}
+	return gas + environment.FhevmParams().GasCosts.FheNeg[lhs.Type()]
+}
+
 func fheMulRequiredGas(environment EVMEnvironment, input []byte) uint64 {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 	isScalar, err := isScalarOp(input)
@@ -69,7 +85,7 @@ func fheMulRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 }
 
 func fheDivRequiredGas(environment EVMEnvironment, input []byte) uint64 {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 	isScalar, err := isScalarOp(input)
@@ -87,12 +103,15 @@ func fheDivRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 			logger.Error("fheDiv RequiredGas() scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return loadGas
 		}
+		if isScalarLeftOp(input) {
+			return environment.FhevmParams().GasCosts.FheDiv[lhs.Type()] + loadGas
+		}
 		return environment.FhevmParams().GasCosts.FheScalarDiv[lhs.Type()] + loadGas
 	}
 }
 
 func fheRemRequiredGas(environment EVMEnvironment, input []byte) uint64 {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 	isScalar, err := isScalarOp(input)
@@ -109,6 +128,9 @@ func fheRemRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 			logger.Error("fheRem RequiredGas() scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return loadGas
 		}
+		if isScalarLeftOp(input) {
+			return environment.FhevmParams().GasCosts.FheRem[lhs.Type()] + loadGas
+		}
 		return environment.FhevmParams().GasCosts.FheScalarRem[lhs.Type()] + loadGas
 	}
 }
@@ -5,11 +5,12 @@ import (
 	"errors"
 
 	"PureChain/common"
+	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
 	"go.opentelemetry.io/otel/trace"
 )
 
 func fheShlRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -37,7 +38,9 @@ func fheShlRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.Shl(rhs)
+		result, err := memoizeResult(environment, "Shl", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Shl(rhs)
+		})
 		if err != nil {
 			logger.Error("fheShl failed", "err", err)
 			return nil, err
@@ -54,14 +57,23 @@ func fheShlRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			logger.Error("fheShl scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarShl(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftShl", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftShl(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarShl", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarShl(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheShl failed", "err", err)
 			return nil, err
@@ -69,13 +81,13 @@ func fheShlRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheShl scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheShl scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
 
 func fheShrRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -103,7 +115,9 @@ func fheShrRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.Shr(rhs)
+		result, err := memoizeResult(environment, "Shr", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Shr(rhs)
+		})
 		if err != nil {
 			logger.Error("fheShr failed", "err", err)
 			return nil, err
@@ -120,14 +134,23 @@ func fheShrRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			logger.Error("fheShr scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarShr(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftShr", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftShr(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarShr", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarShr(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheShr failed", "err", err)
 			return nil, err
@@ -135,13 +158,13 @@ func fheShrRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheShr scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheShr scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
 
 func fheRotlRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -169,7 +192,9 @@ func fheRotlRun(environment EVMEnvironment, caller common.Address, addr common.A
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.Rotl(rhs)
+		result, err := memoizeResult(environment, "Rotl", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Rotl(rhs)
+		})
 		if err != nil {
 			logger.Error("fheRotl failed", "err", err)
 			return nil, err
@@ -186,14 +211,23 @@ func fheRotlRun(environment EVMEnvironment, caller common.Address, addr common.A
 			logger.Error("fheRotl scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarRotl(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftRotl", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftRotl(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarRotl", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarRotl(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheRotl failed", "err", err)
 			return nil, err
@@ -201,13 +235,13 @@ func fheRotlRun(environment EVMEnvironment, caller common.Address, addr common.A
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheRotl scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheRotl scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
 
 func fheRotrRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -235,7 +269,9 @@ func fheRotrRun(environment EVMEnvironment, caller common.Address, addr common.A
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.Rotr(rhs)
+		result, err := memoizeResult(environment, "Rotr", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Rotr(rhs)
+		})
 		if err != nil {
 			logger.Error("fheRotr failed", "err", err)
 			return nil, err
@@ -252,14 +288,23 @@ func fheRotrRun(environment EVMEnvironment, caller common.Address, addr common.A
 			logger.Error("fheRotr scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarRotr(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftRotr", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftRotr(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarRotr", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarRotr(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheRotr failed", "err", err)
 			return nil, err
@@ -267,7 +312,7 @@ func fheRotrRun(environment EVMEnvironment, caller common.Address, addr common.A
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheRotr scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheRotr scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
@@ -297,7 +342,9 @@ func fheNegRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 		return insertRandomCiphertext(environment, ct.Type()), nil
 	}
 
-	result, err := ct.Neg()
+	result, err := memoizeResult(environment, "Neg", nil, []*tfhe.TfheCiphertext{ct}, func() (*tfhe.TfheCiphertext, error) {
+		return ct.Neg()
+	})
 	if err != nil {
 		logger.Error("fheNeg failed", "err", err)
 		return nil, err
@@ -334,7 +381,9 @@ func fheNotRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 		return insertRandomCiphertext(environment, ct.Type()), nil
 	}
 
-	result, err := ct.Not()
+	result, err := memoizeResult(environment, "Not", nil, []*tfhe.TfheCiphertext{ct}, func() (*tfhe.TfheCiphertext, error) {
+		return ct.Not()
+	})
 	if err != nil {
 		logger.Error("fheNot failed", "err", err)
 		return nil, err
@@ -347,7 +396,7 @@ func fheNotRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 }
 
 func fheBitAndRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -381,7 +430,9 @@ func fheBitAndRun(environment EVMEnvironment, caller common.Address, addr common
 		return insertRandomCiphertext(environment, lhs.Type()), nil
 	}
 
-	result, err := lhs.Bitand(rhs)
+	result, err := memoizeResult(environment, "Bitand", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+		return lhs.Bitand(rhs)
+	})
 	if err != nil {
 		logger.Error("fheBitAnd failed", "err", err)
 		return nil, err
@@ -394,7 +445,7 @@ func fheBitAndRun(environment EVMEnvironment, caller common.Address, addr common
 }
 
 func fheBitOrRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -428,7 +479,9 @@ func fheBitOrRun(environment EVMEnvironment, caller common.Address, addr common.
 		return insertRandomCiphertext(environment, lhs.Type()), nil
 	}
 
-	result, err := lhs.Bitor(rhs)
+	result, err := memoizeResult(environment, "Bitor", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+		return lhs.Bitor(rhs)
+	})
 	if err != nil {
 		logger.Error("fheBitOr failed", "err", err)
 		return nil, err
@@ -441,7 +494,7 @@ func fheBitOrRun(environment EVMEnvironment, caller common.Address, addr common.
 }
 
 func fheBitXorRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -475,7 +528,9 @@ func fheBitXorRun(environment EVMEnvironment, caller common.Address, addr common
 		return insertRandomCiphertext(environment, lhs.Type()), nil
 	}
 
-	result, err := lhs.Bitxor(rhs)
+	result, err := memoizeResult(environment, "Bitxor", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+		return lhs.Bitxor(rhs)
+	})
 	if err != nil {
 		logger.Error("fheBitXor failed", "err", err)
 		return nil, err
@@ -7,7 +7,7 @@ import (
 )
 
 func fheShlRequiredGas(environment EVMEnvironment, input []byte) uint64 {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 	isScalar, err := isScalarOp(input)
@@ -32,6 +32,10 @@ func fheShlRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 			logger.Error("fheShift RequiredGas() scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return loadGas
 		}
+		// A scalar on the left is trivially encrypted and shifted by the ciphertext, so it costs as much as a non-scalar shift.
+		if isScalarLeftOp(input) {
+			return environment.FhevmParams().GasCosts.FheShift[lhs.Type()] + loadGas
+		}
 		return environment.FhevmParams().GasCosts.FheScalarShift[lhs.Type()] + loadGas
 	}
 }
@@ -84,7 +88,7 @@ func fheNotRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 }
 
 func fheBitAndRequiredGas(environment EVMEnvironment, input []byte) uint64 {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
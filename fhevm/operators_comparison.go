@@ -14,7 +14,7 @@ import (
 )
 
 func fheLeRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -42,7 +42,9 @@ func fheLeRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.Le(rhs)
+		result, err := memoizeResult(environment, "Le", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Le(rhs)
+		})
 		if err != nil {
 			logger.Error("fheLe failed", "err", err)
 			return nil, err
@@ -59,14 +61,23 @@ func fheLeRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			logger.Error("fheLe scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.ScalarLe(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftLe", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftLe(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarLe", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLe(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheLe failed", "err", err)
 			return nil, err
@@ -74,13 +85,13 @@ func fheLeRun(environment EVMEnvironment, caller common.Address, addr common.Add
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheLe scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheLe scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
 
 func fheLtRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -108,7 +119,9 @@ func fheLtRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.Lt(rhs)
+		result, err := memoizeResult(environment, "Lt", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Lt(rhs)
+		})
 		if err != nil {
 			logger.Error("fheLt failed", "err", err)
 			return nil, err
@@ -125,14 +138,23 @@ func fheLtRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			logger.Error("fheLt scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.ScalarLt(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftLt", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftLt(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarLt", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLt(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheLt failed", "err", err)
 			return nil, err
@@ -140,13 +162,13 @@ func fheLtRun(environment EVMEnvironment, caller common.Address, addr common.Add
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheLt scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheLt scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
 
 func fheEqRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -174,7 +196,9 @@ func fheEqRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.Eq(rhs)
+		result, err := memoizeResult(environment, "Eq", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Eq(rhs)
+		})
 		if err != nil {
 			logger.Error("fheEq failed", "err", err)
 			return nil, err
@@ -198,7 +222,9 @@ func fheEqRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.ScalarEq(rhs)
+		result, err := memoizeResult(environment, "ScalarEq", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.ScalarEq(rhs)
+		})
 		if err != nil {
 			logger.Error("fheEq failed", "err", err)
 			return nil, err
@@ -212,7 +238,7 @@ func fheEqRun(environment EVMEnvironment, caller common.Address, addr common.Add
 }
 
 func fheGeRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -240,7 +266,9 @@ func fheGeRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.Ge(rhs)
+		result, err := memoizeResult(environment, "Ge", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Ge(rhs)
+		})
 		if err != nil {
 			logger.Error("fheGe failed", "err", err)
 			return nil, err
@@ -257,14 +285,23 @@ func fheGeRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			logger.Error("fheGe scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.ScalarGe(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftGe", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftGe(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarGe", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarGe(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheGe failed", "err", err)
 			return nil, err
@@ -272,13 +309,13 @@ func fheGeRun(environment EVMEnvironment, caller common.Address, addr common.Add
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheGe scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheGe scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
 
 func fheGtRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -306,7 +343,9 @@ func fheGtRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.Gt(rhs)
+		result, err := memoizeResult(environment, "Gt", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Gt(rhs)
+		})
 		if err != nil {
 			logger.Error("fheGt failed", "err", err)
 			return nil, err
@@ -323,14 +362,23 @@ func fheGtRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			logger.Error("fheGt scalar failed to load inputs", "err", err, "input", hex.EncodeToString(input))
 			return nil, err
 		}
-		otelDescribeOperands(runSpan, encryptedOperand(*lhs), plainOperand(*rhs))
+		otelDescribeScalarOperands(runSpan, lhs, rhs, isScalarLeftOp(input))
 
 		// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
 		if !environment.IsCommitting() && !environment.IsEthCall() {
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.ScalarGt(rhs)
+		var result *tfhe.TfheCiphertext
+		if isScalarLeftOp(input) {
+			result, err = memoizeResult(environment, "ScalarLeftGt", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarLeftGt(rhs)
+			})
+		} else {
+			result, err = memoizeResult(environment, "ScalarGt", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+				return lhs.ScalarGt(rhs)
+			})
+		}
 		if err != nil {
 			logger.Error("fheGt failed", "err", err)
 			return nil, err
@@ -338,13 +386,13 @@ func fheGtRun(environment EVMEnvironment, caller common.Address, addr common.Add
 		resultHash := result.GetHash()
 		insertCiphertextToMemory(environment, resultHash, result)
 
-		logger.Info("fheGt scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "result", resultHash.Hex())
+		logger.Info("fheGt scalar success", "lhs", lhs.GetHash().Hex(), "rhs", rhs.Uint64(), "scalarLeft", isScalarLeftOp(input), "result", resultHash.Hex())
 		return resultHash[:], nil
 	}
 }
 
 func fheNeRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -372,7 +420,9 @@ func fheNeRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.Ne(rhs)
+		result, err := memoizeResult(environment, "Ne", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Ne(rhs)
+		})
 		if err != nil {
 			logger.Error("fheNe failed", "err", err)
 			return nil, err
@@ -396,7 +446,9 @@ func fheNeRun(environment EVMEnvironment, caller common.Address, addr common.Add
 			return insertRandomCiphertext(environment, tfhe.FheBool), nil
 		}
 
-		result, err := lhs.ScalarNe(rhs)
+		result, err := memoizeResult(environment, "ScalarNe", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.ScalarNe(rhs)
+		})
 		if err != nil {
 			logger.Error("fheNe failed", "err", err)
 			return nil, err
@@ -410,7 +462,7 @@ func fheNeRun(environment EVMEnvironment, caller common.Address, addr common.Add
 }
 
 func fheMinRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -438,7 +490,9 @@ func fheMinRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.Min(rhs)
+		result, err := memoizeResult(environment, "Min", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Min(rhs)
+		})
 		if err != nil {
 			logger.Error("fheMin failed", "err", err)
 			return nil, err
@@ -462,7 +516,9 @@ func fheMinRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarMin(rhs)
+		result, err := memoizeResult(environment, "ScalarMin", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.ScalarMin(rhs)
+		})
 		if err != nil {
 			logger.Error("fheMin failed", "err", err)
 			return nil, err
@@ -476,7 +532,7 @@ func fheMinRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 }
 
 func fheMaxRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 
@@ -504,7 +560,9 @@ func fheMaxRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.Max(rhs)
+		result, err := memoizeResult(environment, "Max", nil, []*tfhe.TfheCiphertext{lhs, rhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.Max(rhs)
+		})
 		if err != nil {
 			logger.Error("fheMax failed", "err", err)
 			return nil, err
@@ -528,7 +586,9 @@ func fheMaxRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 			return insertRandomCiphertext(environment, lhs.Type()), nil
 		}
 
-		result, err := lhs.ScalarMax(rhs)
+		result, err := memoizeResult(environment, "ScalarMax", rhs, []*tfhe.TfheCiphertext{lhs}, func() (*tfhe.TfheCiphertext, error) {
+			return lhs.ScalarMax(rhs)
+		})
 		if err != nil {
 			logger.Error("fheMax failed", "err", err)
 			return nil, err
@@ -563,7 +623,9 @@ func fheIfThenElseRun(environment EVMEnvironment, caller common.Address, addr co
 		return insertRandomCiphertext(environment, second.Type()), nil
 	}
 
-	result, err := first.IfThenElse(second, third)
+	result, err := memoizeResult(environment, "IfThenElse", nil, []*tfhe.TfheCiphertext{first, second, third}, func() (*tfhe.TfheCiphertext, error) {
+		return first.IfThenElse(second, third)
+	})
 	if err != nil {
 		logger.Error("fheIfThenElse failed", "err", err)
 		return nil, err
@@ -670,7 +732,11 @@ func fheArrayEqRun(environment EVMEnvironment, caller common.Address, addr commo
 		return insertRandomCiphertext(environment, tfhe.FheBool), nil
 	}
 
-	result, err := tfhe.EqArray(lhs, rhs)
+	// The scalar separates the arrays, as ([a], [b, c]) and ([a, b], [c]) have the same operands.
+	operands := append(append([]*tfhe.TfheCiphertext{}, lhs...), rhs...)
+	result, err := memoizeResult(environment, "EqArray", big.NewInt(int64(len(lhs))), operands, func() (*tfhe.TfheCiphertext, error) {
+		return tfhe.EqArray(lhs, rhs)
+	})
 	if err != nil {
 		msg := "fheArrayEqRun failed to execute"
 		logger.Error(msg, "err", err)
@@ -8,7 +8,7 @@ import (
 )
 
 func fheLeRequiredGas(environment EVMEnvironment, input []byte) uint64 {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 	isScalar, err := isScalarOp(input)
@@ -44,7 +44,7 @@ func fheLtRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 }
 
 func fheEqRequiredGas(environment EVMEnvironment, input []byte) uint64 {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 	isScalar, err := isScalarOp(input)
@@ -90,7 +90,7 @@ func fheNeRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 }
 
 func fheMinRequiredGas(environment EVMEnvironment, input []byte) uint64 {
-	input = input[:minInt(65, len(input))]
+	input = input[:minInt(66, len(input))]
 
 	logger := environment.GetLogger()
 	isScalar, err := isScalarOp(input)
@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"math/big"
 	"strings"
-	"time"
 
 	"PureChain/accounts/abi"
 	"PureChain/common"
@@ -59,6 +58,20 @@ const verifyCipertextAbiJson = `
 
 var verifyCipertextMethod abi.Method
 
+var inputProofMetadataDomain = []byte("fhevm.input.v1")
+
+// Returns the metadata the zero-knowledge proof of an input list is bound to. Clients give it when proving the list,
+// e.g. with tfhe.EncryptAndProveCompactList(), and verifyCiphertext verifies the proof against the metadata of the
+// user, the contract and the chain it is called with. Hence, an input proof can't be replayed by another user, into
+// another contract or on another chain, even by someone who copies it from calldata.
+func InputProofMetadata(chainID *big.Int, contractAddress common.Address, userAddress common.Address) []byte {
+	metadata := make([]byte, 0, len(inputProofMetadataDomain)+32+2*common.AddressLength)
+	metadata = append(metadata, inputProofMetadataDomain...)
+	metadata = append(metadata, common.BigToHash(chainID).Bytes()...)
+	metadata = append(metadata, contractAddress.Bytes()...)
+	return append(metadata, userAddress.Bytes()...)
+}
+
 func init() {
 	reader := strings.NewReader(verifyCipertextAbiJson)
 	verifyCiphertextAbi, err := abi.JSON(reader)
@@ -73,97 +86,187 @@ func init() {
 	}
 }
 
-func parseVerifyCiphertextInput(environment EVMEnvironment, input []byte) ([32]byte, *tfhe.TfheCiphertext, error) {
+type verifyCiphertextInput struct {
+	handle          [32]byte
+	handleIndex     uint8
+	handleType      tfhe.FheUintType
+	userAddress     common.Address
+	contractAddress common.Address
+	// The input list, i.e. the header followed by the serialized proven compact list.
+	inputList     []byte
+	inputListHash common.Hash
+	header        *inputListHeader
+	// The metadata the proof of the list must be verified against, see InputProofMetadata().
+	metadata []byte
+	// Key of the list in the input list cache. Lists verified for other metadata are cached apart, such that a list
+	// verified for a user and a contract can't be used by others in the same transaction.
+	cacheKey common.Hash
+}
+
+// Unpacks verifyCiphertext input and does all the checks that don't require deserializing the input list.
+func unpackVerifyCiphertextInput(environment EVMEnvironment, input []byte) (*verifyCiphertextInput, error) {
 	unpacked, err := verifyCipertextMethod.Inputs.UnpackValues(input)
 	if err != nil {
-		return [32]byte{}, nil, err
+		return nil, err
 	} else if len(unpacked) != 5 {
-		return [32]byte{}, nil, fmt.Errorf("parseVerifyCiphertextInput unexpected unpacked len: %d", len(unpacked))
+		return nil, fmt.Errorf("parseVerifyCiphertextInput unexpected unpacked len: %d", len(unpacked))
 	}
+	parsed := verifyCiphertextInput{}
 
 	// Get handle from input.
 	handle, ok := unpacked[0].([32]byte)
 	if !ok {
-		return [32]byte{}, nil, fmt.Errorf("parseVerifyCiphertextInput failed to parse bytes32 inputHandle")
+		return nil, fmt.Errorf("parseVerifyCiphertextInput failed to parse bytes32 inputHandle")
 	}
+	parsed.handle = handle
 
-	// Get the ciphertext from the input.
-	ciphertextList, ok := unpacked[3].([]byte)
-	if !ok || len(ciphertextList) == 0 {
-		return [32]byte{}, nil, fmt.Errorf("parseVerifyCiphertextInput failed to parse bytes inputProof")
+	// Get the user and contract addresses the input is bound to.
+	parsed.userAddress, ok = unpacked[1].(common.Address)
+	if !ok {
+		return nil, fmt.Errorf("parseVerifyCiphertextInput failed to parse address callerAddress")
+	}
+	parsed.contractAddress, ok = unpacked[2].(common.Address)
+	if !ok {
+		return nil, fmt.Errorf("parseVerifyCiphertextInput failed to parse address contractAddress")
+	}
+
+	// The input proof is the input list.
+	inputProof, ok := unpacked[3].([]byte)
+	if !ok || len(inputProof) == 0 {
+		return nil, fmt.Errorf("parseVerifyCiphertextInput failed to parse bytes inputProof")
+	}
+	parsed.inputList = inputProof
+	if maxBytes := environment.FhevmParams().MaxInputListBytes; uint64(len(parsed.inputList)) > maxBytes {
+		return nil, fmt.Errorf("parseVerifyCiphertextInput %w: input list of %d bytes, limit is %d", tfhe.ErrInvalidInputSize, len(parsed.inputList), maxBytes)
+	}
+	parsed.header, _, err = parseInputListHeader(parsed.inputList)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get the type from the input.
 	inputTypeByteArray, ok := unpacked[4].([1]byte)
 	if !ok {
-		return [32]byte{}, nil, fmt.Errorf("parseVerifyCiphertextInput failed to parse byte inputType")
+		return nil, fmt.Errorf("parseVerifyCiphertextInput failed to parse byte inputType")
 	}
 	if !tfhe.IsValidFheType(inputTypeByteArray[0]) {
-		return [32]byte{}, nil, fmt.Errorf("parseVerifyCiphertextInput invalid inputType")
+		return nil, fmt.Errorf("parseVerifyCiphertextInput invalid inputType")
 	}
 	inputType := tfhe.FheUintType(inputTypeByteArray[0])
 
 	// Get the type from the handle.
-	handleIndex := uint8(handle[29])
+	parsed.handleIndex = uint8(handle[29])
 	handleTypeByte := handle[30]
 	if !tfhe.IsValidFheType(handleTypeByte) {
-		return [32]byte{}, nil, fmt.Errorf("parseVerifyCiphertextInput invalid handleType")
+		return nil, fmt.Errorf("parseVerifyCiphertextInput invalid handleType")
 	}
-	handleType := tfhe.FheUintType(handleTypeByte)
+	parsed.handleType = tfhe.FheUintType(handleTypeByte)
 
 	// Make sure handle type matches the input type.
-	if handleType != inputType {
-		return [32]byte{}, nil, fmt.Errorf("parseVerifyCiphertextInput handle type (%d) is different from the input type (%d)", handleType, inputType)
+	if parsed.handleType != inputType {
+		return nil, fmt.Errorf("parseVerifyCiphertextInput handle type (%d) is different from the input type (%d)", parsed.handleType, inputType)
 	}
 
 	// Make sure hash in the handle is correct.
-	ciphertextListHash := crypto.Keccak256Hash(ciphertextList)
-	ciphertextListAndIndexHash := crypto.Keccak256Hash(append(ciphertextListHash.Bytes(), handleIndex))
-	if !bytes.Equal(ciphertextListAndIndexHash[:29], handle[:29]) {
-		return [32]byte{}, nil, fmt.Errorf("parseVerifyCiphertextInput input hash doesn't match handle hash")
+	parsed.inputListHash = crypto.Keccak256Hash(parsed.inputList)
+	parsed.metadata = InputProofMetadata(environment.GetChainID(), parsed.contractAddress, parsed.userAddress)
+	parsed.cacheKey = crypto.Keccak256Hash(parsed.inputListHash.Bytes(), parsed.metadata)
+	inputListAndIndexHash := crypto.Keccak256Hash(append(parsed.inputListHash.Bytes(), parsed.handleIndex))
+	if !bytes.Equal(inputListAndIndexHash[:29], handle[:29]) {
+		return nil, fmt.Errorf("parseVerifyCiphertextInput input hash doesn't match handle hash")
 	}
 
-	var cts []*tfhe.TfheCiphertext
-	if environment.FhevmData().expandedInputCiphertexts == nil {
-		environment.FhevmData().expandedInputCiphertexts = make(map[common.Hash][]*tfhe.TfheCiphertext)
-	}
-	if cts, ok = environment.FhevmData().expandedInputCiphertexts[ciphertextListHash]; !ok {
-		if inputType == tfhe.FheUint2048 {
-			cts, err = tfhe.DeserializeAndExpandCompact2048List(ciphertextList)
-		} else {
-			cts, err = tfhe.DeserializeAndExpandCompact160List(ciphertextList)
-		}
-		if err != nil {
-			return [32]byte{}, nil, err
+	// Extract ciphertext from the list via the handle index.
+	if int(parsed.handleIndex) >= parsed.header.count() {
+		return nil, fmt.Errorf("parseVerifyCiphertextInput ciphertext index out of range")
+	}
+
+	// Make sure the handle type fits the type of the ciphertext in the list. Ciphertexts from mixed-type lists are
+	// not cast, so their type must match exactly.
+	listType := parsed.header.types[parsed.handleIndex]
+	if parsed.header.castsToHandleType() {
+		if (listType == tfhe.FheUint2048) != (parsed.handleType == tfhe.FheUint2048) {
+			return nil, fmt.Errorf("parseVerifyCiphertextInput handle type (%d) not allowed in list of type (%d)", parsed.handleType, listType)
 		}
+	} else if listType != parsed.handleType {
+		return nil, fmt.Errorf("parseVerifyCiphertextInput handle type (%d) is different from the list element type (%d)", parsed.handleType, listType)
 	}
+	return &parsed, nil
+}
 
-	// Extract ciphertext from the list via the handle index.
-	if int(handleIndex) >= len(cts) {
-		return [32]byte{}, nil, fmt.Errorf("parseVerifyCiphertextInput ciphertext index out of range")
+// Returns the expanded ciphertexts of the given input list, verifying its proof of knowledge if it is not cached.
+func expandInputList(environment EVMEnvironment, parsed *verifyCiphertextInput) ([]*tfhe.TfheCiphertext, error) {
+	cache := &environment.FhevmData().inputListCache
+	if cts, ok := cache.get(parsed.cacheKey); ok {
+		return cts, nil
+	}
+	_, provenList, err := parseInputListHeader(parsed.inputList)
+	if err != nil {
+		return nil, err
+	}
+	// Verify the proof of knowledge of the list, such that users can't submit ciphertexts they can't decrypt. It is
+	// verified against the user, the contract and the chain, such that the list can't be replayed. The list must match
+	// its header, which the verification was priced with, and that is checked before the proof is verified.
+	maxBytes := environment.FhevmParams().MaxInputListBytes
+	var cts []*tfhe.TfheCiphertext
+	switch {
+	case !parsed.header.castsToHandleType():
+		cts, err = tfhe.VerifyAndExpandProvenCompactList(provenList, parsed.header.types, parsed.metadata, maxBytes)
+	case parsed.header.types[0] == tfhe.FheUint2048:
+		cts, err = tfhe.VerifyAndExpandProvenCompact2048List(provenList, parsed.header.count(), parsed.metadata, maxBytes)
+	default:
+		cts, err = tfhe.VerifyAndExpandProvenCompact160List(provenList, parsed.header.count(), parsed.metadata, maxBytes)
+	}
+	if err != nil {
+		return nil, err
 	}
-	ct := cts[handleIndex]
+	cache.insert(parsed.cacheKey, cts, expandedInputListSize(cts), environment.FhevmParams().MaxInputListCacheBytes)
+	return cts, nil
+}
 
-	// Cast, if needed.
-	if inputType == tfhe.FheUint2048 {
-		if handleType != tfhe.FheUint2048 {
-			return [32]byte{}, nil, fmt.Errorf("parseVerifyCiphertextInput only FheUint2048 allowed in FheUint2048List")
-		}
-	} else {
-		if handleType != ct.Type() {
-			ct, err = ct.CastTo(handleType)
-			if err != nil {
-				return [32]byte{}, nil, err
-			}
+func parseVerifyCiphertextInput(environment EVMEnvironment, input []byte) ([32]byte, *tfhe.TfheCiphertext, error) {
+	parsed, err := unpackVerifyCiphertextInput(environment, input)
+	if err != nil {
+		return [32]byte{}, nil, err
+	}
+
+	cts, err := expandInputList(environment, parsed)
+	if err != nil {
+		return [32]byte{}, nil, err
+	}
+	ct := cts[parsed.handleIndex]
+
+	// Cast, if needed. Ciphertexts from mixed-type lists already have the handle type.
+	if parsed.handleType != ct.Type() {
+		ct, err = ct.CastTo(parsed.handleType)
+		if err != nil {
+			return [32]byte{}, nil, err
 		}
 	}
-	environment.FhevmData().expandedInputCiphertexts[ciphertextListHash] = cts
-	return handle, ct, nil
+	return parsed.handle, ct, nil
 }
 
 func verifyCiphertextRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
 	logger := environment.GetLogger()
 
+	// If we are doing gas estimation, skip list expansion and insert a random ciphertext as a result.
+	if !environment.IsCommitting() && !environment.IsEthCall() {
+		parsed, err := unpackVerifyCiphertextInput(environment, input)
+		if err != nil {
+			logger.Error(err.Error())
+			return nil, err
+		}
+		otelDescribeOperandsFheTypes(runSpan, parsed.handleType)
+		// Subsequent handles from the same list are then estimated as they would be executed.
+		size := uint64(0)
+		for _, t := range parsed.header.types {
+			expandedSize, _ := tfhe.GetExpandedFheCiphertextSize(t)
+			size += uint64(expandedSize)
+		}
+		environment.FhevmData().inputListCache.insert(parsed.cacheKey, nil, size, environment.FhevmParams().MaxInputListCacheBytes)
+		return insertRandomCiphertext(environment, parsed.handleType), nil
+	}
+
 	handle, ct, err := parseVerifyCiphertextInput(environment, input)
 	if err != nil {
 		logger.Error(err.Error())
@@ -171,11 +274,6 @@ func verifyCiphertextRun(environment EVMEnvironment, caller common.Address, addr
 	}
 	otelDescribeOperandsFheTypes(runSpan, ct.Type())
 
-	// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
-	if !environment.IsCommitting() && !environment.IsEthCall() {
-		return insertRandomCiphertext(environment, ct.Type()), nil
-	}
-
 	insertCiphertextToMemory(environment, handle, ct)
 	if environment.IsCommitting() {
 		logger.Info("verifyCiphertext success",
@@ -244,7 +342,11 @@ func decryptValue(environment EVMEnvironment, ct *tfhe.TfheCiphertext) (*big.Int
 		Proof:      proof,
 	}
 
-	conn, err := grpc.Dial(kms.KmsEndpointAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	kmsConfig := environment.FhevmParams().Kms
+	if kmsConfig.EndpointAddr == "" {
+		return nil, errors.New("kms endpoint is not configured")
+	}
+	conn, err := grpc.Dial(kmsConfig.EndpointAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		return nil, errors.New("kms unreachable")
 	}
@@ -252,7 +354,7 @@ func decryptValue(environment EVMEnvironment, ct *tfhe.TfheCiphertext) (*big.Int
 
 	ep := kms.NewKmsEndpointClient(conn)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), kmsConfig.Timeout)
 	defer cancel()
 
 	res, err := ep.Decrypt(ctx, decryptionRequest)
@@ -300,7 +402,9 @@ func castRun(environment EVMEnvironment, caller common.Address, addr common.Addr
 		return insertRandomCiphertext(environment, castToType), nil
 	}
 
-	res, err := ct.CastTo(castToType)
+	res, err := memoizeResult(environment, "CastTo", big.NewInt(int64(castToType)), []*tfhe.TfheCiphertext{ct}, func() (*tfhe.TfheCiphertext, error) {
+		return ct.CastTo(castToType)
+	})
 	if err != nil {
 		msg := "cast Run() error casting ciphertext to"
 		logger.Error(msg, "type", castToType)
@@ -328,14 +432,88 @@ func fhePubKeyRun(environment EVMEnvironment, caller common.Address, addr common
 		return nil, err
 	}
 	// If we have a single byte with the value of 1, make as an EVM array.
-	if len(input) == 1 && input[0] == 1 {
+	return EncodeFhePubKeyOutput(pksBytes, len(input) == 1 && input[0] == 1), nil
+}
+
+// Encodes the serialized public key `pksBytes` as returned by the fhePubKey precompile method, optionally as an EVM
+// array.
+func EncodeFhePubKeyOutput(pksBytes []byte, asEVMArray bool) []byte {
+	if asEVMArray {
 		pksBytes = toEVMBytes(pksBytes)
 	}
 	// pad according to abi specification, first add offset to the dynamic bytes argument
 	outputBytes := make([]byte, 32, len(pksBytes)+32)
 	outputBytes[31] = 0x20
 	outputBytes = append(outputBytes, pksBytes...)
-	return padArrayTo32Multiple(outputBytes), nil
+	return padArrayTo32Multiple(outputBytes)
+}
+
+// Maximum number of bytes fhePubKeyChunk returns in one call.
+const MaxFhePubKeyChunkBytes = 24 * 1024
+
+func fhePubKeyHashRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
+	pksHash := tfhe.GetPksHash()
+	return pksHash.Bytes(), nil
+}
+
+func fhePubKeySizeRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
+	pksBytes, err := tfhe.SerializePublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return common.BigToHash(big.NewInt(int64(len(pksBytes)))).Bytes(), nil
+}
+
+// Returns `length` bytes of the serialized public key, starting at `offset`, ABI-encoded as `bytes`. Fewer bytes are
+// returned if the key ends before `offset + length`, such that callers can page through it with a fixed length. The
+// concatenated chunks hash to the result of fhePubKeyHash.
+func fhePubKeyChunkRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
+	input = input[:minInt(64, len(input))]
+
+	logger := environment.GetLogger()
+	offset, length, err := parsePubKeyChunkInput(input)
+	if err != nil {
+		logger.Error("fhePubKeyChunk invalid input", "input", hex.EncodeToString(input), "err", err)
+		return nil, err
+	}
+	pksBytes, err := tfhe.SerializePublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if offset > uint64(len(pksBytes)) {
+		err := fmt.Errorf("fhePubKeyChunk offset %d is past the end of the %d byte public key", offset, len(pksBytes))
+		logger.Error(err.Error())
+		return nil, err
+	}
+	end := offset + length
+	if end > uint64(len(pksBytes)) {
+		end = uint64(len(pksBytes))
+	}
+	return toABIBytesOutput(pksBytes[offset:end]), nil
+}
+
+func parsePubKeyChunkInput(input []byte) (offset uint64, length uint64, err error) {
+	if len(input) != 64 {
+		return 0, 0, errors.New("fhePubKeyChunk input needs to contain an offset and a length")
+	}
+	offsetBig := new(big.Int).SetBytes(input[0:32])
+	lengthBig := new(big.Int).SetBytes(input[32:64])
+	if !offsetBig.IsUint64() {
+		return 0, 0, errors.New("fhePubKeyChunk offset is too big")
+	}
+	if lengthBig.Cmp(big.NewInt(MaxFhePubKeyChunkBytes)) > 0 {
+		return 0, 0, fmt.Errorf("fhePubKeyChunk length %s is bigger than the maximum of %d", lengthBig, MaxFhePubKeyChunkBytes)
+	}
+	return offsetBig.Uint64(), lengthBig.Uint64(), nil
+}
+
+func fheKeySetIdRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
+	return common.BigToHash(new(big.Int).SetUint64(uint64(tfhe.GetKeySetId()))).Bytes(), nil
+}
+
+// Returns the tfhe-rs name of the parameters of the active key set, ABI-encoded as `string`.
+func fheKeyParametersRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
+	return toABIBytesOutput([]byte(tfhe.GetParameterSet().ParametersName())), nil
 }
 
 func trivialEncryptRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool, runSpan trace.Span) ([]byte, error) {
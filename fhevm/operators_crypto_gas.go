@@ -7,15 +7,25 @@ import (
 	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
 )
 
+// Computes gas from the input list header, without deserializing and expanding the list.
 func verifyCiphertextRequiredGas(environment EVMEnvironment, input []byte) uint64 {
-	_, ct, err := parseVerifyCiphertextInput(environment, input)
+	parsed, err := unpackVerifyCiphertextInput(environment, input)
 	if err != nil {
 		environment.GetLogger().Error(
 			"verifyCiphertext RequiredGas() input parsing failed",
 			"err", err)
 		return 0
 	}
-	return environment.FhevmParams().GasCosts.FheVerify[ct.Type()]
+	gasCosts := environment.FhevmParams().GasCosts
+	// The proof of a list is only verified when it is expanded, so subsequent handles from a cached list are cheaper.
+	if environment.FhevmData().inputListCache.contains(parsed.cacheKey) {
+		return gasCosts.FheVerifyCached[parsed.handleType]
+	}
+	proofGas := gasCosts.FheVerifyProofBase
+	for _, t := range parsed.header.types {
+		proofGas += gasCosts.FheVerifyProofPerCiphertext[t]
+	}
+	return gasCosts.FheVerify[parsed.handleType] + proofGas
 }
 
 func getCiphertextRequiredGas(environment EVMEnvironment, input []byte) uint64 {
@@ -59,6 +69,24 @@ func fhePubKeyRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 	return environment.FhevmParams().GasCosts.FhePubKey
 }
 
+func fheKeyInfoRequiredGas(environment EVMEnvironment, input []byte) uint64 {
+	return environment.FhevmParams().GasCosts.FheKeyInfo
+}
+
+func fhePubKeyChunkRequiredGas(environment EVMEnvironment, input []byte) uint64 {
+	input = input[:minInt(64, len(input))]
+
+	logger := environment.GetLogger()
+	gasCosts := environment.FhevmParams().GasCosts
+	_, length, err := parsePubKeyChunkInput(input)
+	if err != nil {
+		logger.Error("fhePubKeyChunk RequiredGas() invalid input", "input", hex.EncodeToString(input), "err", err)
+		return gasCosts.FhePubKey
+	}
+	// Charged for the requested length, as the actual one depends on the key size.
+	return gasCosts.FhePubKey + (length+31)/32*gasCosts.FhePubKeyChunkPerWord
+}
+
 func trivialEncryptRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 	input = input[:minInt(33, len(input))]
 
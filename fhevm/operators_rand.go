@@ -1,12 +1,10 @@
 package fhevm
 
 import (
-	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
-	"math/bits"
 
 	"PureChain/common"
 	"PureChain/crypto"
@@ -14,54 +12,30 @@ import (
 	fhevm_crypto "github.com/lukadas12345/rfhevm/fhevm/crypto"
 	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
 	"go.opentelemetry.io/otel/trace"
-	"golang.org/x/crypto/chacha20"
 )
 
-var globalRngSeed []byte
+// Domain separator mixed into every RNG seed. Seeds are derived from the per-block seed supplied by the node and from
+// transaction data, so that all validators compute the same ciphertexts, while streams differ across chains and blocks.
+// Knowing the seed is fine, because the random values are generated homomorphically and are never known in plaintext
+// by anyone, including the validators.
+var globalRngSeed = []byte("fhevm.rand.v1")
 
 var rngNonceKey [32]byte = uint256.NewInt(0).Bytes32()
 
-func init() {
-	if chacha20.NonceSizeX != 24 {
-		panic("expected 24 bytes for NonceSizeX")
-	}
-
-	// TODO: Since the current implementation is not FHE-based and, hence, not private,
-	// we just initialize the global seed with non-random public data. We will change
-	// that once the FHE version is available.
-	globalRngSeed = make([]byte, chacha20.KeySize)
-	for i := range globalRngSeed {
-		globalRngSeed[i] = byte(1 + i)
-	}
-}
-
-// Applies the upperBound (if set) to the rand value and returns the result.
-// bitsInRand is the amount of random bits that are contained in rand.
-// bitsInRand and upperBound must be powers of 2.
-func applyUpperBound(rand uint64, bitsInRand int, upperBound *uint64) uint64 {
-	if upperBound == nil {
-		return rand
-	} else if *upperBound == 0 {
-		panic("sliceRandom called with upperBound of 0")
+// Generates a random ciphertext of the given type. If upperBound is not nil, the result is in the [0, upperBound) range.
+func generateRandom(environment EVMEnvironment, caller common.Address, resultType tfhe.FheUintType, upperBound *big.Int) ([]byte, error) {
+	switch resultType {
+	case tfhe.FheBool, tfhe.FheUint4, tfhe.FheUint8, tfhe.FheUint16, tfhe.FheUint32, tfhe.FheUint64, tfhe.FheUint128, tfhe.FheUint160:
+	default:
+		return nil, fmt.Errorf("generateRandom() invalid type requested: %d", resultType)
 	}
-	// Len64() returns the amount of bits needed to represent upperBound. Subtract 1 to get the
-	// amount of bits requested by the given upperBound as we want to return a value in the [0, upperBound) range.
-	// Note that upperBound is assumed to be a power of 2.
-	//
-	// For example, if upperBound = 128, then bits = 8 - 1 = 7 random bits to be returned.
-	// To get that amount of random bits from rand, subtract bits from bitsInRand, i.e.
-	// shift = 32 - 7 = 25. Shifting rand 25 positions would leave 7 of its random bits.
-	bits := bits.Len64(*upperBound) - 1
-	shift := bitsInRand - bits
-	// If the shift ends up negative or 0, just return rand without any shifts.
-	if shift <= 0 {
-		return rand
+	if upperBound != nil && resultType == tfhe.FheBool {
+		return nil, errors.New("generateRandom() upper bound is not supported for FheBool")
 	}
-	return rand >> shift
-}
 
-func generateRandom(environment EVMEnvironment, caller common.Address, resultType tfhe.FheUintType, upperBound *uint64) ([]byte, error) {
 	// If we are doing gas estimation, skip execution and insert a random ciphertext as a result.
+	// Gas only depends on the result type and the bound, so estimation stays consistent with execution even though
+	// the block seed, transaction hash and nonce used at execution time are not known during estimation.
 	if !environment.IsCommitting() {
 		return insertRandomCiphertext(environment, resultType), nil
 	}
@@ -75,62 +49,34 @@ func generateRandom(environment EVMEnvironment, caller common.Address, resultTyp
 	nextRngNonce = nextRngNonce.AddUint64(nextRngNonce, 1)
 	environment.SetState(protectedStorage, rngNonceKey, nextRngNonce.Bytes32())
 
-	// Compute the seed and use it to create a new cipher.
+	// Compute the seed from the block seed, the transaction hash, the caller and its current nonce such that every
+	// call gets a distinct one.
+	blockSeed := environment.GetBlockRandomSeed()
+	txHash := environment.GetTxHash()
 	hasher := crypto.NewKeccakState()
 	hasher.Write(globalRngSeed)
+	hasher.Write(blockSeed.Bytes())
+	hasher.Write(txHash.Bytes())
 	hasher.Write(caller.Bytes())
+	hasher.Write(currentRngNonceBytes)
 	seed := common.Hash{}
 	_, err := hasher.Read(seed[:])
 	if err != nil {
 		return nil, err
 	}
-	// The RNG nonce bytes are of size chacha20.NonceSizeX, which is assumed to be 24 bytes (see init() above).
-	// Since uint256.Int.z[0] is the least significant byte and since uint256.Int.Bytes32() serializes
-	// in order of z[3], z[2], z[1], z[0], we want to essentially ignore the first byte, i.e. z[3], because
-	// it will always be 0 as the nonce size is 24.
-	cipher, err := chacha20.NewUnauthenticatedCipher(seed.Bytes(), currentRngNonceBytes[32-chacha20.NonceSizeX:32])
+
+	// Generate the random ciphertext homomorphically, using the first 128 bits of the hash as a seed.
+	randCt := new(tfhe.TfheCiphertext)
+	var randSeed [16]byte
+	copy(randSeed[:], seed[:16])
+	if upperBound == nil {
+		err = randCt.GenerateRandom(randSeed, resultType, nil)
+	} else {
+		err = randCt.GenerateRandomBounded(randSeed, resultType, upperBound)
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	// XOR a byte array of 0s with the stream from the cipher and receive the result in the same array.
-	// Apply upperBound, if set.
-	var randUint uint64
-	switch resultType {
-	case tfhe.FheUint4:
-		randBytes := make([]byte, 1)
-		cipher.XORKeyStream(randBytes, randBytes)
-		randUint = uint64(randBytes[0])
-		randUint = uint64(applyUpperBound(randUint, 4, upperBound))
-	case tfhe.FheUint8:
-		randBytes := make([]byte, 1)
-		cipher.XORKeyStream(randBytes, randBytes)
-		randUint = uint64(randBytes[0])
-		randUint = uint64(applyUpperBound(randUint, 8, upperBound))
-	case tfhe.FheUint16:
-		randBytes := make([]byte, 2)
-		cipher.XORKeyStream(randBytes, randBytes)
-		randUint = uint64(binary.BigEndian.Uint16(randBytes))
-		randUint = uint64(applyUpperBound(randUint, 16, upperBound))
-	case tfhe.FheUint32:
-		randBytes := make([]byte, 4)
-		cipher.XORKeyStream(randBytes, randBytes)
-		randUint = uint64(binary.BigEndian.Uint32(randBytes))
-		randUint = uint64(applyUpperBound(randUint, 32, upperBound))
-	case tfhe.FheUint64:
-		randBytes := make([]byte, 8)
-		cipher.XORKeyStream(randBytes, randBytes)
-		randUint = uint64(binary.BigEndian.Uint64(randBytes))
-		randUint = uint64(applyUpperBound(randUint, 64, upperBound))
-	default:
-		return nil, fmt.Errorf("generateRandom() invalid type requested: %d", resultType)
-	}
-
-	// Trivially encrypt the random integer.
-	randCt := new(tfhe.TfheCiphertext)
-	randBigInt := big.NewInt(0)
-	randBigInt.SetUint64(randUint)
-	randCt.TrivialEncrypt(*randBigInt, resultType)
 	ctHash := randCt.GetHash()
 	insertCiphertextToMemory(environment, ctHash, randCt)
 	return ctHash[:], nil
@@ -152,7 +98,7 @@ func fheRandRun(environment EVMEnvironment, caller common.Address, addr common.A
 	}
 	resultType := tfhe.FheUintType(input[0])
 	otelDescribeOperandsFheTypes(runSpan, resultType)
-	var noUpperBound *uint64 = nil
+	var noUpperBound *big.Int = nil
 	return generateRandom(environment, caller, resultType, noUpperBound)
 }
 
@@ -172,6 +118,5 @@ func fheRandBoundedRun(environment EVMEnvironment, caller common.Address, addr c
 		return nil, errors.New(msg)
 	}
 	otelDescribeOperandsFheTypes(runSpan, randType)
-	bound64 := bound.Uint64()
-	return generateRandom(environment, caller, randType, &bound64)
+	return generateRandom(environment, caller, randType, bound.ToBig())
 }
@@ -3,7 +3,6 @@ package fhevm
 import (
 	"encoding/hex"
 	"fmt"
-	"math/bits"
 
 	"github.com/holiman/uint256"
 	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
@@ -26,28 +25,44 @@ func parseRandUpperBoundInput(input []byte) (randType tfhe.FheUintType, upperBou
 		return tfhe.FheUint8, nil, fmt.Errorf("parseRandUpperBoundInput() invalid input len or type")
 	}
 	randType = tfhe.FheUintType(input[32])
+	if randType == tfhe.FheBool || randType == tfhe.FheUint2048 {
+		return tfhe.FheUint8, nil, fmt.Errorf("parseRandUpperBoundInput() bounds are not supported for %s", randType)
+	}
 	upperBound = uint256.NewInt(0)
 	upperBound.SetBytes32(input)
-	// For now, we only support bounds of up to 64 bits.
-	if !upperBound.IsUint64() {
-		return tfhe.FheUint8, nil, fmt.Errorf("parseRandUpperBoundInput() only supports bounds up to 64 bits")
+	if upperBound.IsZero() {
+		return tfhe.FheUint8, nil, fmt.Errorf("parseRandUpperBoundInput() bound is 0")
 	}
-	upperBound64 := upperBound.Uint64()
-	oneBits := bits.OnesCount64(upperBound64)
-	if oneBits != 1 {
-		return tfhe.FheUint8, nil, fmt.Errorf("parseRandUpperBoundInput() bound not a power of 2: %d", upperBound64)
+	// A power of 2 bound can be up to 2^bits, anything else must be smaller and reducible without bias.
+	if isPowerOf2(upperBound) {
+		if upperBound.BitLen() > int(randType.NumBits())+1 {
+			return tfhe.FheUint8, nil, fmt.Errorf("parseRandUpperBoundInput() bound %s too big for %s", upperBound.Dec(), randType)
+		}
+	} else if _, err := tfhe.BoundedRandomReductionBits(randType, upperBound.ToBig()); err != nil {
+		return tfhe.FheUint8, nil, fmt.Errorf("parseRandUpperBoundInput() %v", err)
 	}
 	return randType, upperBound, nil
 }
 
+func isPowerOf2(value *uint256.Int) bool {
+	return !value.IsZero() && new(uint256.Int).And(value, new(uint256.Int).SubUint64(value, 1)).IsZero()
+}
+
 func fheRandBoundedRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 	input = input[:minInt(33, len(input))]
 
 	logger := environment.GetLogger()
-	randType, _, err := parseRandUpperBoundInput(input)
+	randType, upperBound, err := parseRandUpperBoundInput(input)
 	if err != nil {
 		logger.Error("fheRandBounded RequiredGas() bound error", "input", hex.EncodeToString(input), "err", err)
 		return 0
 	}
+	if !isPowerOf2(upperBound) {
+		// FheUint160 bounds above 128 bits are reduced from 256-bit values.
+		if width, _ := tfhe.BoundedRandomReductionBits(randType, upperBound.ToBig()); width == 256 {
+			return environment.FhevmParams().GasCosts.FheRandBoundedWide
+		}
+		return environment.FhevmParams().GasCosts.FheRandBounded[randType]
+	}
 	return environment.FhevmParams().GasCosts.FheRand[randType]
 }
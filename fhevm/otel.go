@@ -55,3 +55,12 @@ func otelDescribeOperandsFheTypes(span trace.Span, types ...tfhe.FheUintType) {
 	}
 	span.SetAttributes(attribute.KeyValue{Key: operandTypeAttrName, Value: attribute.StringValue(operandTypes)})
 }
+
+// Describes the operands of a scalar operation in the order they appear in the expression.
+func otelDescribeScalarOperands(span trace.Span, ct *tfhe.TfheCiphertext, scalar *big.Int, scalarLeft bool) {
+	if scalarLeft {
+		otelDescribeOperands(span, plainOperand(*scalar), encryptedOperand(*ct))
+	} else {
+		otelDescribeOperands(span, encryptedOperand(*ct), plainOperand(*scalar))
+	}
+}
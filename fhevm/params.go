@@ -1,6 +1,11 @@
 package fhevm
 
-import "github.com/lukadas12345/rfhevm/fhevm/tfhe"
+import (
+	"time"
+
+	"PureChain/common"
+	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
+)
 
 // This file contains default gas costs of fhEVM-related operations.
 // Users can change the values based on specific requirements in their blockchain.
@@ -10,57 +15,166 @@ import "github.com/lukadas12345/rfhevm/fhevm/tfhe"
 const EvmNetSstoreInitGas uint64 = 20000
 const AdjustFHEGas uint64 = 10000
 const ColdSloadCostEIP2929 uint64 = 2100
+const ColdAccountAccessCostEIP2929 uint64 = 2600
+const SelfdestructGasEIP150 uint64 = 5000
+const CreateBySelfdestructGas uint64 = 25000
 
 const GetNonExistentCiphertextGas uint64 = ColdSloadCostEIP2929
 
 const DeserializeCiphertextGas uint64 = 30
 
+// Decompressing a ciphertext loaded from storage, on top of reading it.
+const DecompressCiphertextGas uint64 = 1000
+
+// Reading a 32-byte word of a ciphertext stored uncompressed, like copying a word in the EVM.
+const SloadUncompressedCiphertextWordGas uint64 = 3
+
 // Base costs of fhEVM SSTORE and SLOAD operations.
 // TODO: We don't take whether the slot is cold or warm into consideration.
 const SstoreFheUint4Gas = EvmNetSstoreInitGas + 1000
 const SloadFheUint4Gas = ColdSloadCostEIP2929 + 100
 
+// Default maximum size of the expanded input lists cached during a transaction, in bytes.
+const DefaultMaxInputListCacheBytes uint64 = 64 * 1024 * 1024
+
+// Default maximum size of a serialized input list given to verifyCiphertext, header included, in bytes.
+const DefaultMaxInputListBytes uint64 = 4 * 1024 * 1024
+
+// Default timeout of a decryption request to the KMS.
+const DefaultKmsTimeout = time.Second
+
 func DefaultFhevmParams() FhevmParams {
+	return DefaultFhevmParamsForParameterSet(tfhe.ParameterSetDefault)
+}
+
+// Returns the default parameters for keys of the parameter set `p`, see DefaultGasCostsForParameterSet().
+func DefaultFhevmParamsForParameterSet(p tfhe.ParameterSet) FhevmParams {
 	return FhevmParams{
-		GasCosts: DefaultGasCosts(),
+		GasCosts:               DefaultGasCostsForParameterSet(p),
+		MaxInputListCacheBytes: DefaultMaxInputListCacheBytes,
+		MaxInputListBytes:      DefaultMaxInputListBytes,
+		FheComputeUnitsPercent: DefaultFheComputeUnitsPercent(),
+		Kms:                    KmsConfig{Timeout: DefaultKmsTimeout},
 	}
 }
 
 type FhevmParams struct {
 	GasCosts GasCosts
+	// As gas depends on which input lists are cached, it must be the same on all nodes.
+	MaxInputListCacheBytes uint64
+	// Bigger input lists are rejected before being deserialized. It must be the same on all nodes.
+	MaxInputListBytes uint64
+	// Maximum size of the native ciphertexts kept alive across operations during a transaction, in bytes. Native
+	// ciphertexts only save deserializations of operands, so, unlike the above, it can differ between nodes without
+	// affecting gas or results. Zero, the default, disables the cache. Hosts enabling it must release native
+	// ciphertexts after every transaction with FhevmData.Reset() or FhevmData.Release(), as they are not garbage
+	// collected.
+	MaxNativeCiphertextCacheBytes uint64
+	// Maximum size of the results of FHE operations cached across transactions and EVM instances, in bytes. Zero
+	// disables the cache. Results are the same whether cached or not, so it can differ between nodes.
+	MaxResultCacheBytes uint64
+	// Created by Config.Init() if MaxResultCacheBytes is not zero and shared by all instances initialized with the same
+	// config. Hosts building FhevmParams themselves create it with NewResultCache(), see ResultCache.
+	ResultCache *ResultCache
+	// FHE compute units of FheLib methods in percent of the gas of their operation, by method name, see
+	// FheLibMethod.ComputeUnits(). Compute units are metered apart from gas, such that the FHE computation of a block
+	// is bounded whatever its gas. They fail calls deterministically, so these must be the same on all nodes.
+	FheComputeUnitsPercent map[string]uint64
+	// Limits of the FHE compute units consumed by a transaction and by a block. Zero disables a limit, which is the
+	// default: enabling a limit changes the outcome of calls, so chains enable it from a fork block on.
+	MaxFheComputeUnitsPerTx    uint64
+	MaxFheComputeUnitsPerBlock uint64
+	// Only the TFHEExecutor contract is allowed to call the FheLib precompile, except for methods that are safe to
+	// call from any address, see isSafeFromAnyCaller().
+	TfheExecutorContractAddress common.Address
+	Kms                         KmsConfig
+}
+
+// Settings of the KMS decryptions are delegated to.
+type KmsConfig struct {
+	// Address of the KMS gRPC endpoint. Decryption fails if it is empty.
+	EndpointAddr string
+	// Timeout of a single decryption request.
+	Timeout time.Duration
 }
 
 type GasCosts struct {
-	FheCast                  uint64
-	FhePubKey                uint64
-	FheAddSub                map[tfhe.FheUintType]uint64
-	FheBitwiseOp             map[tfhe.FheUintType]uint64
-	FheMul                   map[tfhe.FheUintType]uint64
-	FheScalarMul             map[tfhe.FheUintType]uint64
-	FheScalarDiv             map[tfhe.FheUintType]uint64
-	FheScalarRem             map[tfhe.FheUintType]uint64
-	FheShift                 map[tfhe.FheUintType]uint64
-	FheScalarShift           map[tfhe.FheUintType]uint64
-	FheEq                    map[tfhe.FheUintType]uint64
-	FheArrayEqBigArrayFactor uint64 // TODO: either rename or come up with a better solution
-	FheLe                    map[tfhe.FheUintType]uint64
-	FheMinMax                map[tfhe.FheUintType]uint64
-	FheScalarMinMax          map[tfhe.FheUintType]uint64
-	FheNot                   map[tfhe.FheUintType]uint64
-	FheNeg                   map[tfhe.FheUintType]uint64
-	FheTrivialEncrypt        map[tfhe.FheUintType]uint64
-	FheRand                  map[tfhe.FheUintType]uint64
-	FheIfThenElse            map[tfhe.FheUintType]uint64
-	FheVerify                map[tfhe.FheUintType]uint64
-	FheGetCiphertext         map[tfhe.FheUintType]uint64
-	FheStorageSstoreGas      map[tfhe.FheUintType]uint64
-	FheStorageSloadGas       map[tfhe.FheUintType]uint64
+	FheCast                     uint64
+	FhePubKey                   uint64
+	FheKeyInfo                  uint64 // fhePubKeyHash, fhePubKeySize, fheKeySetId and fheKeyParameters
+	FhePubKeyChunkPerWord       uint64 // per 32-byte word returned by fhePubKeyChunk, on top of FhePubKey
+	FheAddSub                   map[tfhe.FheUintType]uint64
+	FheBitwiseOp                map[tfhe.FheUintType]uint64
+	FheMul                      map[tfhe.FheUintType]uint64
+	FheScalarMul                map[tfhe.FheUintType]uint64
+	FheScalarDiv                map[tfhe.FheUintType]uint64
+	FheScalarRem                map[tfhe.FheUintType]uint64
+	FheDiv                      map[tfhe.FheUintType]uint64 // encrypted divisor, only reachable through scalar-left operations
+	FheRem                      map[tfhe.FheUintType]uint64 // encrypted divisor, only reachable through scalar-left operations
+	FheShift                    map[tfhe.FheUintType]uint64
+	FheScalarShift              map[tfhe.FheUintType]uint64
+	FheEq                       map[tfhe.FheUintType]uint64
+	FheArrayEqBigArrayFactor    uint64 // TODO: either rename or come up with a better solution
+	FheLe                       map[tfhe.FheUintType]uint64
+	FheMinMax                   map[tfhe.FheUintType]uint64
+	FheScalarMinMax             map[tfhe.FheUintType]uint64
+	FheNot                      map[tfhe.FheUintType]uint64
+	FheNeg                      map[tfhe.FheUintType]uint64
+	FheTrivialEncrypt           map[tfhe.FheUintType]uint64
+	FheRand                     map[tfhe.FheUintType]uint64
+	FheRandBounded              map[tfhe.FheUintType]uint64 // bounds that are not a power of 2, see tfhe.BoundedRandomReductionBits()
+	FheRandBoundedWide          uint64                      // FheUint160 bounds above 128 bits, reduced from 256-bit random values
+	FheIfThenElse               map[tfhe.FheUintType]uint64
+	FheVerify                   map[tfhe.FheUintType]uint64
+	FheVerifyCached             map[tfhe.FheUintType]uint64 // handles from a list that is already expanded
+	FheVerifyProofBase          uint64
+	FheVerifyProofPerCiphertext map[tfhe.FheUintType]uint64 // keyed by the type each ciphertext is encrypted at
+	FheGetCiphertext            map[tfhe.FheUintType]uint64
+	FheStorageSstoreGas         map[tfhe.FheUintType]uint64
+	FheStorageSloadGas          map[tfhe.FheUintType]uint64
+	// Loads of ciphertexts stored uncompressed, i.e. before compression was introduced, read their expanded size and
+	// pay this per 32-byte word of it, see uncompressedCiphertextLoadGas().
+	FheStorageSloadUncompressedWordGas uint64
 }
 
+// Cost of the operations of each parameter set relative to the default one, in percent. Default gas costs are
+// benchmarked with the default parameter set. Multi-bit PBS has a lower latency, while the bigger LWE dimension of the
+// compact public key parameters makes every PBS slower.
+var parameterSetGasPercent = map[tfhe.ParameterSet]uint64{
+	tfhe.ParameterSetDefault:   100,
+	tfhe.ParameterSetMultiBit:  70,
+	tfhe.ParameterSetCompactPk: 120,
+}
+
+// Returns the default gas costs for keys of the parameter set `p`: the costs of operations on ciphertexts are scaled
+// by the relative cost of the parameter set, see parameterSetGasPercent. Storage costs are the same for all parameter
+// sets, as they share the compression parameters that persisted ciphertexts are compressed with.
+func DefaultGasCostsForParameterSet(p tfhe.ParameterSet) GasCosts {
+	costs := DefaultGasCosts()
+	percent, found := parameterSetGasPercent[p]
+	if !found || percent == 100 {
+		return costs
+	}
+	for _, opCosts := range []map[tfhe.FheUintType]uint64{
+		costs.FheAddSub, costs.FheBitwiseOp, costs.FheMul, costs.FheScalarMul, costs.FheScalarDiv, costs.FheScalarRem,
+		costs.FheDiv, costs.FheRem, costs.FheShift, costs.FheScalarShift, costs.FheEq, costs.FheLe, costs.FheMinMax,
+		costs.FheScalarMinMax, costs.FheNot, costs.FheNeg, costs.FheRand, costs.FheRandBounded, costs.FheIfThenElse,
+	} {
+		for t, cost := range opCosts {
+			opCosts[t] = cost * percent / 100
+		}
+	}
+	costs.FheRandBoundedWide = costs.FheRandBoundedWide * percent / 100
+	return costs
+}
+
+// Returns the default gas costs, for keys of the default parameter set.
 func DefaultGasCosts() GasCosts {
 	return GasCosts{
-		FheCast:   200,
-		FhePubKey: 50,
+		FheCast:               200,
+		FhePubKey:             50,
+		FheKeyInfo:            50,
+		FhePubKeyChunkPerWord: 3,
 		FheAddSub: map[tfhe.FheUintType]uint64{
 			tfhe.FheUint4:  55000 + AdjustFHEGas,
 			tfhe.FheUint8:  84000 + AdjustFHEGas,
@@ -104,6 +218,20 @@ func DefaultGasCosts() GasCosts {
 			tfhe.FheUint32: 795000 + AdjustFHEGas,
 			tfhe.FheUint64: 1095000 + AdjustFHEGas,
 		},
+		FheDiv: map[tfhe.FheUintType]uint64{
+			tfhe.FheUint4:  610000 + AdjustFHEGas,
+			tfhe.FheUint8:  1210000 + AdjustFHEGas,
+			tfhe.FheUint16: 2430000 + AdjustFHEGas,
+			tfhe.FheUint32: 4870000 + AdjustFHEGas,
+			tfhe.FheUint64: 9750000 + AdjustFHEGas,
+		},
+		FheRem: map[tfhe.FheUintType]uint64{
+			tfhe.FheUint4:  640000 + AdjustFHEGas,
+			tfhe.FheUint8:  1250000 + AdjustFHEGas,
+			tfhe.FheUint16: 2480000 + AdjustFHEGas,
+			tfhe.FheUint32: 4930000 + AdjustFHEGas,
+			tfhe.FheUint64: 9830000 + AdjustFHEGas,
+		},
 		FheShift: map[tfhe.FheUintType]uint64{
 			tfhe.FheUint4:  106000 + AdjustFHEGas,
 			tfhe.FheUint8:  123000 + AdjustFHEGas,
@@ -164,7 +292,7 @@ func DefaultGasCosts() GasCosts {
 			tfhe.FheUint32: 150000 + AdjustFHEGas,
 			tfhe.FheUint64: 189000 + AdjustFHEGas,
 		},
-		// As of now, verification costs only cover ciphertext deserialization and assume there is no ZKPoK to verify.
+		// Verification costs of a single ciphertext. The ZKPoK of the list it comes from is priced separately below.
 		FheVerify: map[tfhe.FheUintType]uint64{
 			tfhe.FheBool:     200 + 5000, // TODO: Requires an FheUint160 comparisson via FheEq. Make it cheaper than that, though. Need to fix that.
 			tfhe.FheUint4:    200 + 500,
@@ -172,9 +300,36 @@ func DefaultGasCosts() GasCosts {
 			tfhe.FheUint16:   300 + 500,
 			tfhe.FheUint32:   400 + 500,
 			tfhe.FheUint64:   800 + 500,
+			tfhe.FheUint128:  1000 + 500,
 			tfhe.FheUint160:  1200 + 500,
 			tfhe.FheUint2048: 2000 + 500,
 		},
+		// Subsequent handles from an already expanded list don't need deserialization.
+		FheVerifyCached: map[tfhe.FheUintType]uint64{
+			tfhe.FheBool:     200 + 4500,
+			tfhe.FheUint4:    200,
+			tfhe.FheUint8:    200,
+			tfhe.FheUint16:   300,
+			tfhe.FheUint32:   400,
+			tfhe.FheUint64:   800,
+			tfhe.FheUint128:  1000,
+			tfhe.FheUint160:  1200,
+			tfhe.FheUint2048: 2000,
+		},
+		// Verifying the ZKPoK of a list and expanding it costs a fixed amount plus an amount proportional to the number
+		// of ciphertexts in the list and their types, as given by the list header.
+		FheVerifyProofBase: 200000 + AdjustFHEGas,
+		FheVerifyProofPerCiphertext: map[tfhe.FheUintType]uint64{
+			tfhe.FheBool:     2000,
+			tfhe.FheUint4:    2000,
+			tfhe.FheUint8:    3000,
+			tfhe.FheUint16:   5000,
+			tfhe.FheUint32:   8000,
+			tfhe.FheUint64:   14000,
+			tfhe.FheUint128:  25000,
+			tfhe.FheUint160:  30000,
+			tfhe.FheUint2048: 300000,
+		},
 		FheTrivialEncrypt: map[tfhe.FheUintType]uint64{
 			tfhe.FheBool:     100,
 			tfhe.FheUint4:    100,
@@ -185,14 +340,29 @@ func DefaultGasCosts() GasCosts {
 			tfhe.FheUint160:  700,
 			tfhe.FheUint2048: 900,
 		},
-		// TODO: These will change once we have an FHE-based random generaration.
+		// Random values are generated homomorphically, one PBS per block. The RNG nonce is updated on every call.
 		FheRand: map[tfhe.FheUintType]uint64{
-			tfhe.FheUint4:  EvmNetSstoreInitGas + 100000,
-			tfhe.FheUint8:  EvmNetSstoreInitGas + 100000,
-			tfhe.FheUint16: EvmNetSstoreInitGas + 100000,
-			tfhe.FheUint32: EvmNetSstoreInitGas + 100000,
-			tfhe.FheUint64: EvmNetSstoreInitGas + 100000,
+			tfhe.FheBool:    EvmNetSstoreInitGas + 30000 + AdjustFHEGas,
+			tfhe.FheUint4:   EvmNetSstoreInitGas + 45000 + AdjustFHEGas,
+			tfhe.FheUint8:   EvmNetSstoreInitGas + 60000 + AdjustFHEGas,
+			tfhe.FheUint16:  EvmNetSstoreInitGas + 75000 + AdjustFHEGas,
+			tfhe.FheUint32:  EvmNetSstoreInitGas + 90000 + AdjustFHEGas,
+			tfhe.FheUint64:  EvmNetSstoreInitGas + 100000 + AdjustFHEGas,
+			tfhe.FheUint128: EvmNetSstoreInitGas + 130000 + AdjustFHEGas,
+			tfhe.FheUint160: EvmNetSstoreInitGas + 150000 + AdjustFHEGas,
+		},
+		// Bounds that are not a power of 2 need a wider random value and a scalar remainder. Priced for the widest
+		// random value that a bound can require for the given type.
+		FheRandBounded: map[tfhe.FheUintType]uint64{
+			tfhe.FheUint4:   EvmNetSstoreInitGas + 1200000 + AdjustFHEGas,
+			tfhe.FheUint8:   EvmNetSstoreInitGas + 1200000 + AdjustFHEGas,
+			tfhe.FheUint16:  EvmNetSstoreInitGas + 1200000 + AdjustFHEGas,
+			tfhe.FheUint32:  EvmNetSstoreInitGas + 2300000 + AdjustFHEGas,
+			tfhe.FheUint64:  EvmNetSstoreInitGas + 2300000 + AdjustFHEGas,
+			tfhe.FheUint128: EvmNetSstoreInitGas + 2800000 + AdjustFHEGas,
+			tfhe.FheUint160: EvmNetSstoreInitGas + 2800000 + AdjustFHEGas,
 		},
+		FheRandBoundedWide: EvmNetSstoreInitGas + 6000000 + AdjustFHEGas,
 		FheIfThenElse: map[tfhe.FheUintType]uint64{
 			tfhe.FheUint4:  35000 + AdjustFHEGas,
 			tfhe.FheUint8:  37000 + AdjustFHEGas,
@@ -209,31 +379,35 @@ func DefaultGasCosts() GasCosts {
 			tfhe.FheUint160:  50000,
 			tfhe.FheUint2048: 100000,
 		},
-		// TODO: The values here are chosen somewhat arbitrarily.
-		// Also, we don't take into account whether a ciphertext existed (either "current" or "original") for the given handle.
+		// Ciphertexts are persisted compressed, so storage costs follow the compressed sizes. Compression packs the
+		// blocks of a ciphertext together, so small types take about as much space as a FheUint4 and bigger types
+		// grow with their number of blocks.
+		// TODO: We don't take into account whether a ciphertext existed (either "current" or "original") for the given handle.
 		// Finally, costs are likely to change in the future.
 		FheStorageSstoreGas: map[tfhe.FheUintType]uint64{
-			tfhe.FheBool:     SstoreFheUint4Gas / 2,
+			tfhe.FheBool:     SstoreFheUint4Gas,
 			tfhe.FheUint4:    SstoreFheUint4Gas,
-			tfhe.FheUint8:    SstoreFheUint4Gas * 2,
-			tfhe.FheUint16:   SstoreFheUint4Gas * 4,
-			tfhe.FheUint32:   SstoreFheUint4Gas * 8,
-			tfhe.FheUint64:   SstoreFheUint4Gas * 16,
-			tfhe.FheUint128:  SstoreFheUint4Gas * 32,
-			tfhe.FheUint160:  SstoreFheUint4Gas * 40,
-			tfhe.FheUint2048: SstoreFheUint4Gas * 120,
+			tfhe.FheUint8:    SstoreFheUint4Gas,
+			tfhe.FheUint16:   SstoreFheUint4Gas * 2,
+			tfhe.FheUint32:   SstoreFheUint4Gas * 3,
+			tfhe.FheUint64:   SstoreFheUint4Gas * 5,
+			tfhe.FheUint128:  SstoreFheUint4Gas * 9,
+			tfhe.FheUint160:  SstoreFheUint4Gas * 11,
+			tfhe.FheUint2048: SstoreFheUint4Gas * 130,
 		},
+		// Loads pay for decompression on top of reading the compressed ciphertext.
 		FheStorageSloadGas: map[tfhe.FheUintType]uint64{
-			tfhe.FheBool:     SloadFheUint4Gas / 2,
-			tfhe.FheUint4:    SloadFheUint4Gas,
-			tfhe.FheUint8:    SloadFheUint4Gas * 2,
-			tfhe.FheUint16:   SloadFheUint4Gas * 4,
-			tfhe.FheUint32:   SloadFheUint4Gas * 8,
-			tfhe.FheUint64:   SloadFheUint4Gas * 16,
-			tfhe.FheUint128:  SloadFheUint4Gas * 32,
-			tfhe.FheUint160:  SloadFheUint4Gas * 40,
-			tfhe.FheUint2048: SloadFheUint4Gas * 120, // TODO: technically, it is more than 10 times bigger than 160 bits
+			tfhe.FheBool:     SloadFheUint4Gas + DecompressCiphertextGas,
+			tfhe.FheUint4:    SloadFheUint4Gas + DecompressCiphertextGas,
+			tfhe.FheUint8:    SloadFheUint4Gas + DecompressCiphertextGas,
+			tfhe.FheUint16:   SloadFheUint4Gas*2 + DecompressCiphertextGas,
+			tfhe.FheUint32:   SloadFheUint4Gas*3 + DecompressCiphertextGas,
+			tfhe.FheUint64:   SloadFheUint4Gas*5 + DecompressCiphertextGas,
+			tfhe.FheUint128:  SloadFheUint4Gas*9 + DecompressCiphertextGas,
+			tfhe.FheUint160:  SloadFheUint4Gas*11 + DecompressCiphertextGas,
+			tfhe.FheUint2048: SloadFheUint4Gas*130 + DecompressCiphertextGas,
 		},
+		FheStorageSloadUncompressedWordGas: SloadUncompressedCiphertextWordGas,
 	}
 }
 
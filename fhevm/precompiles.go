@@ -5,24 +5,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
 
 	"PureChain/common"
 	"go.opentelemetry.io/otel"
 )
 
-// Only the TFHEExecutor contract is allowed to call the FheLib precompile.
-// Safe calls are exception from above, e.g. fhePubKey and getCiphertext.
-var tfheExecutorContractAddress common.Address
-
-func init() {
-	addr, found := os.LookupEnv("TFHE_EXECUTOR_CONTRACT_ADDRESS")
-	if !found {
-		panic("TFHE_EXECUTOR_CONTRACT_ADDRESS not found")
-	}
-	tfheExecutorContractAddress = common.HexToAddress(addr)
-}
-
 func FheLibRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 	logger := environment.GetLogger()
 	if len(input) < 4 {
@@ -39,9 +26,9 @@ func FheLibRequiredGas(environment EVMEnvironment, input []byte) uint64 {
 		logger.Error("fheLib precompile error", "err", err, "input", hex.EncodeToString(input))
 		return 0
 	}
-	// we remove function signature
-	input = input[4:]
-	return fheLibMethod.RequiredGas(environment, input)
+	gas := fheLibMethod.RequiredGas(environment, input[4:])
+	environment.FhevmData().pricedFheLibCall = pricedFheLibCall{input: input, gas: gas}
+	return gas
 }
 
 func FheLibRun(environment EVMEnvironment, caller common.Address, addr common.Address, input []byte, readOnly bool) (ret []byte, err error) {
@@ -62,14 +49,26 @@ func FheLibRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 	}
 
 	// Only allow safe methods from any caller. We do that to avoid changing infrastructure.
+	// Only the TFHEExecutor contract is allowed to call the FheLib precompile.
+	// Safe calls are exception from above, e.g. fhePubKey, the key info methods and getCiphertext.
+	tfheExecutorContractAddress := environment.FhevmParams().TfheExecutorContractAddress
 	if !isSafeFromAnyCaller(fheLibMethod.name) && caller != tfheExecutorContractAddress {
 		err := fmt.Errorf("called from address %s which is not the expected TFHEExecutor address %s", caller.Hex(), tfheExecutorContractAddress.Hex())
 		logger.Error(err.Error())
 		return nil, err
 	}
 
+	// FHE compute limits are checked before running the method, such that calls exceeding them don't compute
+	// anything. Units are only consumed by calls that succeed.
+	computeUnits := fheLibMethod.ComputeUnits(environment, fheLibCallGas(environment, fheLibMethod, input))
+	if err := checkFheComputeUnits(environment, computeUnits); err != nil {
+		logger.Error("fheLib precompile error", "err", err, "method", fheLibMethod.name)
+		return nil, err
+	}
+
 	// remove function signature
 	input = input[4:]
+
 	// trace function execution
 
 	if ctx := environment.OtelContext(); ctx != nil {
@@ -82,6 +81,9 @@ func FheLibRun(environment EVMEnvironment, caller common.Address, addr common.Ad
 	} else {
 		ret, err = fheLibMethod.Run(environment, caller, addr, input, readOnly, nil)
 	}
+	if err == nil {
+		consumeFheComputeUnits(environment, computeUnits)
+	}
 
 	return
 }
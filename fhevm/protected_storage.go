@@ -0,0 +1,149 @@
+package fhevm
+
+import (
+	"math/big"
+
+	"PureChain/common"
+	"PureChain/crypto"
+	"github.com/holiman/uint256"
+	fhevm_crypto "github.com/lukadas12345/rfhevm/fhevm/crypto"
+	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
+)
+
+// Every contract gets a protected storage contract, created alongside it and destroyed with it.
+// The protected storage can only be written by fhevm-go and holds per-contract FHE state.
+//
+// Layout of the protected storage:
+//   - slot 0: the RNG nonce, see `rngNonceKey`
+//   - slot 1: the protected storage metadata, see `protectedStorageMetadata`
+
+const protectedStorageVersion uint64 = 1
+
+var protectedStorageMetadataKey [32]byte = uint256.NewInt(1).Bytes32()
+
+var big0 = big.NewInt(0)
+
+// Protected storage metadata is stored in a single 32-byte slot.
+// Currently, we only utilize 12 bytes from the slot.
+type protectedStorageMetadata struct {
+	// Non-zero if the protected storage has been created.
+	version uint64
+	// Key set that was active when the contract was deployed, see tfhe.KeySet.
+	keySetId uint32
+}
+
+func (m protectedStorageMetadata) serialize() [32]byte {
+	u := uint256.NewInt(0)
+	u[0] = m.version
+	u[1] = uint64(m.keySetId)
+	return u.Bytes32()
+}
+
+func (m *protectedStorageMetadata) deserialize(buf [32]byte) *protectedStorageMetadata {
+	u := uint256.NewInt(0)
+	u.SetBytes(buf[:])
+	m.version = u[0]
+	m.keySetId = uint32(u[1])
+	return m
+}
+
+// Returns the protected storage metadata of the given contract or nil if the contract has no protected storage.
+func loadProtectedStorageMetadata(env EVMEnvironment, contract common.Address) *protectedStorageMetadata {
+	protectedStorage := fhevm_crypto.CreateProtectedStorageContractAddress(contract)
+	metadataInt := newInt(env.GetState(protectedStorage, protectedStorageMetadataKey).Bytes())
+	if metadataInt.IsZero() {
+		return nil
+	}
+	m := protectedStorageMetadata{}
+	return m.deserialize(metadataInt.Bytes32())
+}
+
+func storeProtectedStorageMetadata(env EVMEnvironment, contract common.Address, m *protectedStorageMetadata) {
+	protectedStorage := fhevm_crypto.CreateProtectedStorageContractAddress(contract)
+	env.SetState(protectedStorage, protectedStorageMetadataKey, m.serialize())
+}
+
+// Returns the key set that was active when `contract` was deployed, if it has a protected storage.
+func ContractKeySetId(env EVMEnvironment, contract common.Address) (uint32, bool) {
+	metadata := loadProtectedStorageMetadata(env, contract)
+	if metadata == nil {
+		return 0, false
+	}
+	return metadata.keySetId, true
+}
+
+// Creates the protected storage of `contractAddr` if it doesn't exist yet.
+func createProtectedStorage(env EVMEnvironment, contractAddr common.Address, gas uint64) (leftOverGas uint64, err error) {
+	protectedStorage := fhevm_crypto.CreateProtectedStorageContractAddress(contractAddr)
+	if env.GetNonce(protectedStorage) != 0 {
+		return gas, nil
+	}
+	_, _, leftOverGas, err = env.CreateContract(protectedStorageAddrCallerAddr, nil, gas, big0, protectedStorage)
+	if err != nil {
+		return leftOverGas, err
+	}
+	storeProtectedStorageMetadata(env, contractAddr, &protectedStorageMetadata{
+		version:  protectedStorageVersion,
+		keySetId: tfhe.GetKeySetId(),
+	})
+	return leftOverGas, nil
+}
+
+// Creates the protected storage of `contractAddr`, then the contract itself with `create`, within the same snapshot,
+// such that the protected storage exists before the constructor runs and either both are created or none is. A
+// failed creation still increments the nonce of `caller`, as when the host creates a contract directly.
+func createWithProtectedStorage(env EVMEnvironment, caller common.Address, contractAddr common.Address, gas uint64,
+	create func(gas uint64) ([]byte, common.Address, uint64, error)) (ret []byte, addr common.Address, leftOverGas uint64, err error) {
+	snapshot := env.Snapshot()
+	leftOverGas, err = createProtectedStorage(env, contractAddr, gas)
+	if err != nil {
+		env.RevertToSnapshot(snapshot)
+		env.GetLogger().Error("failed to create protected storage", "contract", contractAddr.Hex(), "err", err)
+		// Fails like a collision on the contract address, which consumes all gas.
+		if nonce := env.GetNonce(caller); nonce+1 != 0 {
+			env.SetNonce(caller, nonce+1)
+		}
+		return nil, common.Address{}, 0, err
+	}
+	ret, addr, leftOverGas, err = create(leftOverGas)
+	if err != nil {
+		nonce := env.GetNonce(caller)
+		env.RevertToSnapshot(snapshot)
+		env.SetNonce(caller, nonce)
+	}
+	return ret, addr, leftOverGas, err
+}
+
+// Creates a contract at the address derived from `caller` and its nonce, together with its protected storage.
+// It should be called by the host instead of creating the contract directly.
+func Create(env EVMEnvironment, caller common.Address, code []byte, gas uint64, value *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
+	contractAddr = crypto.CreateAddress(caller, env.GetNonce(caller))
+	return createWithProtectedStorage(env, caller, contractAddr, gas, func(gas uint64) ([]byte, common.Address, uint64, error) {
+		return env.CreateContract(caller, code, gas, value, contractAddr)
+	})
+}
+
+// Same as Create(), but the contract address is derived from `caller`, `salt` and the hash of `code`.
+func Create2(env EVMEnvironment, caller common.Address, code []byte, gas uint64, endowment *big.Int, salt *uint256.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
+	codeHash := crypto.Keccak256Hash(code)
+	contractAddr = crypto.CreateAddress2(caller, salt.Bytes32(), codeHash.Bytes())
+	return createWithProtectedStorage(env, caller, contractAddr, gas, func(gas uint64) ([]byte, common.Address, uint64, error) {
+		return env.CreateContract2(caller, code, codeHash, gas, endowment, contractAddr)
+	})
+}
+
+// Returns the gas of destroying the protected storage of `contract` on SELFDESTRUCT, on top of the gas the host
+// charges for the contract itself: the protected storage account is touched cold and destroyed like the contract, and
+// its balance creates `beneficiary` if nothing else does.
+func SelfdestructProtectedStorageGas(env EVMEnvironment, contract common.Address, beneficiary common.Address) uint64 {
+	protectedStorage := fhevm_crypto.CreateProtectedStorageContractAddress(contract)
+	if env.GetNonce(protectedStorage) == 0 {
+		return 0
+	}
+	gas := ColdAccountAccessCostEIP2929 + SelfdestructGasEIP150
+	beneficiaryEmpty := env.GetNonce(beneficiary) == 0 && env.GetBalance(beneficiary).Sign() == 0
+	if beneficiaryEmpty && env.GetBalance(contract).Sign() == 0 && env.GetBalance(protectedStorage).Sign() != 0 {
+		gas += CreateBySelfdestructGas
+	}
+	return gas
+}
@@ -0,0 +1,152 @@
+package fhevm
+
+import (
+	"container/list"
+	"encoding/binary"
+	"math/big"
+	"sync"
+
+	"PureChain/common"
+	"PureChain/crypto"
+	"github.com/lukadas12345/rfhevm/fhevm/tfhe"
+)
+
+// A node-level cache of the results of FHE operations, shared by all EVM instances the same FhevmParams are given to.
+// Results only depend on the operation, the operands, the scalar and the key set, so the same operations computed
+// again by eth_call, tracing or re-executions of blocks are served from the cache. It is bounded by the size of the
+// serialized results it holds, the least recently used ones being evicted first, and is safe for concurrent use.
+type ResultCache struct {
+	mu       sync.Mutex
+	maxBytes uint64
+	bytes    uint64
+	// Entries, least recently used first.
+	lru     *list.List
+	entries map[common.Hash]*list.Element
+	stats   ResultCacheStats
+}
+
+// Counters of a ResultCache, see ResultCache.Stats().
+type ResultCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     uint64
+}
+
+type resultCacheEntry struct {
+	key           common.Hash
+	serialization []byte
+	hash          common.Hash
+	fheUintType   tfhe.FheUintType
+	keySetId      uint32
+}
+
+func NewResultCache(maxBytes uint64) *ResultCache {
+	return &ResultCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[common.Hash]*list.Element),
+	}
+}
+
+// Returns a snapshot of the counters of the cache.
+func (c *ResultCache) Stats() ResultCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// Returns a copy of the result cached under `key`, if any, and counts a hit or a miss.
+func (c *ResultCache) get(key common.Hash) (*tfhe.TfheCiphertext, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.entries[key]
+	if !found {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToBack(elem)
+	entry := elem.Value.(*resultCacheEntry)
+	// Results are handed out to several EVM instances, which must not share the serialization.
+	hash := entry.hash
+	return &tfhe.TfheCiphertext{
+		Serialization: common.CopyBytes(entry.serialization),
+		Hash:          &hash,
+		FheUintType:   entry.fheUintType,
+		KeySetId:      entry.keySetId,
+	}, true
+}
+
+// Caches `result` under `key`, evicting the least recently used results to make room for it. Results bigger than the
+// cache are not cached.
+func (c *ResultCache) insert(key common.Hash, result *tfhe.TfheCiphertext) {
+	entry := &resultCacheEntry{
+		key:           key,
+		serialization: common.CopyBytes(result.Serialize()),
+		hash:          result.GetHash(),
+		fheUintType:   result.FheUintType,
+		keySetId:      result.KeySetId,
+	}
+	size := uint64(len(entry.serialization))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, found := c.entries[key]; found || size > c.maxBytes {
+		return
+	}
+	for c.bytes+size > c.maxBytes {
+		evicted := c.lru.Remove(c.lru.Front()).(*resultCacheEntry)
+		delete(c.entries, evicted.key)
+		c.bytes -= uint64(len(evicted.serialization))
+		c.stats.Evictions++
+	}
+	c.entries[key] = c.lru.PushBack(entry)
+	c.bytes += size
+}
+
+// Returns the key the result of `op` on `operands` is cached under. `scalar` is the plaintext operand of scalar
+// operations, or any other plaintext the result depends on, and nil otherwise. `op` must identify the computation,
+// e.g. "ScalarLeftSub" rather than "fheSub", as results of the same method can differ.
+func resultCacheKey(op string, scalar *big.Int, operands ...*tfhe.TfheCiphertext) common.Hash {
+	data := make([]byte, 0, 64+len(operands)*36)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(op)))
+	data = append(data, op...)
+	if scalar != nil {
+		scalarBytes := scalar.Bytes()
+		data = binary.BigEndian.AppendUint32(data, uint32(len(scalarBytes)))
+		data = append(data, scalarBytes...)
+	} else {
+		// Distinguishes a nil scalar from a zero one.
+		data = binary.BigEndian.AppendUint32(data, ^uint32(0))
+	}
+	for _, ct := range operands {
+		hash := ct.GetHash()
+		data = append(data, hash[:]...)
+		data = binary.BigEndian.AppendUint32(data, ct.KeySetId)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
+// Returns the result of `compute`, from the result cache of the environment if it is enabled and has it, see
+// resultCacheKey() for `op`, `scalar` and `operands`. Only meant for deterministic computations on the operands.
+func memoizeResult(environment EVMEnvironment, op string, scalar *big.Int, operands []*tfhe.TfheCiphertext,
+	compute func() (*tfhe.TfheCiphertext, error)) (*tfhe.TfheCiphertext, error) {
+	cache := environment.FhevmParams().ResultCache
+	if cache == nil {
+		return compute()
+	}
+	key := resultCacheKey(op, scalar, operands...)
+	if result, found := cache.get(key); found {
+		return result, nil
+	}
+	result, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	cache.insert(key, result)
+	return result, nil
+}
@@ -5,6 +5,8 @@ package tfhe
 */
 import "C"
 import (
+	"container/list"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math/big"
@@ -92,9 +94,20 @@ func IsValidFheType(t byte) bool {
 
 // Represents an expanded TFHE ciphertext.
 type TfheCiphertext struct {
+	// Serialized ciphertext. It is nil for results of operations held by a NativeCiphertextCache that were not
+	// serialized yet, so it must be read with Serialize().
 	Serialization []byte
 	Hash          *common.Hash
 	FheUintType   FheUintType
+	// Key set the ciphertext is encrypted under, see KeySet.
+	KeySetId uint32
+
+	// Native ciphertext held by nativeCache, if any, see NativeCiphertextCache.
+	native      unsafe.Pointer
+	nativeCache *NativeCiphertextCache
+	nativeElem  *list.Element
+	// Number of operations using the native ciphertext, which can't be evicted while in use.
+	pins int
 }
 
 func (ct *TfheCiphertext) Type() FheUintType {
@@ -144,6 +157,8 @@ func Deserialize(in []byte, t FheUintType) unsafe.Pointer {
 		return C.deserialize_fhe_uint32(toDynamicBufferView(in))
 	case FheUint64:
 		return C.deserialize_fhe_uint64(toDynamicBufferView(in))
+	case FheUint128:
+		return C.deserialize_fhe_uint128(toDynamicBufferView(in))
 	case FheUint160:
 		return C.deserialize_fhe_uint160(toDynamicBufferView(in))
 	case FheUint2048:
@@ -168,6 +183,8 @@ func destroyCiphertext(ptr unsafe.Pointer, t FheUintType) {
 		C.destroy_fhe_uint32(ptr)
 	case FheUint64:
 		C.destroy_fhe_uint64(ptr)
+	case FheUint128:
+		C.destroy_fhe_uint128(ptr)
 	case FheUint160:
 		C.destroy_fhe_uint160(ptr)
 	case FheUint2048:
@@ -182,7 +199,8 @@ func (ct *TfheCiphertext) DeserializeToPtr() unsafe.Pointer {
 	return Deserialize(ct.Serialize(), ct.FheUintType)
 }
 
-// Deserializes a TFHE ciphertext.
+// Deserializes a TFHE ciphertext. Only meant for ciphertexts produced by this node, e.g. loaded from protected
+// storage. Untrusted ciphertexts must go through DeserializeCompact() or a compact list expander.
 func (ct *TfheCiphertext) Deserialize(in []byte, t FheUintType) error {
 	ptr := Deserialize(in, t)
 	if ptr == nil {
@@ -191,6 +209,7 @@ func (ct *TfheCiphertext) Deserialize(in []byte, t FheUintType) error {
 	destroyCiphertext(ptr, t)
 	ct.FheUintType = t
 	ct.Serialization = in
+	ct.KeySetId = currentKeySet().id
 	ct.computeHash()
 	return nil
 }
@@ -198,12 +217,18 @@ func (ct *TfheCiphertext) Deserialize(in []byte, t FheUintType) error {
 // Deserializes a compact TFHE ciphetext.
 // Note: After the compact TFHE ciphertext has been serialized, subsequent calls to serialize()
 // will produce non-compact ciphertext serialziations.
-func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType) error {
+// The input is untrusted: it must have been produced by tfhe-rs safe serialization, must not exceed
+// `sizeLimit` bytes and its parameters must conform to the loaded server key.
+func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType, sizeLimit uint64) error {
+	ks := currentKeySet()
+	if err := checkInputSize(in, sizeLimit); err != nil {
+		return err
+	}
 	switch t {
 	case FheBool:
-		ptr := C.deserialize_compact_fhe_bool(toDynamicBufferView((in)))
+		ptr := C.deserialize_compact_fhe_bool(toDynamicBufferView(in), C.uint64_t(sizeLimit), ks.sks)
 		if ptr == nil {
-			return errors.New("compact FheBool ciphertext deserialization failed")
+			return fmt.Errorf("%w: compact FheBool ciphertext", ErrInvalidSerialization)
 		}
 		var err error
 		ct.Serialization, err = serialize(ptr, t)
@@ -212,9 +237,9 @@ func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType) error {
 			return err
 		}
 	case FheUint4:
-		ptr := C.deserialize_compact_fhe_uint4(toDynamicBufferView((in)))
+		ptr := C.deserialize_compact_fhe_uint4(toDynamicBufferView(in), C.uint64_t(sizeLimit), ks.sks)
 		if ptr == nil {
-			return errors.New("compact FheUint4 ciphertext deserialization failed")
+			return fmt.Errorf("%w: compact FheUint4 ciphertext", ErrInvalidSerialization)
 		}
 		var err error
 		ct.Serialization, err = serialize(ptr, t)
@@ -223,9 +248,9 @@ func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType) error {
 			return err
 		}
 	case FheUint8:
-		ptr := C.deserialize_compact_fhe_uint8(toDynamicBufferView((in)))
+		ptr := C.deserialize_compact_fhe_uint8(toDynamicBufferView(in), C.uint64_t(sizeLimit), ks.sks)
 		if ptr == nil {
-			return errors.New("compact FheUint8 ciphertext deserialization failed")
+			return fmt.Errorf("%w: compact FheUint8 ciphertext", ErrInvalidSerialization)
 		}
 		var err error
 		ct.Serialization, err = serialize(ptr, t)
@@ -234,9 +259,9 @@ func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType) error {
 			return err
 		}
 	case FheUint16:
-		ptr := C.deserialize_compact_fhe_uint16(toDynamicBufferView((in)))
+		ptr := C.deserialize_compact_fhe_uint16(toDynamicBufferView(in), C.uint64_t(sizeLimit), ks.sks)
 		if ptr == nil {
-			return errors.New("compact FheUint16 ciphertext deserialization failed")
+			return fmt.Errorf("%w: compact FheUint16 ciphertext", ErrInvalidSerialization)
 		}
 		var err error
 		ct.Serialization, err = serialize(ptr, t)
@@ -245,9 +270,9 @@ func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType) error {
 			return err
 		}
 	case FheUint32:
-		ptr := C.deserialize_compact_fhe_uint32(toDynamicBufferView((in)))
+		ptr := C.deserialize_compact_fhe_uint32(toDynamicBufferView(in), C.uint64_t(sizeLimit), ks.sks)
 		if ptr == nil {
-			return errors.New("compact FheUint32 ciphertext deserialization failed")
+			return fmt.Errorf("%w: compact FheUint32 ciphertext", ErrInvalidSerialization)
 		}
 		var err error
 		ct.Serialization, err = serialize(ptr, t)
@@ -256,9 +281,9 @@ func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType) error {
 			return err
 		}
 	case FheUint64:
-		ptr := C.deserialize_compact_fhe_uint64(toDynamicBufferView((in)))
+		ptr := C.deserialize_compact_fhe_uint64(toDynamicBufferView(in), C.uint64_t(sizeLimit), ks.sks)
 		if ptr == nil {
-			return errors.New("compact FheUint64 ciphertext deserialization failed")
+			return fmt.Errorf("%w: compact FheUint64 ciphertext", ErrInvalidSerialization)
 		}
 		var err error
 		ct.Serialization, err = serialize(ptr, t)
@@ -267,9 +292,9 @@ func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType) error {
 			return err
 		}
 	case FheUint160:
-		ptr := C.deserialize_compact_fhe_uint160(toDynamicBufferView((in)))
+		ptr := C.deserialize_compact_fhe_uint160(toDynamicBufferView(in), C.uint64_t(sizeLimit), ks.sks)
 		if ptr == nil {
-			return errors.New("compact FheUint160 ciphertext deserialization failed")
+			return fmt.Errorf("%w: compact FheUint160 ciphertext", ErrInvalidSerialization)
 		}
 		var err error
 		ct.Serialization, err = serialize(ptr, t)
@@ -278,9 +303,9 @@ func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType) error {
 			return err
 		}
 	case FheUint2048:
-		ptr := C.deserialize_compact_fhe_uint2048(toDynamicBufferView((in)))
+		ptr := C.deserialize_compact_fhe_uint2048(toDynamicBufferView(in), C.uint64_t(sizeLimit), ks.sks)
 		if ptr == nil {
-			return errors.New("compact FheUint2048 ciphertext deserialization failed")
+			return fmt.Errorf("%w: compact FheUint2048 ciphertext", ErrInvalidSerialization)
 		}
 		var err error
 		ct.Serialization, err = serialize(ptr, t)
@@ -292,6 +317,110 @@ func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType) error {
 		panic("deserializeCompact: unexpected ciphertext type")
 	}
 	ct.FheUintType = t
+	ct.KeySetId = ks.id
+	ct.computeHash()
+	return nil
+}
+
+// Serializes the ciphertext in compressed form, e.g. for persisting it. The result is much smaller than the regular
+// serialization, but it has to be decompressed with DeserializeCompressed() before use.
+func (ct *TfheCiphertext) SerializeCompressed() ([]byte, error) {
+	sks, err := serverKeyOf(ct)
+	if err != nil {
+		return nil, err
+	}
+	ptr, release := ct.borrowNative()
+	if ptr == nil {
+		return nil, fmt.Errorf("%s ciphertext deserialization failed", ct.FheUintType)
+	}
+	defer release()
+	out := &C.DynamicBuffer{}
+	var ret C.int
+	switch ct.FheUintType {
+	case FheBool:
+		ret = C.compress_fhe_bool(ptr, sks, out)
+	case FheUint4:
+		ret = C.compress_fhe_uint4(ptr, sks, out)
+	case FheUint8:
+		ret = C.compress_fhe_uint8(ptr, sks, out)
+	case FheUint16:
+		ret = C.compress_fhe_uint16(ptr, sks, out)
+	case FheUint32:
+		ret = C.compress_fhe_uint32(ptr, sks, out)
+	case FheUint64:
+		ret = C.compress_fhe_uint64(ptr, sks, out)
+	case FheUint128:
+		ret = C.compress_fhe_uint128(ptr, sks, out)
+	case FheUint160:
+		ret = C.compress_fhe_uint160(ptr, sks, out)
+	case FheUint2048:
+		ret = C.compress_fhe_uint2048(ptr, sks, out)
+	default:
+		panic("SerializeCompressed: unexpected ciphertext type")
+	}
+	if ret != 0 {
+		return nil, fmt.Errorf("%s ciphertext compression failed with %d", ct.FheUintType, ret)
+	}
+	ser := C.GoBytes(unsafe.Pointer(out.pointer), C.int(out.length))
+	C.destroy_dynamic_buffer(out)
+	return ser, nil
+}
+
+// Deserializes and decompresses a ciphertext produced by SerializeCompressed() under the active key set.
+func (ct *TfheCiphertext) DeserializeCompressed(in []byte, t FheUintType) error {
+	return ct.deserializeCompressed(in, t, currentKeySet())
+}
+
+// Deserializes and decompresses a ciphertext produced by SerializeCompressed() under the registered key set
+// `keySetId`.
+func (ct *TfheCiphertext) DeserializeCompressedWithKeySet(in []byte, t FheUintType, keySetId uint32) error {
+	ks, found := GetKeySet(keySetId)
+	if !found {
+		return fmt.Errorf("%w: %08x", ErrUnknownKeySet, keySetId)
+	}
+	return ct.deserializeCompressed(in, t, ks)
+}
+
+func (ct *TfheCiphertext) deserializeCompressed(in []byte, t FheUintType, ks *KeySet) error {
+	sks := ks.sks
+	if len(in) == 0 {
+		return fmt.Errorf("%w: empty compressed %s ciphertext", ErrInvalidInputSize, t)
+	}
+	view := toDynamicBufferView(in)
+	var ptr unsafe.Pointer
+	switch t {
+	case FheBool:
+		ptr = C.decompress_fhe_bool(view, sks)
+	case FheUint4:
+		ptr = C.decompress_fhe_uint4(view, sks)
+	case FheUint8:
+		ptr = C.decompress_fhe_uint8(view, sks)
+	case FheUint16:
+		ptr = C.decompress_fhe_uint16(view, sks)
+	case FheUint32:
+		ptr = C.decompress_fhe_uint32(view, sks)
+	case FheUint64:
+		ptr = C.decompress_fhe_uint64(view, sks)
+	case FheUint128:
+		ptr = C.decompress_fhe_uint128(view, sks)
+	case FheUint160:
+		ptr = C.decompress_fhe_uint160(view, sks)
+	case FheUint2048:
+		ptr = C.decompress_fhe_uint2048(view, sks)
+	default:
+		panic("DeserializeCompressed: unexpected ciphertext type")
+	}
+	if ptr == nil {
+		return fmt.Errorf("compressed %s ciphertext decompression failed", t)
+	}
+	var err error
+	ct.Serialization, err = serialize(ptr, t)
+	destroyCiphertext(ptr, t)
+	if err != nil {
+		return err
+	}
+	ct.FheUintType = t
+	ct.KeySetId = ks.id
 	ct.computeHash()
 	return nil
 }
@@ -299,6 +428,7 @@ func (ct *TfheCiphertext) DeserializeCompact(in []byte, t FheUintType) error {
 // Encrypts a value as a TFHE ciphertext, using the compact public FHE key.
 // The resulting ciphertext is automaticaly expanded.
 func (ct *TfheCiphertext) Encrypt(value big.Int, t FheUintType) *TfheCiphertext {
+	ks := currentKeySet()
 	var ptr unsafe.Pointer
 	var err error
 	switch t {
@@ -307,53 +437,64 @@ func (ct *TfheCiphertext) Encrypt(value big.Int, t FheUintType) *TfheCiphertext
 		if value.Uint64() > 0 {
 			val = true
 		}
-		ptr = C.public_key_encrypt_fhe_bool(pks, C.bool(val))
+		ptr = C.public_key_encrypt_fhe_bool(ks.pks, C.bool(val))
 		ct.Serialization, err = serialize(ptr, t)
 		C.destroy_fhe_bool(ptr)
 		if err != nil {
 			panic(err)
 		}
 	case FheUint4:
-		ptr = C.public_key_encrypt_fhe_uint4(pks, C.uint8_t(value.Uint64()))
+		ptr = C.public_key_encrypt_fhe_uint4(ks.pks, C.uint8_t(value.Uint64()))
 		ct.Serialization, err = serialize(ptr, t)
 		C.destroy_fhe_uint4(ptr)
 		if err != nil {
 			panic(err)
 		}
 	case FheUint8:
-		ptr = C.public_key_encrypt_fhe_uint8(pks, C.uint8_t(value.Uint64()))
+		ptr = C.public_key_encrypt_fhe_uint8(ks.pks, C.uint8_t(value.Uint64()))
 		ct.Serialization, err = serialize(ptr, t)
 		C.destroy_fhe_uint8(ptr)
 		if err != nil {
 			panic(err)
 		}
 	case FheUint16:
-		ptr = C.public_key_encrypt_fhe_uint16(pks, C.uint16_t(value.Uint64()))
+		ptr = C.public_key_encrypt_fhe_uint16(ks.pks, C.uint16_t(value.Uint64()))
 		ct.Serialization, err = serialize(ptr, t)
 		C.destroy_fhe_uint16(ptr)
 		if err != nil {
 			panic(err)
 		}
 	case FheUint32:
-		ptr = C.public_key_encrypt_fhe_uint32(pks, C.uint32_t(value.Uint64()))
+		ptr = C.public_key_encrypt_fhe_uint32(ks.pks, C.uint32_t(value.Uint64()))
 		ct.Serialization, err = serialize(ptr, t)
 		C.destroy_fhe_uint32(ptr)
 		if err != nil {
 			panic(err)
 		}
 	case FheUint64:
-		ptr = C.public_key_encrypt_fhe_uint64(pks, C.uint64_t(value.Uint64()))
+		ptr = C.public_key_encrypt_fhe_uint64(ks.pks, C.uint64_t(value.Uint64()))
 		ct.Serialization, err = serialize(ptr, t)
 		C.destroy_fhe_uint64(ptr)
 		if err != nil {
 			panic(err)
 		}
+	case FheUint128:
+		input, err := bigIntToU128(&value)
+		if err != nil {
+			panic(err)
+		}
+		ptr = C.public_key_encrypt_fhe_uint128(ks.pks, input)
+		ct.Serialization, err = serialize(ptr, t)
+		C.destroy_fhe_uint128(ptr)
+		if err != nil {
+			panic(err)
+		}
 	case FheUint160:
 		input, err := bigIntToU256(&value)
 		if err != nil {
 			panic(err)
 		}
-		ptr = C.public_key_encrypt_fhe_uint160(pks, input)
+		ptr = C.public_key_encrypt_fhe_uint160(ks.pks, input)
 		ct.Serialization, err = serialize(ptr, t)
 		C.destroy_fhe_uint160(ptr)
 		if err != nil {
@@ -364,7 +505,7 @@ func (ct *TfheCiphertext) Encrypt(value big.Int, t FheUintType) *TfheCiphertext
 		if err != nil {
 			panic(err)
 		}
-		ptr = C.public_key_encrypt_fhe_uint2048(pks, input)
+		ptr = C.public_key_encrypt_fhe_uint2048(ks.pks, input)
 		ct.Serialization, err = serialize(ptr, t)
 		C.destroy_fhe_uint2048(ptr)
 		if err != nil {
@@ -374,11 +515,18 @@ func (ct *TfheCiphertext) Encrypt(value big.Int, t FheUintType) *TfheCiphertext
 		panic("encrypt: unexpected ciphertext type")
 	}
 	ct.FheUintType = t
+	ct.KeySetId = ks.id
 	ct.computeHash()
 	return ct
 }
 
+// Trivially encrypts `value` under the active key set.
 func (ct *TfheCiphertext) TrivialEncrypt(value big.Int, t FheUintType) *TfheCiphertext {
+	return ct.trivialEncrypt(value, t, currentKeySet())
+}
+
+func (ct *TfheCiphertext) trivialEncrypt(value big.Int, t FheUintType, ks *KeySet) *TfheCiphertext {
+	sks := ks.sks
 	var ptr unsafe.Pointer
 	var err error
 	switch t {
@@ -428,6 +576,17 @@ func (ct *TfheCiphertext) TrivialEncrypt(value big.Int, t FheUintType) *TfheCiph
 		if err != nil {
 			panic(err)
 		}
+	case FheUint128:
+		input, err := bigIntToU128(&value)
+		if err != nil {
+			panic(err)
+		}
+		ptr = C.trivial_encrypt_fhe_uint128(sks, input)
+		ct.Serialization, err = serialize(ptr, t)
+		C.destroy_fhe_uint128(ptr)
+		if err != nil {
+			panic(err)
+		}
 	case FheUint160:
 		input, err := bigIntToU256(&value)
 		if err != nil {
@@ -454,11 +613,297 @@ func (ct *TfheCiphertext) TrivialEncrypt(value big.Int, t FheUintType) *TfheCiph
 		panic("trivialEncrypt: unexpected ciphertext type")
 	}
 	ct.FheUintType = t
+	ct.KeySetId = ks.id
 	ct.computeHash()
 	return ct
 }
 
+// Generates an encrypted pseudo-random value of type `t`, computed homomorphically with the server key from `seed`.
+// The result is deterministic for a given seed and key set, but its plaintext value is only known to the holder of
+// the client key, even if the seed is public. If `randomBits` is not nil, the result is in the [0, 2^randomBits) range.
+func (ct *TfheCiphertext) GenerateRandom(seed [16]byte, t FheUintType, randomBits *uint64) error {
+	ks := currentKeySet()
+	seedHigh := C.uint64_t(binary.BigEndian.Uint64(seed[0:8]))
+	seedLow := C.uint64_t(binary.BigEndian.Uint64(seed[8:16]))
+	if randomBits != nil && (t == FheBool || *randomBits > uint64(t.NumBits())) {
+		return fmt.Errorf("GenerateRandom: invalid number of random bits %d for %s", *randomBits, t)
+	}
+	var ptr unsafe.Pointer
+	switch t {
+	case FheBool:
+		ptr = C.generate_random_fhe_bool(ks.sks, seedLow, seedHigh)
+	case FheUint4:
+		if randomBits == nil {
+			ptr = C.generate_random_fhe_uint4(ks.sks, seedLow, seedHigh)
+		} else {
+			ptr = C.generate_bounded_random_fhe_uint4(ks.sks, seedLow, seedHigh, C.uint64_t(*randomBits))
+		}
+	case FheUint8:
+		if randomBits == nil {
+			ptr = C.generate_random_fhe_uint8(ks.sks, seedLow, seedHigh)
+		} else {
+			ptr = C.generate_bounded_random_fhe_uint8(ks.sks, seedLow, seedHigh, C.uint64_t(*randomBits))
+		}
+	case FheUint16:
+		if randomBits == nil {
+			ptr = C.generate_random_fhe_uint16(ks.sks, seedLow, seedHigh)
+		} else {
+			ptr = C.generate_bounded_random_fhe_uint16(ks.sks, seedLow, seedHigh, C.uint64_t(*randomBits))
+		}
+	case FheUint32:
+		if randomBits == nil {
+			ptr = C.generate_random_fhe_uint32(ks.sks, seedLow, seedHigh)
+		} else {
+			ptr = C.generate_bounded_random_fhe_uint32(ks.sks, seedLow, seedHigh, C.uint64_t(*randomBits))
+		}
+	case FheUint64:
+		if randomBits == nil {
+			ptr = C.generate_random_fhe_uint64(ks.sks, seedLow, seedHigh)
+		} else {
+			ptr = C.generate_bounded_random_fhe_uint64(ks.sks, seedLow, seedHigh, C.uint64_t(*randomBits))
+		}
+	case FheUint128:
+		if randomBits == nil {
+			ptr = C.generate_random_fhe_uint128(ks.sks, seedLow, seedHigh)
+		} else {
+			ptr = C.generate_bounded_random_fhe_uint128(ks.sks, seedLow, seedHigh, C.uint64_t(*randomBits))
+		}
+	case FheUint160:
+		if randomBits == nil {
+			ptr = C.generate_random_fhe_uint160(ks.sks, seedLow, seedHigh)
+		} else {
+			ptr = C.generate_bounded_random_fhe_uint160(ks.sks, seedLow, seedHigh, C.uint64_t(*randomBits))
+		}
+	default:
+		return fmt.Errorf("GenerateRandom: unexpected ciphertext type %s", t)
+	}
+	if ptr == nil {
+		return fmt.Errorf("GenerateRandom: failed to generate %s", t)
+	}
+	defer destroyCiphertext(ptr, t)
+	ser, err := serialize(ptr, t)
+	if err != nil {
+		return err
+	}
+	ct.Serialization = ser
+	ct.FheUintType = t
+	ct.KeySetId = ks.id
+	ct.computeHash()
+	return nil
+}
+
+// Bit widths of the random values that bounds that are not a power of 2 are reduced from, see
+// BoundedRandomReductionBits(). 256-bit values are only used for FheUint160 bounds above 128 bits.
+var boundedRandomReductionWidths = []uint{64, 128, 160, 256}
+
+// Returns the bit width of the random value that is used to generate a value in the [0, bound) range for a result of
+// type `t`, when `bound` is not a power of 2. A random value of that width is reduced modulo `bound` and then cast to
+// `t`. The width is at least 32 bits more than the bit length of `bound`, such that the statistical distance of the
+// result from the uniform distribution, i.e. the bias, is at most bound / 2^width < 2^-32. Any bound up to the width of
+// `t` is supported.
+func BoundedRandomReductionBits(t FheUintType, bound *big.Int) (uint, error) {
+	if t == FheBool || t == FheUint2048 || !IsValidFheType(byte(t)) {
+		return 0, fmt.Errorf("bounded random generation is not supported for %s", t)
+	}
+	if bound.Sign() <= 0 || bound.Cmp(new(big.Int).Lsh(big.NewInt(1), t.NumBits())) > 0 {
+		return 0, fmt.Errorf("invalid bound %s for %s", bound.Text(10), t)
+	}
+	for _, width := range boundedRandomReductionWidths {
+		if width >= t.NumBits() && int(width) >= bound.BitLen()+32 {
+			return width, nil
+		}
+	}
+	return 0, fmt.Errorf("bound %s is too big to be reduced without bias for %s", bound.Text(10), t)
+}
+
+// Generates an encrypted pseudo-random value of type `t` in the [0, bound) range, homomorphically from `seed`.
+// If `bound` is a power of 2, the value is exactly uniform. Otherwise, a wider random value is reduced modulo `bound`,
+// see BoundedRandomReductionBits() for the bias bound.
+func (ct *TfheCiphertext) GenerateRandomBounded(seed [16]byte, t FheUintType, bound *big.Int) error {
+	ks := currentKeySet()
+	if bound.Sign() <= 0 {
+		return fmt.Errorf("GenerateRandomBounded: invalid bound %s", bound.Text(10))
+	}
+	// Powers of 2 only need fewer random bits.
+	if new(big.Int).And(bound, new(big.Int).Sub(bound, big.NewInt(1))).Sign() == 0 {
+		if t == FheBool || t == FheUint2048 || bound.BitLen() > int(t.NumBits())+1 {
+			return fmt.Errorf("GenerateRandomBounded: invalid bound %s for %s", bound.Text(10), t)
+		}
+		randomBits := uint64(bound.BitLen() - 1)
+		if randomBits == uint64(t.NumBits()) {
+			return ct.GenerateRandom(seed, t, nil)
+		}
+		return ct.GenerateRandom(seed, t, &randomBits)
+	}
+
+	width, err := BoundedRandomReductionBits(t, bound)
+	if err != nil {
+		return err
+	}
+	seedHigh := C.uint64_t(binary.BigEndian.Uint64(seed[0:8]))
+	seedLow := C.uint64_t(binary.BigEndian.Uint64(seed[8:16]))
+
+	// The 256-bit reduction has no FheUintType, so it is cast down to FheUint160 right away.
+	if width == 256 {
+		return ct.generateRandomBounded256(seedLow, seedHigh, t, bound, ks)
+	}
+	var wide FheUintType
+	switch width {
+	case 64:
+		wide = FheUint64
+	case 128:
+		wide = FheUint128
+	default:
+		wide = FheUint160
+	}
+	var remPtr unsafe.Pointer
+	switch wide {
+	case FheUint64:
+		randPtr := C.generate_random_fhe_uint64(ks.sks, seedLow, seedHigh)
+		if randPtr == nil {
+			return errors.New("GenerateRandomBounded: failed to generate FheUint64")
+		}
+		remPtr = C.scalar_rem_fhe_uint64(randPtr, C.uint64_t(bound.Uint64()), ks.sks)
+		C.destroy_fhe_uint64(randPtr)
+	case FheUint128:
+		scalar, err := bigIntToU128(bound)
+		if err != nil {
+			return err
+		}
+		randPtr := C.generate_random_fhe_uint128(ks.sks, seedLow, seedHigh)
+		if randPtr == nil {
+			return errors.New("GenerateRandomBounded: failed to generate FheUint128")
+		}
+		remPtr = C.scalar_rem_fhe_uint128(randPtr, scalar, ks.sks)
+		C.destroy_fhe_uint128(randPtr)
+	case FheUint160:
+		scalar, err := bigIntToU256(bound)
+		if err != nil {
+			return err
+		}
+		randPtr := C.generate_random_fhe_uint160(ks.sks, seedLow, seedHigh)
+		if randPtr == nil {
+			return errors.New("GenerateRandomBounded: failed to generate FheUint160")
+		}
+		remPtr = C.scalar_rem_fhe_uint160(randPtr, *scalar, ks.sks)
+		C.destroy_fhe_uint160(randPtr)
+	}
+	if remPtr == nil {
+		return fmt.Errorf("GenerateRandomBounded: failed to reduce %s modulo the bound", wide)
+	}
+	defer destroyCiphertext(remPtr, wide)
+
+	resPtr := remPtr
+	if wide != t {
+		resPtr = castRandomReduction(remPtr, wide, t, ks.sks)
+		if resPtr == nil {
+			return fmt.Errorf("GenerateRandomBounded: failed to cast %s to %s", wide, t)
+		}
+		defer destroyCiphertext(resPtr, t)
+	}
+	ser, err := serialize(resPtr, t)
+	if err != nil {
+		return err
+	}
+	ct.Serialization = ser
+	ct.FheUintType = t
+	ct.KeySetId = ks.id
+	ct.computeHash()
+	return nil
+}
+
+// Generates a FheUint160 value in the [0, bound) range by reducing a 256-bit random value, for bounds above 128 bits.
+func (ct *TfheCiphertext) generateRandomBounded256(seedLow C.uint64_t, seedHigh C.uint64_t, t FheUintType, bound *big.Int, ks *KeySet) error {
+	if t != FheUint160 {
+		return fmt.Errorf("GenerateRandomBounded: 256-bit reduction is not supported for %s", t)
+	}
+	scalar, err := bigIntToU256(bound)
+	if err != nil {
+		return err
+	}
+	randPtr := C.generate_random_fhe_uint256(ks.sks, seedLow, seedHigh)
+	if randPtr == nil {
+		return errors.New("GenerateRandomBounded: failed to generate FheUint256")
+	}
+	remPtr := C.scalar_rem_fhe_uint256(randPtr, *scalar, ks.sks)
+	C.destroy_fhe_uint256(randPtr)
+	if remPtr == nil {
+		return errors.New("GenerateRandomBounded: failed to reduce FheUint256 modulo the bound")
+	}
+	resPtr := C.cast_256_160(remPtr, ks.sks)
+	C.destroy_fhe_uint256(remPtr)
+	if resPtr == nil {
+		return errors.New("GenerateRandomBounded: failed to cast FheUint256 to FheUint160")
+	}
+	defer destroyCiphertext(resPtr, t)
+	ser, err := serialize(resPtr, t)
+	if err != nil {
+		return err
+	}
+	ct.Serialization = ser
+	ct.FheUintType = t
+	ct.KeySetId = ks.id
+	ct.computeHash()
+	return nil
+}
+
+// Casts the result of a bounded random reduction from the wide type `from` down to `to`, with the server key `sks`.
+// Returns nil if the cast failed or isn't supported.
+func castRandomReduction(ptr unsafe.Pointer, from FheUintType, to FheUintType, sks unsafe.Pointer) unsafe.Pointer {
+	switch from {
+	case FheUint64:
+		switch to {
+		case FheUint4:
+			return C.cast_64_4(ptr, sks)
+		case FheUint8:
+			return C.cast_64_8(ptr, sks)
+		case FheUint16:
+			return C.cast_64_16(ptr, sks)
+		case FheUint32:
+			return C.cast_64_32(ptr, sks)
+		}
+	case FheUint128:
+		switch to {
+		case FheUint4:
+			return C.cast_128_4(ptr, sks)
+		case FheUint8:
+			return C.cast_128_8(ptr, sks)
+		case FheUint16:
+			return C.cast_128_16(ptr, sks)
+		case FheUint32:
+			return C.cast_128_32(ptr, sks)
+		case FheUint64:
+			return C.cast_128_64(ptr, sks)
+		}
+	case FheUint160:
+		switch to {
+		case FheUint4:
+			return C.cast_160_4(ptr, sks)
+		case FheUint8:
+			return C.cast_160_8(ptr, sks)
+		case FheUint16:
+			return C.cast_160_16(ptr, sks)
+		case FheUint32:
+			return C.cast_160_32(ptr, sks)
+		case FheUint64:
+			return C.cast_160_64(ptr, sks)
+		case FheUint128:
+			return C.cast_160_128(ptr, sks)
+		}
+	}
+	return nil
+}
+
+// Returns the serialized ciphertext, serializing the native ciphertext first if the ciphertext is the result of an
+// operation that was not serialized yet.
 func (ct *TfheCiphertext) Serialize() []byte {
+	if ct.Serialization == nil && ct.native != nil {
+		ser, err := serialize(ct.native, ct.FheUintType)
+		if err != nil {
+			panic(err)
+		}
+		ct.Serialization = ser
+	}
 	return ct.Serialization
 }
 
@@ -472,132 +917,108 @@ func (ct *TfheCiphertext) executeUnaryCiphertextOperation(rhs *TfheCiphertext,
 
 	res := new(TfheCiphertext)
 	res.FheUintType = ct.FheUintType
-	res_ser := &C.DynamicBuffer{}
+	res.KeySetId = ct.KeySetId
+	res.nativeCache = nativeCacheOf(ct)
 	switch ct.FheUintType {
 	case FheBool:
-		ct_ptr := C.deserialize_fhe_bool(toDynamicBufferView((ct.Serialization)))
+		ct_ptr, ct_release := ct.borrowNative()
 		if ct_ptr == nil {
 			return nil, errors.New("bool unary op deserialization failed")
 		}
-		defer C.destroy_fhe_bool(ct_ptr)
+		defer ct_release()
 		res_ptr, err := opBool(ct_ptr)
-		defer C.destroy_fhe_bool(res_ptr)
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("bool unary op failed")
 		}
-		ret := C.serialize_fhe_bool(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("bool unary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint4:
-		ct_ptr := C.deserialize_fhe_uint4(toDynamicBufferView((ct.Serialization)))
+		ct_ptr, ct_release := ct.borrowNative()
 		if ct_ptr == nil {
 			return nil, errors.New("8 bit unary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint4(ct_ptr)
+		defer ct_release()
 		res_ptr, err := op4(ct_ptr)
-		defer C.destroy_fhe_uint4(res_ptr)
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("8 bit unary op failed")
 		}
-		ret := C.serialize_fhe_uint4(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("8 bit unary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint8:
-		ct_ptr := C.deserialize_fhe_uint8(toDynamicBufferView((ct.Serialization)))
+		ct_ptr, ct_release := ct.borrowNative()
 		if ct_ptr == nil {
 			return nil, errors.New("8 bit unary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint8(ct_ptr)
+		defer ct_release()
 		res_ptr, err := op8(ct_ptr)
-		defer C.destroy_fhe_uint8(res_ptr)
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("8 bit unary op failed")
 		}
-		ret := C.serialize_fhe_uint8(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("8 bit unary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint16:
-		ct_ptr := C.deserialize_fhe_uint16(toDynamicBufferView((ct.Serialization)))
+		ct_ptr, ct_release := ct.borrowNative()
 		if ct_ptr == nil {
 			return nil, errors.New("16 bit unary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint16(ct_ptr)
+		defer ct_release()
 		res_ptr, err := op16(ct_ptr)
-		defer C.destroy_fhe_uint16(res_ptr)
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("16 bit op failed")
 		}
-		ret := C.serialize_fhe_uint16(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("16 bit unary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint32:
-		ct_ptr := C.deserialize_fhe_uint32(toDynamicBufferView((ct.Serialization)))
+		ct_ptr, ct_release := ct.borrowNative()
 		if ct_ptr == nil {
 			return nil, errors.New("32 bit unary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint32(ct_ptr)
-		res_ptr, err := op16(ct_ptr)
-		defer C.destroy_fhe_uint32(res_ptr)
+		defer ct_release()
+		res_ptr, err := op32(ct_ptr)
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("32 bit op failed")
 		}
-		ret := C.serialize_fhe_uint32(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("32 bit unary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint64:
-		ct_ptr := C.deserialize_fhe_uint64(toDynamicBufferView((ct.Serialization)))
+		ct_ptr, ct_release := ct.borrowNative()
 		if ct_ptr == nil {
 			return nil, errors.New("64 bit unary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint64(ct_ptr)
+		defer ct_release()
 		res_ptr, err := op64(ct_ptr)
-		defer C.destroy_fhe_uint64(res_ptr)
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("64 bit op failed")
 		}
-		ret := C.serialize_fhe_uint64(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("64 bit unary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	default:
 		panic("unary op unexpected ciphertext type")
 	}
-	res.computeHash()
 	return res, nil
 }
 
@@ -616,163 +1037,110 @@ func (lhs *TfheCiphertext) executeBinaryCiphertextOperation(rhs *TfheCiphertext,
 	}
 
 	res := new(TfheCiphertext)
+	res.KeySetId = lhs.KeySetId
+	res.nativeCache = nativeCacheOf(lhs, rhs)
 	if returnBool {
 		res.FheUintType = FheBool
 	} else {
 		res.FheUintType = lhs.FheUintType
 	}
-	res_ser := &C.DynamicBuffer{}
 	switch lhs.FheUintType {
 	case FheBool:
-		lhs_ptr := C.deserialize_fhe_bool(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("bool binary op deserialization failed")
 		}
-		defer C.destroy_fhe_bool(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_bool(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("bool binary op deserialization failed")
 		}
-		defer C.destroy_fhe_bool(rhs_ptr)
+		defer rhs_release()
 		res_ptr, err := opBool(lhs_ptr, rhs_ptr)
-		defer C.destroy_fhe_bool(res_ptr)
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("bool binary op failed")
 		}
-		ret := C.serialize_fhe_bool(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("bool binary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint4:
-		lhs_ptr := C.deserialize_fhe_uint4(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("4 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint4(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint4(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("4 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint4(rhs_ptr)
+		defer rhs_release()
 		res_ptr, err := op4(lhs_ptr, rhs_ptr)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint4(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("4 bit binary op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool binary op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint4(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("4 bit binary op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint8:
-		lhs_ptr := C.deserialize_fhe_uint8(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("8 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint8(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint8(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("8 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint8(rhs_ptr)
+		defer rhs_release()
 		res_ptr, err := op8(lhs_ptr, rhs_ptr)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint8(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("8 bit binary op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool binary op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint8(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("8 bit binary op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint16:
-		lhs_ptr := C.deserialize_fhe_uint16(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("16 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint16(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint16(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("16 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint16(rhs_ptr)
+		defer rhs_release()
 		res_ptr, err := op16(lhs_ptr, rhs_ptr)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint16(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("16 bit binary op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool binary op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint16(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("8 bit binary op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint32:
-		lhs_ptr := C.deserialize_fhe_uint32(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("32 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint32(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint32(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("32 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint32(rhs_ptr)
+		defer rhs_release()
 		res_ptr, err := op32(lhs_ptr, rhs_ptr)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint32(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
@@ -780,131 +1148,75 @@ func (lhs *TfheCiphertext) executeBinaryCiphertextOperation(rhs *TfheCiphertext,
 			return nil, errors.New("32 bit binary op failed")
 		}
 
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool binary op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint32(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("32 bit binary op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint64:
-		lhs_ptr := C.deserialize_fhe_uint64(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("64 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint64(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint64(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("64 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint64(rhs_ptr)
+		defer rhs_release()
 		res_ptr, err := op64(lhs_ptr, rhs_ptr)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint64(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("64 bit binary op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool binary op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint64(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("64 bit binary op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint160:
-		lhs_ptr := C.deserialize_fhe_uint160(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("160 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint160(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint160(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("160 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint160(rhs_ptr)
+		defer rhs_release()
 		res_ptr, err := op160(lhs_ptr, rhs_ptr)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint160(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("160 bit binary op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool binary op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint160(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("160 bit binary op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint2048:
-		lhs_ptr := C.deserialize_fhe_uint2048(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("2048 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint2048(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint2048(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("2048 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint2048(rhs_ptr)
+		defer rhs_release()
 		res_ptr, err := op2048(lhs_ptr, rhs_ptr)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint2048(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("2048 bit binary op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool binary op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint2048(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("2048 bit binary op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	default:
 		panic("binary op unexpected ciphertext type")
 	}
-	res.computeHash()
 	return res, nil
 }
 
@@ -918,177 +1230,156 @@ func (first *TfheCiphertext) executeTernaryCiphertextOperation(lhs *TfheCipherte
 	if lhs.FheUintType != rhs.FheUintType {
 		return nil, errors.New("ternary operations are only well-defined for identical types")
 	}
+	if first.FheUintType != FheBool {
+		return nil, errors.New("ternary operations require a boolean condition")
+	}
 
 	res := new(TfheCiphertext)
+	res.KeySetId = first.KeySetId
+	res.nativeCache = nativeCacheOf(first, lhs, rhs)
 	res.FheUintType = lhs.FheUintType
-	res_ser := &C.DynamicBuffer{}
 	switch lhs.FheUintType {
 	case FheUint4:
-		lhs_ptr := C.deserialize_fhe_uint4(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("4 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint4(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint4(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("4 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint4(rhs_ptr)
-		first_ptr := C.deserialize_fhe_bool(toDynamicBufferView((first.Serialization)))
+		defer rhs_release()
+		first_ptr, first_release := first.borrowNative()
 		if first_ptr == nil {
 			return nil, errors.New("bool binary op deserialization failed")
 		}
-		defer C.destroy_fhe_bool(first_ptr)
+		defer first_release()
 		res_ptr := op4(first_ptr, lhs_ptr, rhs_ptr)
 		if res_ptr == nil {
 			return nil, errors.New("4 bit binary op failed")
 		}
-		defer C.destroy_fhe_uint4(res_ptr)
-		ret := C.serialize_fhe_uint4(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("4 bit binary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint8:
-		lhs_ptr := C.deserialize_fhe_uint8(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("8 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint8(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint8(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("8 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint8(rhs_ptr)
-		first_ptr := C.deserialize_fhe_bool(toDynamicBufferView((first.Serialization)))
+		defer rhs_release()
+		first_ptr, first_release := first.borrowNative()
 		if first_ptr == nil {
 			return nil, errors.New("bool binary op deserialization failed")
 		}
-		defer C.destroy_fhe_bool(first_ptr)
+		defer first_release()
 		res_ptr := op8(first_ptr, lhs_ptr, rhs_ptr)
 		if res_ptr == nil {
 			return nil, errors.New("8 bit binary op failed")
 		}
-		defer C.destroy_fhe_uint8(res_ptr)
-		ret := C.serialize_fhe_uint8(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("8 bit binary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint16:
-		lhs_ptr := C.deserialize_fhe_uint16(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("16 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint16(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint16(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("16 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint16(rhs_ptr)
-		first_ptr := C.deserialize_fhe_bool(toDynamicBufferView((first.Serialization)))
+		defer rhs_release()
+		first_ptr, first_release := first.borrowNative()
 		if first_ptr == nil {
 			return nil, errors.New("bool binary op deserialization failed")
 		}
-		defer C.destroy_fhe_bool(first_ptr)
+		defer first_release()
 		res_ptr := op16(first_ptr, lhs_ptr, rhs_ptr)
 		if res_ptr == nil {
 			return nil, errors.New("16 bit binary op failed")
 		}
-		defer C.destroy_fhe_uint16(res_ptr)
-		ret := C.serialize_fhe_uint16(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("16 bit binary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint32:
-		lhs_ptr := C.deserialize_fhe_uint32(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("32 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint32(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint32(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("32 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint32(rhs_ptr)
-		first_ptr := C.deserialize_fhe_bool(toDynamicBufferView((first.Serialization)))
+		defer rhs_release()
+		first_ptr, first_release := first.borrowNative()
 		if first_ptr == nil {
 			return nil, errors.New("bool binary op deserialization failed")
 		}
-		defer C.destroy_fhe_bool(first_ptr)
+		defer first_release()
 		res_ptr := op32(first_ptr, lhs_ptr, rhs_ptr)
 		if res_ptr == nil {
 			return nil, errors.New("32 bit binary op failed")
 		}
-		defer C.destroy_fhe_uint32(res_ptr)
-		ret := C.serialize_fhe_uint32(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("32 bit binary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint64:
-		lhs_ptr := C.deserialize_fhe_uint64(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("64 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint64(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint64(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("64 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint64(rhs_ptr)
-		first_ptr := C.deserialize_fhe_bool(toDynamicBufferView((first.Serialization)))
+		defer rhs_release()
+		first_ptr, first_release := first.borrowNative()
 		if first_ptr == nil {
 			return nil, errors.New("bool binary op deserialization failed")
 		}
-		defer C.destroy_fhe_bool(first_ptr)
+		defer first_release()
 		res_ptr := op64(first_ptr, lhs_ptr, rhs_ptr)
 		if res_ptr == nil {
 			return nil, errors.New("64 bit binary op failed")
 		}
-		defer C.destroy_fhe_uint64(res_ptr)
-		ret := C.serialize_fhe_uint64(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("64 bit binary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint160:
-		lhs_ptr := C.deserialize_fhe_uint160(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("160 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint160(lhs_ptr)
-		rhs_ptr := C.deserialize_fhe_uint160(toDynamicBufferView((rhs.Serialization)))
+		defer lhs_release()
+		rhs_ptr, rhs_release := rhs.borrowNative()
 		if rhs_ptr == nil {
 			return nil, errors.New("160 bit binary op deserialization failed")
 		}
-		defer C.destroy_fhe_uint160(rhs_ptr)
-		first_ptr := C.deserialize_fhe_bool(toDynamicBufferView((first.Serialization)))
+		defer rhs_release()
+		first_ptr, first_release := first.borrowNative()
 		if first_ptr == nil {
 			return nil, errors.New("bool binary op deserialization failed")
 		}
-		defer C.destroy_fhe_bool(first_ptr)
+		defer first_release()
 		res_ptr := op160(first_ptr, lhs_ptr, rhs_ptr)
 		if res_ptr == nil {
 			return nil, errors.New("160 bit binary op failed")
 		}
-		defer C.destroy_fhe_uint160(res_ptr)
-		ret := C.serialize_fhe_uint160(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("160 bit binary op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	default:
 		panic("ternary op unexpected ciphertext type")
 	}
-	res.computeHash()
 	return res, nil
 }
 
@@ -1104,201 +1395,123 @@ func (lhs *TfheCiphertext) executeBinaryScalarOperation(rhs *big.Int,
 	op2048 func(lhs unsafe.Pointer, rhs C.U2048) (unsafe.Pointer, error),
 	returnBool bool) (*TfheCiphertext, error) {
 	res := new(TfheCiphertext)
+	res.KeySetId = lhs.KeySetId
+	res.nativeCache = nativeCacheOf(lhs)
 	if returnBool {
 		res.FheUintType = FheBool
 	} else {
 		res.FheUintType = lhs.FheUintType
 	}
 	rhs_uint64 := rhs.Uint64()
-	res_ser := &C.DynamicBuffer{}
 	switch lhs.FheUintType {
 	case FheBool:
-		lhs_ptr := C.deserialize_fhe_bool(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("bool scalar op deserialization failed")
 		}
-		defer C.destroy_fhe_bool(lhs_ptr)
+		defer lhs_release()
 		scalar := C.bool(rhs_uint64 == 1)
 		res_ptr, err := opBool(lhs_ptr, scalar)
-		defer C.destroy_fhe_bool(res_ptr)
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("bool scalar op failed")
 		}
-		ret := C.serialize_fhe_bool(res_ptr, res_ser)
-		if ret != 0 {
-			return nil, errors.New("bool scalar op serialization failed")
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint4:
-		lhs_ptr := C.deserialize_fhe_uint4(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("4 bit scalar op deserialization failed")
 		}
-		defer C.destroy_fhe_uint4(lhs_ptr)
+		defer lhs_release()
 		scalar := C.uint8_t(rhs_uint64)
 		res_ptr, err := op4(lhs_ptr, scalar)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint4(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("4 bit scalar op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool scalar op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint4(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("4 bit scalar op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint8:
-		lhs_ptr := C.deserialize_fhe_uint8(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("8 bit scalar op deserialization failed")
 		}
-		defer C.destroy_fhe_uint8(lhs_ptr)
+		defer lhs_release()
 		scalar := C.uint8_t(rhs_uint64)
 		res_ptr, err := op8(lhs_ptr, scalar)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint8(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("8 bit scalar op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool scalar op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint8(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("8 bit scalar op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint16:
-		lhs_ptr := C.deserialize_fhe_uint16(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("16 bit scalar op deserialization failed")
 		}
-		defer C.destroy_fhe_uint16(lhs_ptr)
+		defer lhs_release()
 		scalar := C.uint16_t(rhs_uint64)
 		res_ptr, err := op16(lhs_ptr, scalar)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint16(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("16 bit scalar op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool scalar op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint16(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("16 bit scalar op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint32:
-		lhs_ptr := C.deserialize_fhe_uint32(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("32 bit scalar op deserialization failed")
 		}
-		defer C.destroy_fhe_uint32(lhs_ptr)
+		defer lhs_release()
 		scalar := C.uint32_t(rhs_uint64)
 		res_ptr, err := op32(lhs_ptr, scalar)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint32(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("32 bit scalar op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool scalar op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint32(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("32 bit scalar op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint64:
-		lhs_ptr := C.deserialize_fhe_uint64(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("64 bit scalar op deserialization failed")
 		}
-		defer C.destroy_fhe_uint64(lhs_ptr)
+		defer lhs_release()
 		scalar := C.uint64_t(rhs_uint64)
 		res_ptr, err := op64(lhs_ptr, scalar)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint64(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
 		if res_ptr == nil {
 			return nil, errors.New("64 bit scalar op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool scalar op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint64(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("64 bit scalar op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint160:
-		lhs_ptr := C.deserialize_fhe_uint160(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("160 bit scalar op deserialization failed")
 		}
-		defer C.destroy_fhe_uint160(lhs_ptr)
+		defer lhs_release()
 
 		scalar, err := bigIntToU256(rhs)
 		if err != nil {
@@ -1306,11 +1519,6 @@ func (lhs *TfheCiphertext) executeBinaryScalarOperation(rhs *big.Int,
 		}
 
 		res_ptr, err := op160(lhs_ptr, *scalar)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint160(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
@@ -1318,25 +1526,15 @@ func (lhs *TfheCiphertext) executeBinaryScalarOperation(rhs *big.Int,
 		if res_ptr == nil {
 			return nil, errors.New("160 bit scalar op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool scalar op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint160(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("160 bit scalar op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	case FheUint2048:
-		lhs_ptr := C.deserialize_fhe_uint2048(toDynamicBufferView((lhs.Serialization)))
+		lhs_ptr, lhs_release := lhs.borrowNative()
 		if lhs_ptr == nil {
 			return nil, errors.New("2048 bit scalar op deserialization failed")
 		}
-		defer C.destroy_fhe_uint2048(lhs_ptr)
+		defer lhs_release()
 
 		scalar, err := bigIntToU2048(rhs)
 		if err != nil {
@@ -1344,11 +1542,6 @@ func (lhs *TfheCiphertext) executeBinaryScalarOperation(rhs *big.Int,
 		}
 
 		res_ptr, err := op2048(lhs_ptr, *scalar)
-		if returnBool {
-			defer C.destroy_fhe_bool(res_ptr)
-		} else {
-			defer C.destroy_fhe_uint2048(res_ptr)
-		}
 		if err != nil {
 			return nil, err
 		}
@@ -1356,27 +1549,20 @@ func (lhs *TfheCiphertext) executeBinaryScalarOperation(rhs *big.Int,
 		if res_ptr == nil {
 			return nil, errors.New("2048 bit scalar op failed")
 		}
-		if returnBool {
-			ret := C.serialize_fhe_bool(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("bool scalar op serialization failed")
-			}
-		} else {
-			ret := C.serialize_fhe_uint2048(res_ptr, res_ser)
-			if ret != 0 {
-				return nil, errors.New("160 bit scalar op serialization failed")
-			}
+		if err := res.adoptNative(res_ptr); err != nil {
+			return nil, err
 		}
-		res.Serialization = C.GoBytes(unsafe.Pointer(res_ser.pointer), C.int(res_ser.length))
-		C.destroy_dynamic_buffer(res_ser)
 	default:
 		panic("scalar op unexpected ciphertext type")
 	}
-	res.computeHash()
 	return res, nil
 }
 
 func (lhs *TfheCiphertext) Add(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1398,6 +1584,10 @@ func (lhs *TfheCiphertext) Add(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarAdd(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1419,6 +1609,10 @@ func (lhs *TfheCiphertext) ScalarAdd(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Sub(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1440,6 +1634,10 @@ func (lhs *TfheCiphertext) Sub(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarSub(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1461,6 +1659,10 @@ func (lhs *TfheCiphertext) ScalarSub(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Mul(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1482,6 +1684,10 @@ func (lhs *TfheCiphertext) Mul(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarMul(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1502,7 +1708,61 @@ func (lhs *TfheCiphertext) ScalarMul(rhs *big.Int) (*TfheCiphertext, error) {
 		fheUint160BinaryScalarNotSupportedOp, fheUint2048BinarScalaryNotSupportedOp, false)
 }
 
+func (lhs *TfheCiphertext) Div(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+	return lhs.executeBinaryCiphertextOperation(rhs,
+		boolBinaryNotSupportedOp,
+		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
+			return C.div_fhe_uint4(lhs, rhs, sks), nil
+		},
+		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
+			return C.div_fhe_uint8(lhs, rhs, sks), nil
+		},
+		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
+			return C.div_fhe_uint16(lhs, rhs, sks), nil
+		},
+		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
+			return C.div_fhe_uint32(lhs, rhs, sks), nil
+		},
+		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
+			return C.div_fhe_uint64(lhs, rhs, sks), nil
+		},
+		fheUint160BinaryNotSupportedOp, fheUint2048BinaryNotSupportedOp, false)
+}
+
+func (lhs *TfheCiphertext) Rem(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+	return lhs.executeBinaryCiphertextOperation(rhs,
+		boolBinaryNotSupportedOp,
+		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
+			return C.rem_fhe_uint4(lhs, rhs, sks), nil
+		},
+		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
+			return C.rem_fhe_uint8(lhs, rhs, sks), nil
+		},
+		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
+			return C.rem_fhe_uint16(lhs, rhs, sks), nil
+		},
+		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
+			return C.rem_fhe_uint32(lhs, rhs, sks), nil
+		},
+		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
+			return C.rem_fhe_uint64(lhs, rhs, sks), nil
+		},
+		fheUint160BinaryNotSupportedOp, fheUint2048BinaryNotSupportedOp, false)
+}
+
 func (lhs *TfheCiphertext) ScalarDiv(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1524,6 +1784,10 @@ func (lhs *TfheCiphertext) ScalarDiv(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarRem(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1545,6 +1809,10 @@ func (lhs *TfheCiphertext) ScalarRem(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Bitand(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
 			return C.bitand_fhe_bool(lhs, rhs, sks), nil
@@ -1568,6 +1836,10 @@ func (lhs *TfheCiphertext) Bitand(rhs *TfheCiphertext) (*TfheCiphertext, error)
 }
 
 func (lhs *TfheCiphertext) Bitor(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
 			return C.bitor_fhe_bool(lhs, rhs, sks), nil
@@ -1591,6 +1863,10 @@ func (lhs *TfheCiphertext) Bitor(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Bitxor(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
 			return C.bitxor_fhe_bool(lhs, rhs, sks), nil
@@ -1614,6 +1890,10 @@ func (lhs *TfheCiphertext) Bitxor(rhs *TfheCiphertext) (*TfheCiphertext, error)
 }
 
 func (lhs *TfheCiphertext) Shl(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1635,6 +1915,10 @@ func (lhs *TfheCiphertext) Shl(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarShl(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1656,6 +1940,10 @@ func (lhs *TfheCiphertext) ScalarShl(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Shr(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1679,6 +1967,10 @@ func (lhs *TfheCiphertext) Shr(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarShr(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1700,6 +1992,10 @@ func (lhs *TfheCiphertext) ScalarShr(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Rotl(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1721,6 +2017,10 @@ func (lhs *TfheCiphertext) Rotl(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarRotl(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1742,6 +2042,10 @@ func (lhs *TfheCiphertext) ScalarRotl(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Rotr(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1765,6 +2069,10 @@ func (lhs *TfheCiphertext) Rotr(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarRotr(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1786,6 +2094,10 @@ func (lhs *TfheCiphertext) ScalarRotr(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Eq(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1813,6 +2125,10 @@ func (lhs *TfheCiphertext) Eq(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarEq(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1840,6 +2156,10 @@ func (lhs *TfheCiphertext) ScalarEq(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Ne(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1867,6 +2187,10 @@ func (lhs *TfheCiphertext) Ne(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarNe(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1894,6 +2218,10 @@ func (lhs *TfheCiphertext) ScalarNe(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Ge(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1917,6 +2245,10 @@ func (lhs *TfheCiphertext) Ge(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarGe(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1938,6 +2270,10 @@ func (lhs *TfheCiphertext) ScalarGe(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Gt(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -1961,6 +2297,10 @@ func (lhs *TfheCiphertext) Gt(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarGt(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -1982,6 +2322,10 @@ func (lhs *TfheCiphertext) ScalarGt(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Le(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -2005,6 +2349,10 @@ func (lhs *TfheCiphertext) Le(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarLe(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -2028,6 +2376,10 @@ func (lhs *TfheCiphertext) ScalarLe(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Lt(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -2051,6 +2403,10 @@ func (lhs *TfheCiphertext) Lt(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarLt(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -2072,7 +2428,139 @@ func (lhs *TfheCiphertext) ScalarLt(rhs *big.Int) (*TfheCiphertext, error) {
 		true)
 }
 
+// Scalar-left operations are supported for the types their ciphertext-ciphertext counterparts support, i.e. FheUint4
+// to FheUint64. Subtraction and comparisons are computed natively, from the scalar operations of tfhe-rs. tfhe-rs has
+// no scalar-left division, remainder, shift or rotation, so these trivially encrypt the scalar and run the
+// ciphertext-ciphertext operation.
+
+// Fails if scalar-left operations are not supported for the type of `ct`.
+func (ct *TfheCiphertext) checkScalarLeftType() error {
+	switch ct.FheUintType {
+	case FheUint4, FheUint8, FheUint16, FheUint32, FheUint64:
+		return nil
+	default:
+		return fmt.Errorf("scalar-left operation is not supported for %s", ct.FheUintType)
+	}
+}
+
+// Trivially encrypts `scalar` to the type of `ct`, so that it can be the left operand of a ciphertext-ciphertext
+// operation. Trivial encryption is cheap and the result is then used like any other ciphertext.
+func (ct *TfheCiphertext) scalarAsLeftOperand(scalar *big.Int) (*TfheCiphertext, error) {
+	if err := ct.checkScalarLeftType(); err != nil {
+		return nil, err
+	}
+	ks, err := commonKeySet(ct)
+	if err != nil {
+		return nil, err
+	}
+	return new(TfheCiphertext).trivialEncrypt(*scalar, ct.FheUintType, ks), nil
+}
+
+// Computes `lhs - rhs` as `-rhs + lhs`, which wraps around the same way.
+func (rhs *TfheCiphertext) ScalarLeftSub(lhs *big.Int) (*TfheCiphertext, error) {
+	if err := rhs.checkScalarLeftType(); err != nil {
+		return nil, err
+	}
+	neg, err := rhs.Neg()
+	if err != nil {
+		return nil, err
+	}
+	return neg.ScalarAdd(lhs)
+}
+
+// Computes `lhs / rhs`.
+func (rhs *TfheCiphertext) ScalarLeftDiv(lhs *big.Int) (*TfheCiphertext, error) {
+	ct, err := rhs.scalarAsLeftOperand(lhs)
+	if err != nil {
+		return nil, err
+	}
+	return ct.Div(rhs)
+}
+
+// Computes `lhs % rhs`.
+func (rhs *TfheCiphertext) ScalarLeftRem(lhs *big.Int) (*TfheCiphertext, error) {
+	ct, err := rhs.scalarAsLeftOperand(lhs)
+	if err != nil {
+		return nil, err
+	}
+	return ct.Rem(rhs)
+}
+
+// Computes `lhs << rhs`.
+func (rhs *TfheCiphertext) ScalarLeftShl(lhs *big.Int) (*TfheCiphertext, error) {
+	ct, err := rhs.scalarAsLeftOperand(lhs)
+	if err != nil {
+		return nil, err
+	}
+	return ct.Shl(rhs)
+}
+
+// Computes `lhs >> rhs`.
+func (rhs *TfheCiphertext) ScalarLeftShr(lhs *big.Int) (*TfheCiphertext, error) {
+	ct, err := rhs.scalarAsLeftOperand(lhs)
+	if err != nil {
+		return nil, err
+	}
+	return ct.Shr(rhs)
+}
+
+// Rotates `lhs` left by `rhs` bits.
+func (rhs *TfheCiphertext) ScalarLeftRotl(lhs *big.Int) (*TfheCiphertext, error) {
+	ct, err := rhs.scalarAsLeftOperand(lhs)
+	if err != nil {
+		return nil, err
+	}
+	return ct.Rotl(rhs)
+}
+
+// Rotates `lhs` right by `rhs` bits.
+func (rhs *TfheCiphertext) ScalarLeftRotr(lhs *big.Int) (*TfheCiphertext, error) {
+	ct, err := rhs.scalarAsLeftOperand(lhs)
+	if err != nil {
+		return nil, err
+	}
+	return ct.Rotr(rhs)
+}
+
+// Comparisons don't need an encrypted left operand: `lhs <= rhs` is the same as `rhs >= lhs`, and so on.
+
+// Computes `lhs <= rhs`.
+func (rhs *TfheCiphertext) ScalarLeftLe(lhs *big.Int) (*TfheCiphertext, error) {
+	if err := rhs.checkScalarLeftType(); err != nil {
+		return nil, err
+	}
+	return rhs.ScalarGe(lhs)
+}
+
+// Computes `lhs < rhs`.
+func (rhs *TfheCiphertext) ScalarLeftLt(lhs *big.Int) (*TfheCiphertext, error) {
+	if err := rhs.checkScalarLeftType(); err != nil {
+		return nil, err
+	}
+	return rhs.ScalarGt(lhs)
+}
+
+// Computes `lhs >= rhs`.
+func (rhs *TfheCiphertext) ScalarLeftGe(lhs *big.Int) (*TfheCiphertext, error) {
+	if err := rhs.checkScalarLeftType(); err != nil {
+		return nil, err
+	}
+	return rhs.ScalarLe(lhs)
+}
+
+// Computes `lhs > rhs`.
+func (rhs *TfheCiphertext) ScalarLeftGt(lhs *big.Int) (*TfheCiphertext, error) {
+	if err := rhs.checkScalarLeftType(); err != nil {
+		return nil, err
+	}
+	return rhs.ScalarLt(lhs)
+}
+
 func (lhs *TfheCiphertext) Min(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -2094,6 +2582,10 @@ func (lhs *TfheCiphertext) Min(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarMin(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -2115,6 +2607,10 @@ func (lhs *TfheCiphertext) ScalarMin(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Max(rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryCiphertextOperation(rhs,
 		boolBinaryNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -2136,6 +2632,10 @@ func (lhs *TfheCiphertext) Max(rhs *TfheCiphertext) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) ScalarMax(rhs *big.Int) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeBinaryScalarOperation(rhs,
 		boolBinaryScalarNotSupportedOp,
 		func(lhs unsafe.Pointer, rhs C.uint8_t) (unsafe.Pointer, error) {
@@ -2157,6 +2657,10 @@ func (lhs *TfheCiphertext) ScalarMax(rhs *big.Int) (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Neg() (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeUnaryCiphertextOperation(lhs,
 		boolUnaryNotSupportedOp,
 		func(lhs unsafe.Pointer) (unsafe.Pointer, error) {
@@ -2177,6 +2681,10 @@ func (lhs *TfheCiphertext) Neg() (*TfheCiphertext, error) {
 }
 
 func (lhs *TfheCiphertext) Not() (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(lhs)
+	if err != nil {
+		return nil, err
+	}
 	return lhs.executeUnaryCiphertextOperation(lhs,
 		func(lhs unsafe.Pointer) (unsafe.Pointer, error) {
 			return C.not_fhe_bool(lhs, sks), nil
@@ -2199,6 +2707,10 @@ func (lhs *TfheCiphertext) Not() (*TfheCiphertext, error) {
 }
 
 func (condition *TfheCiphertext) IfThenElse(lhs *TfheCiphertext, rhs *TfheCiphertext) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(condition, lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
 	return condition.executeTernaryCiphertextOperation(lhs, rhs,
 		func(condition unsafe.Pointer, lhs unsafe.Pointer, rhs unsafe.Pointer) unsafe.Pointer {
 			return C.if_then_else_fhe_uint4(condition, lhs, rhs, sks)
@@ -2224,91 +2736,82 @@ func (ct *TfheCiphertext) CastTo(castToType FheUintType) (*TfheCiphertext, error
 	if ct.FheUintType == castToType {
 		return nil, errors.New("casting to same type is not supported")
 	}
+	sks, err := serverKeyOf(ct)
+	if err != nil {
+		return nil, err
+	}
 
 	res := new(TfheCiphertext)
+	res.KeySetId = ct.KeySetId
+	res.nativeCache = nativeCacheOf(ct)
 	res.FheUintType = castToType
 
 	switch ct.FheUintType {
 	case FheBool:
 		switch castToType {
 		case FheUint4:
-			from_ptr := C.deserialize_fhe_bool(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheBool ciphertext")
 			}
 			to_ptr := C.cast_bool_4(from_ptr, sks)
-			C.destroy_fhe_bool(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheBool to FheUint8")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint4(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint8:
-			from_ptr := C.deserialize_fhe_bool(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheBool ciphertext")
 			}
 			to_ptr := C.cast_bool_8(from_ptr, sks)
-			C.destroy_fhe_bool(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheBool to FheUint8")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint8(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint16:
-			from_ptr := C.deserialize_fhe_bool(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheBool ciphertext")
 			}
 			to_ptr := C.cast_bool_16(from_ptr, sks)
-			C.destroy_fhe_bool(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheBool to FheUint16")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint16(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint32:
-			from_ptr := C.deserialize_fhe_bool(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheBool ciphertext")
 			}
 			to_ptr := C.cast_bool_32(from_ptr, sks)
-			C.destroy_fhe_bool(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheBool to FheUint32")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint32(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint64:
-			from_ptr := C.deserialize_fhe_bool(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheBool ciphertext")
 			}
 			to_ptr := C.cast_bool_64(from_ptr, sks)
-			C.destroy_fhe_bool(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheBool to FheUint64")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint64(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		default:
@@ -2317,67 +2820,55 @@ func (ct *TfheCiphertext) CastTo(castToType FheUintType) (*TfheCiphertext, error
 	case FheUint4:
 		switch castToType {
 		case FheUint8:
-			from_ptr := C.deserialize_fhe_uint4(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint4 ciphertext")
 			}
 			to_ptr := C.cast_4_8(from_ptr, sks)
-			C.destroy_fhe_uint4(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint4 to FheUint16")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint8(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint16:
-			from_ptr := C.deserialize_fhe_uint4(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint4 ciphertext")
 			}
 			to_ptr := C.cast_4_16(from_ptr, sks)
-			C.destroy_fhe_uint4(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint4 to FheUint16")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint16(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint32:
-			from_ptr := C.deserialize_fhe_uint4(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint4 ciphertext")
 			}
 			to_ptr := C.cast_4_32(from_ptr, sks)
-			C.destroy_fhe_uint4(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint4 to FheUint32")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint32(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint64:
-			from_ptr := C.deserialize_fhe_uint4(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint4 ciphertext")
 			}
 			to_ptr := C.cast_4_64(from_ptr, sks)
-			C.destroy_fhe_uint4(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint4 to FheUint64")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint64(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		default:
@@ -2386,67 +2877,55 @@ func (ct *TfheCiphertext) CastTo(castToType FheUintType) (*TfheCiphertext, error
 	case FheUint8:
 		switch castToType {
 		case FheUint4:
-			from_ptr := C.deserialize_fhe_uint8(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint8 ciphertext")
 			}
 			to_ptr := C.cast_8_4(from_ptr, sks)
-			C.destroy_fhe_uint8(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint8 to FheUint4")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint4(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint16:
-			from_ptr := C.deserialize_fhe_uint8(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint8 ciphertext")
 			}
 			to_ptr := C.cast_8_16(from_ptr, sks)
-			C.destroy_fhe_uint8(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint8 to FheUint16")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint16(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint32:
-			from_ptr := C.deserialize_fhe_uint8(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint8 ciphertext")
 			}
 			to_ptr := C.cast_8_32(from_ptr, sks)
-			C.destroy_fhe_uint8(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint8 to FheUint32")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint32(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint64:
-			from_ptr := C.deserialize_fhe_uint8(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint8 ciphertext")
 			}
 			to_ptr := C.cast_8_64(from_ptr, sks)
-			C.destroy_fhe_uint8(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint8 to FheUint64")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint64(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		default:
@@ -2455,67 +2934,55 @@ func (ct *TfheCiphertext) CastTo(castToType FheUintType) (*TfheCiphertext, error
 	case FheUint16:
 		switch castToType {
 		case FheUint4:
-			from_ptr := C.deserialize_fhe_uint16(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint16 ciphertext")
 			}
 			to_ptr := C.cast_16_4(from_ptr, sks)
-			C.destroy_fhe_uint16(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint16 to FheUint4")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint4(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint8:
-			from_ptr := C.deserialize_fhe_uint16(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint16 ciphertext")
 			}
 			to_ptr := C.cast_16_8(from_ptr, sks)
-			C.destroy_fhe_uint16(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint16 to FheUint8")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint8(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint32:
-			from_ptr := C.deserialize_fhe_uint16(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint16 ciphertext")
 			}
 			to_ptr := C.cast_16_32(from_ptr, sks)
-			C.destroy_fhe_uint16(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint16 to FheUint32")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint32(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint64:
-			from_ptr := C.deserialize_fhe_uint16(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint16 ciphertext")
 			}
 			to_ptr := C.cast_16_64(from_ptr, sks)
-			C.destroy_fhe_uint16(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint16 to FheUint64")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint64(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		default:
@@ -2524,67 +2991,55 @@ func (ct *TfheCiphertext) CastTo(castToType FheUintType) (*TfheCiphertext, error
 	case FheUint32:
 		switch castToType {
 		case FheUint4:
-			from_ptr := C.deserialize_fhe_uint32(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint32 ciphertext")
 			}
 			to_ptr := C.cast_32_4(from_ptr, sks)
-			C.destroy_fhe_uint32(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint32 to FheUint4")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint4(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint8:
-			from_ptr := C.deserialize_fhe_uint32(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint32 ciphertext")
 			}
 			to_ptr := C.cast_32_8(from_ptr, sks)
-			C.destroy_fhe_uint32(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint32 to FheUint8")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint8(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint16:
-			from_ptr := C.deserialize_fhe_uint32(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint32 ciphertext")
 			}
 			to_ptr := C.cast_32_16(from_ptr, sks)
-			C.destroy_fhe_uint32(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint32 to FheUint16")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint16(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint64:
-			from_ptr := C.deserialize_fhe_uint32(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint32 ciphertext")
 			}
 			to_ptr := C.cast_32_64(from_ptr, sks)
-			C.destroy_fhe_uint32(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint32 to FheUint64")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint64(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		default:
@@ -2593,67 +3048,55 @@ func (ct *TfheCiphertext) CastTo(castToType FheUintType) (*TfheCiphertext, error
 	case FheUint64:
 		switch castToType {
 		case FheUint4:
-			from_ptr := C.deserialize_fhe_uint64(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint64 ciphertext")
 			}
 			to_ptr := C.cast_64_4(from_ptr, sks)
-			C.destroy_fhe_uint64(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint64 to FheUint4")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint4(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint8:
-			from_ptr := C.deserialize_fhe_uint64(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint64 ciphertext")
 			}
 			to_ptr := C.cast_64_8(from_ptr, sks)
-			C.destroy_fhe_uint64(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint64 to FheUint8")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint8(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint16:
-			from_ptr := C.deserialize_fhe_uint64(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint64 ciphertext")
 			}
 			to_ptr := C.cast_64_16(from_ptr, sks)
-			C.destroy_fhe_uint64(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint64 to FheUint16")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint16(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		case FheUint32:
-			from_ptr := C.deserialize_fhe_uint64(toDynamicBufferView(ct.Serialization))
+			from_ptr, from_release := ct.borrowNative()
 			if from_ptr == nil {
 				return nil, errors.New("castTo failed to deserialize FheUint64 ciphertext")
 			}
 			to_ptr := C.cast_64_32(from_ptr, sks)
-			C.destroy_fhe_uint64(from_ptr)
+			from_release()
 			if to_ptr == nil {
 				return nil, errors.New("castTo failed to cast FheUint64 to FheUint32")
 			}
-			var err error
-			res.Serialization, err = serialize(to_ptr, castToType)
-			C.destroy_fhe_uint32(to_ptr)
-			if err != nil {
+			if err := res.adoptNative(to_ptr); err != nil {
 				return nil, err
 			}
 		default:
@@ -2664,11 +3107,74 @@ func (ct *TfheCiphertext) CastTo(castToType FheUintType) (*TfheCiphertext, error
 	default:
 		return nil, fmt.Errorf("castTo: unexpected type to cast from")
 	}
+	return res, nil
+}
+
+// Switches the ciphertext to the registered key set `toId`, using the key switching key registered from the
+// ciphertext's key set to `toId`. The plaintext value is preserved, but the result has a different serialization
+// and therefore a different hash.
+func (ct *TfheCiphertext) SwitchKeySet(toId uint32) (*TfheCiphertext, error) {
+	// The key switching key must not be replaced while in use, see setKeySwitchingKey().
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	to, found := keySets[toId]
+	if !found {
+		return nil, fmt.Errorf("%w: %08x", ErrUnknownKeySet, toId)
+	}
+	ksk, found := to.ksks[ct.KeySetId]
+	if !found {
+		return nil, fmt.Errorf("%w: from %08x to %08x", ErrNoKeySwitchingKey, ct.KeySetId, toId)
+	}
+	ptr := ct.DeserializeToPtr()
+	if ptr == nil {
+		return nil, fmt.Errorf("%s ciphertext deserialization failed", ct.FheUintType)
+	}
+	defer destroyCiphertext(ptr, ct.FheUintType)
+	var resPtr unsafe.Pointer
+	switch ct.FheUintType {
+	case FheBool:
+		resPtr = C.key_switch_fhe_bool(ptr, ksk, to.sks)
+	case FheUint4:
+		resPtr = C.key_switch_fhe_uint4(ptr, ksk, to.sks)
+	case FheUint8:
+		resPtr = C.key_switch_fhe_uint8(ptr, ksk, to.sks)
+	case FheUint16:
+		resPtr = C.key_switch_fhe_uint16(ptr, ksk, to.sks)
+	case FheUint32:
+		resPtr = C.key_switch_fhe_uint32(ptr, ksk, to.sks)
+	case FheUint64:
+		resPtr = C.key_switch_fhe_uint64(ptr, ksk, to.sks)
+	case FheUint128:
+		resPtr = C.key_switch_fhe_uint128(ptr, ksk, to.sks)
+	case FheUint160:
+		resPtr = C.key_switch_fhe_uint160(ptr, ksk, to.sks)
+	case FheUint2048:
+		resPtr = C.key_switch_fhe_uint2048(ptr, ksk, to.sks)
+	default:
+		panic("SwitchKeySet: unexpected ciphertext type")
+	}
+	if resPtr == nil {
+		return nil, fmt.Errorf("%s key switching from %08x to %08x failed", ct.FheUintType, ct.KeySetId, toId)
+	}
+	defer destroyCiphertext(resPtr, ct.FheUintType)
+	res := new(TfheCiphertext)
+	var err error
+	res.Serialization, err = serialize(resPtr, ct.FheUintType)
+	if err != nil {
+		return nil, err
+	}
+	res.FheUintType = ct.FheUintType
+	res.KeySetId = toId
 	res.computeHash()
 	return res, nil
 }
 
 func (ct *TfheCiphertext) Decrypt() (big.Int, error) {
+	ks, err := commonKeySet(ct)
+	if err != nil {
+		return *new(big.Int).SetUint64(0), err
+	}
+	cks := ks.cks
 	if cks == nil {
 		return *new(big.Int).SetUint64(0), errors.New("cks is not initialized")
 	}
@@ -2676,69 +3182,82 @@ func (ct *TfheCiphertext) Decrypt() (big.Int, error) {
 	var ret C.int
 	switch ct.FheUintType {
 	case FheBool:
-		ptr := C.deserialize_fhe_bool(toDynamicBufferView(ct.Serialization))
+		ptr, release := ct.borrowNative()
 		if ptr == nil {
 			return *new(big.Int).SetUint64(0), errors.New("failed to deserialize FheBool")
 		}
 		var result C.bool
 		ret = C.decrypt_fhe_bool(cks, ptr, &result)
-		C.destroy_fhe_bool(ptr)
+		release()
 		if result {
 			value = 1
 		} else {
 			value = 0
 		}
 	case FheUint4:
-		ptr := C.deserialize_fhe_uint4(toDynamicBufferView(ct.Serialization))
+		ptr, release := ct.borrowNative()
 		if ptr == nil {
 			return *new(big.Int).SetUint64(0), errors.New("failed to deserialize FheUint4")
 		}
-		defer C.destroy_fhe_uint4(ptr)
+		defer release()
 		var result C.uint8_t
 		ret = C.decrypt_fhe_uint4(cks, ptr, &result)
 		value = uint64(result)
 	case FheUint8:
-		ptr := C.deserialize_fhe_uint8(toDynamicBufferView(ct.Serialization))
+		ptr, release := ct.borrowNative()
 		if ptr == nil {
 			return *new(big.Int).SetUint64(0), errors.New("failed to deserialize FheUint8")
 		}
-		defer C.destroy_fhe_uint8(ptr)
+		defer release()
 		var result C.uint8_t
 		ret = C.decrypt_fhe_uint8(cks, ptr, &result)
 		value = uint64(result)
 	case FheUint16:
-		ptr := C.deserialize_fhe_uint16(toDynamicBufferView(ct.Serialization))
+		ptr, release := ct.borrowNative()
 		if ptr == nil {
 			return *new(big.Int).SetUint64(0), errors.New("failed to deserialize FheUint16")
 		}
-		defer C.destroy_fhe_uint16(ptr)
+		defer release()
 		var result C.uint16_t
 		ret = C.decrypt_fhe_uint16(cks, ptr, &result)
 		value = uint64(result)
 	case FheUint32:
-		ptr := C.deserialize_fhe_uint32(toDynamicBufferView(ct.Serialization))
+		ptr, release := ct.borrowNative()
 		if ptr == nil {
 			return *new(big.Int).SetUint64(0), errors.New("failed to deserialize FheUint32")
 		}
-		defer C.destroy_fhe_uint32(ptr)
+		defer release()
 		var result C.uint32_t
 		ret = C.decrypt_fhe_uint32(cks, ptr, &result)
 		value = uint64(result)
 	case FheUint64:
-		ptr := C.deserialize_fhe_uint64(toDynamicBufferView(ct.Serialization))
+		ptr, release := ct.borrowNative()
 		if ptr == nil {
 			return *new(big.Int).SetUint64(0), errors.New("failed to deserialize FheUint64")
 		}
-		defer C.destroy_fhe_uint64(ptr)
+		defer release()
 		var result C.uint64_t
 		ret = C.decrypt_fhe_uint64(cks, ptr, &result)
 		value = uint64(result)
+	case FheUint128:
+		ptr, release := ct.borrowNative()
+		if ptr == nil {
+			return *new(big.Int).SetUint64(0), errors.New("failed to deserialize FheUint128")
+		}
+		defer release()
+		var result C.U128
+		ret = C.decrypt_fhe_uint128(cks, ptr, &result)
+		if ret != 0 {
+			return *new(big.Int).SetUint64(0), errors.New("failed to decrypt FheUint128")
+		}
+		resultBigInt := *u128ToBigInt(&result)
+		return resultBigInt, nil
 	case FheUint160:
-		ptr := C.deserialize_fhe_uint160(toDynamicBufferView(ct.Serialization))
+		ptr, release := ct.borrowNative()
 		if ptr == nil {
 			return *new(big.Int).SetUint64(0), errors.New("failed to deserialize FheUint160")
 		}
-		defer C.destroy_fhe_uint160(ptr)
+		defer release()
 		var result C.U256
 		ret = C.decrypt_fhe_uint160(cks, ptr, &result)
 		if ret != 0 {
@@ -2747,11 +3266,11 @@ func (ct *TfheCiphertext) Decrypt() (big.Int, error) {
 		resultBigInt := *u256ToBigInt(&result)
 		return resultBigInt, nil
 	case FheUint2048:
-		ptr := C.deserialize_fhe_uint2048(toDynamicBufferView(ct.Serialization))
+		ptr, release := ct.borrowNative()
 		if ptr == nil {
 			return *new(big.Int).SetUint64(0), errors.New("failed to deserialize FheUint2048")
 		}
-		defer C.destroy_fhe_uint2048(ptr)
+		defer release()
 		var result C.U2048
 		ret = C.decrypt_fhe_uint2048(cks, ptr, &result)
 		if ret != 0 {
@@ -2769,7 +3288,7 @@ func (ct *TfheCiphertext) Decrypt() (big.Int, error) {
 }
 
 func (ct *TfheCiphertext) computeHash() {
-	hash := common.BytesToHash(crypto.Keccak256(ct.Serialization))
+	hash := common.BytesToHash(crypto.Keccak256(ct.Serialize()))
 	hash[31] = HashVersion
 	hash[30] = byte(ct.FheUintType)
 	ct.Hash = &hash
@@ -2814,6 +3333,12 @@ func EqArray(lhs []*TfheCiphertext, rhs []*TfheCiphertext) (*TfheCiphertext, err
 		// If lengths are different, return a trivial encryption of false.
 		result.TrivialEncrypt(*big.NewInt(0), FheBool)
 	} else {
+		sks, err := serverKeyOf(append(append([]*TfheCiphertext{}, lhs...), rhs...)...)
+		if err != nil {
+			return nil, err
+		}
+		result.KeySetId = lhs[0].KeySetId
+
 		// Make sure types are the same.
 		lhsType := lhs[0].Type()
 		rhsType := rhs[0].Type()
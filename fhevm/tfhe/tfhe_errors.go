@@ -0,0 +1,41 @@
+package tfhe
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned when deserializing untrusted inputs, e.g. ciphertexts submitted by users. They are wrapped with
+// context, so callers should match them with errors.Is().
+var (
+	// The serialized input is empty or bigger than the allowed size.
+	ErrInvalidInputSize = errors.New("invalid input size")
+	// The serialized input is malformed, was serialized with an unsupported version or its parameters don't conform
+	// to the loaded server key.
+	ErrInvalidSerialization = errors.New("invalid serialization")
+	// The zero-knowledge proof of a proven compact list doesn't verify.
+	ErrInvalidProof = errors.New("invalid proof")
+	// The number or the types of the ciphertexts of a list are not the expected ones, e.g. the ones its verification
+	// was priced with.
+	ErrListMismatch = errors.New("list mismatch")
+)
+
+// Errors returned when computing on ciphertexts encrypted under different or unknown key sets, see KeySet.
+var (
+	// The operands of an operation are encrypted under different key sets.
+	ErrKeySetMismatch = errors.New("key set mismatch")
+	// The key set is not registered.
+	ErrUnknownKeySet = errors.New("unknown key set")
+	// No key switching key is registered between the two key sets.
+	ErrNoKeySwitchingKey = errors.New("no key switching key")
+)
+
+// Returned when the keys of a key set don't work together, see KeySet.SelfTest().
+var ErrKeySetSelfTestFailed = errors.New("key set self-test failed")
+
+func checkInputSize(in []byte, sizeLimit uint64) error {
+	if len(in) == 0 || uint64(len(in)) > sizeLimit {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrInvalidInputSize, len(in), sizeLimit)
+	}
+	return nil
+}
@@ -6,105 +6,552 @@ package tfhe
 import "C"
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"unsafe"
 
 	"PureChain/common"
 	"PureChain/crypto"
 )
 
-// Expanded TFHE ciphertext sizes by type, in bytes.
+// Logger key loading reports through. Implementations of fhevm.Logger satisfy it.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// Expanded TFHE ciphertext sizes by type, in bytes, under the parameter set of the active key set. It is replaced when
+// a key set is activated, so code that may run concurrently with key activation must use
+// GetExpandedFheCiphertextSize() instead.
 var ExpandedFheCiphertextSize map[FheUintType]uint
 
+// Expanded ciphertext sizes by parameter set. They are computed when the first key set of a parameter set is
+// registered.
+var expandedFheCiphertextSizes = make(map[ParameterSet]map[FheUintType]uint)
+
+// Returns the size of an expanded ciphertext of type `t` under the active key set, in bytes.
 func GetExpandedFheCiphertextSize(t FheUintType) (size uint, found bool) {
-	size, found = ExpandedFheCiphertextSize[t]
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	size, found = expandedFheCiphertextSizes[activeKeySet.parameterSet][t]
 	return
 }
 
-// server key: evaluation key
-var sks unsafe.Pointer
+// A set of keys ciphertexts are encrypted under. Several key sets can be registered at once, e.g. while keys are
+// being rotated, such that ciphertexts encrypted under older keys can still be computed on. New ciphertexts are always
+// encrypted under the active key set.
+type KeySet struct {
+	// Identifies the key set, e.g. in persisted ciphertext metadata. It is derived from the public key hash, as the
+	// public key is available on all nodes.
+	id uint32
+	// Order in which the key set was registered, starting at 1. Later key sets are newer.
+	version uint32
+	// Parameters the keys were generated with.
+	parameterSet ParameterSet
+
+	sks     unsafe.Pointer
+	cks     unsafe.Pointer
+	pks     unsafe.Pointer
+	pksHash common.Hash
+
+	publicParams     unsafe.Pointer
+	publicParamsHash common.Hash
+
+	// Key switching keys from other key sets to this one, by source key set id.
+	ksks map[uint32]unsafe.Pointer
+}
+
+func (ks *KeySet) Id() uint32 {
+	return ks.id
+}
+
+func (ks *KeySet) Version() uint32 {
+	return ks.version
+}
+
+func (ks *KeySet) PksHash() common.Hash {
+	return ks.pksHash
+}
+
+func (ks *KeySet) ParameterSet() ParameterSet {
+	return ks.parameterSet
+}
+
+// Returns the size of an expanded ciphertext of type `t` under the key set, in bytes.
+func (ks *KeySet) ExpandedCiphertextSize(t FheUintType) uint {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return expandedFheCiphertextSizes[ks.parameterSet][t]
+}
+
+func keySetIdFromPksHash(pksHash common.Hash) uint32 {
+	return binary.BigEndian.Uint32(pksHash[:4])
+}
+
+// Guards the registered key sets, the active key set, the key switching keys of key sets and the expanded ciphertext
+// sizes. Operations running concurrently on several goroutines read them while keys may be registered, activated or
+// rotated. Keys themselves are immutable once registered, so operations only hold the lock to look them up, except
+// for key switching keys, which can be replaced.
+var keysMu sync.RWMutex
+
+// Registered key sets, by id.
+var keySets = make(map[uint32]*KeySet)
+
+// Key set new ciphertexts are encrypted under. It is an empty key set if no keys are loaded. It must be read with
+// currentKeySet() by code that may run concurrently with key activation.
+var activeKeySet = &KeySet{}
+
+// Returns the active key set. Operations that use several of its keys must take them from a single call, such that
+// they all come from the same key set even if another one is activated meanwhile.
+func currentKeySet() *KeySet {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return activeKeySet
+}
 
-// client key: secret key
-var cks unsafe.Pointer
+func registerKeySet(ks *KeySet) error {
+	// Computing the sizes encrypts under the key set, so it is done before taking the lock.
+	sizes := expandedCiphertextSizes(ks)
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if _, found := keySets[ks.id]; found {
+		return fmt.Errorf("key set %08x is already registered", ks.id)
+	}
+	ks.version = uint32(len(keySets) + 1)
+	if ks.ksks == nil {
+		ks.ksks = make(map[uint32]unsafe.Pointer)
+	}
+	keySets[ks.id] = ks
+	if _, found := expandedFheCiphertextSizes[ks.parameterSet]; !found {
+		expandedFheCiphertextSizes[ks.parameterSet] = sizes
+	}
+	return nil
+}
 
-// public key
-var pks unsafe.Pointer
-var pksHash common.Hash
+func activateKeySet(ks *KeySet) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	activeKeySet = ks
+	ExpandedFheCiphertextSize = expandedFheCiphertextSizes[ks.parameterSet]
+}
+
+// Makes the registered key set `id` the one new ciphertexts are encrypted under. Operations already running when it
+// is called complete under the key set that was active when they started.
+func ActivateKeySet(id uint32) error {
+	ks, found := GetKeySet(id)
+	if !found {
+		return fmt.Errorf("%w: %08x", ErrUnknownKeySet, id)
+	}
+	activateKeySet(ks)
+	return nil
+}
+
+// Returns the registered key set `id`.
+func GetKeySet(id uint32) (*KeySet, bool) {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	ks, found := keySets[id]
+	return ks, found
+}
+
+// Returns the ids of all registered key sets, oldest first.
+func GetKeySetIds() []uint32 {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	ids := make([]uint32, len(keySets))
+	for id, ks := range keySets {
+		ids[ks.version-1] = id
+	}
+	return ids
+}
+
+// Operands and expected result of the self-test addition. FheUint16 values make it unlikely that a mismatched key
+// decrypts to the expected sum by chance.
+const (
+	selfTestLhs uint16 = 12345
+	selfTestRhs uint16 = 23456
+)
+
+// Checks that the keys of the key set work together: two values are encrypted with the public key and added with the
+// server key. If the client key is present, the sum is decrypted and compared to the expected one. Without the client
+// key, a server key that doesn't match the public key can't be detected, only one that fails to compute.
+func (ks *KeySet) SelfTest() error {
+	if ks.sks == nil || ks.pks == nil {
+		return fmt.Errorf("%w: server or public key is missing", ErrKeySetSelfTestFailed)
+	}
+	lhs := C.public_key_encrypt_fhe_uint16(ks.pks, C.uint16_t(selfTestLhs))
+	defer C.destroy_fhe_uint16(lhs)
+	rhs := C.public_key_encrypt_fhe_uint16(ks.pks, C.uint16_t(selfTestRhs))
+	defer C.destroy_fhe_uint16(rhs)
+	sum := C.add_fhe_uint16(lhs, rhs, ks.sks)
+	if sum == nil {
+		return fmt.Errorf("%w: server key failed to add ciphertexts encrypted with the public key", ErrKeySetSelfTestFailed)
+	}
+	defer C.destroy_fhe_uint16(sum)
+	if ks.cks == nil {
+		return nil
+	}
+	var result C.uint16_t
+	if ret := C.decrypt_fhe_uint16(ks.cks, sum, &result); ret != 0 {
+		return fmt.Errorf("%w: client key failed to decrypt", ErrKeySetSelfTestFailed)
+	}
+	if expected := selfTestLhs + selfTestRhs; uint16(result) != expected {
+		return fmt.Errorf("%w: %d + %d decrypted to %d, keys don't belong together", ErrKeySetSelfTestFailed,
+			selfTestLhs, selfTestRhs, uint16(result))
+	}
+	return nil
+}
+
+// Generates a key switching key from key set `fromId` to key set `toId` and registers it. Both key sets need their
+// client keys, so this is only possible where the keys are generated. Returns the serialized key switching key, e.g.
+// to be saved as the "ksk-<fromId>" file of the `toId` key set, see loadKeySetFromDir().
+func GenerateKeySwitchingKey(fromId uint32, toId uint32) ([]byte, error) {
+	from, found := GetKeySet(fromId)
+	if !found {
+		return nil, fmt.Errorf("%w: %08x", ErrUnknownKeySet, fromId)
+	}
+	to, found := GetKeySet(toId)
+	if !found {
+		return nil, fmt.Errorf("%w: %08x", ErrUnknownKeySet, toId)
+	}
+	if from.parameterSet != ParameterSetDefault || to.parameterSet != ParameterSetDefault {
+		return nil, fmt.Errorf("key switching keys can only be generated between key sets of the %s parameter set, not from %s to %s",
+			ParameterSetDefault, from.parameterSet, to.parameterSet)
+	}
+	if from.cks == nil || to.cks == nil {
+		return nil, errors.New("generating a key switching key requires the client keys of both key sets")
+	}
+	ksk := C.generate_key_switching_key(from.cks, from.sks, to.cks, to.sks)
+	if ksk == nil {
+		return nil, fmt.Errorf("failed to generate key switching key from %08x to %08x", fromId, toId)
+	}
+	out := &C.DynamicBuffer{}
+	if ret := C.serialize_key_switching_key(ksk, out); ret != 0 {
+		C.destroy_key_switching_key(ksk)
+		return nil, fmt.Errorf("failed to serialize key switching key from %08x to %08x", fromId, toId)
+	}
+	ser := C.GoBytes(unsafe.Pointer(out.pointer), C.int(out.length))
+	C.destroy_dynamic_buffer(out)
+	setKeySwitchingKey(to, fromId, ksk)
+	return ser, nil
+}
+
+// Registers the serialized key switching key `in`, from key set `fromId` to the registered key set `toId`. The source
+// key set doesn't need to be registered.
+func RegisterKeySwitchingKey(fromId uint32, toId uint32, in []byte) error {
+	to, found := GetKeySet(toId)
+	if !found {
+		return fmt.Errorf("%w: %08x", ErrUnknownKeySet, toId)
+	}
+	ksk := C.deserialize_key_switching_key(toDynamicBufferView(in))
+	if ksk == nil {
+		return fmt.Errorf("%w: key switching key from %08x to %08x", ErrInvalidSerialization, fromId, toId)
+	}
+	setKeySwitchingKey(to, fromId, ksk)
+	return nil
+}
+
+// Replacing a key switching key destroys the old one, so it waits for key switching operations in progress, see
+// TfheCiphertext.SwitchKeySet().
+func setKeySwitchingKey(to *KeySet, fromId uint32, ksk unsafe.Pointer) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if old, found := to.ksks[fromId]; found {
+		C.destroy_key_switching_key(old)
+	}
+	to.ksks[fromId] = ksk
+}
+
+// Returns the key set all of `cts` are encrypted under. Computing on ciphertexts from different key sets is not
+// possible, so an error is returned for them.
+func commonKeySet(cts ...*TfheCiphertext) (*KeySet, error) {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	if len(cts) == 0 {
+		return activeKeySet, nil
+	}
+	id := cts[0].KeySetId
+	for _, ct := range cts[1:] {
+		if ct.KeySetId != id {
+			return nil, fmt.Errorf("%w: %08x and %08x", ErrKeySetMismatch, id, ct.KeySetId)
+		}
+	}
+	if id == activeKeySet.id {
+		return activeKeySet, nil
+	}
+	ks, found := keySets[id]
+	if !found {
+		return nil, fmt.Errorf("%w: %08x", ErrUnknownKeySet, id)
+	}
+	return ks, nil
+}
+
+// Returns the server key to compute on `cts` with, see commonKeySet().
+func serverKeyOf(cts ...*TfheCiphertext) (unsafe.Pointer, error) {
+	ks, err := commonKeySet(cts...)
+	if err != nil {
+		return nil, err
+	}
+	return ks.sks, nil
+}
 
 // Get public key hash
 func GetPksHash() common.Hash {
-	return pksHash
+	return currentKeySet().pksHash
+}
+
+// Identifies the active key set, see KeySet.
+func GetKeySetId() uint32 {
+	return currentKeySet().id
+}
+
+// Returns the parameter set of the active key set.
+func GetParameterSet() ParameterSet {
+	return currentKeySet().parameterSet
+}
+
+// Maximum number of plaintext bits a single proven compact list can hold. Large enough for two FheUint2048 values or
+// one FheUint2048 value alongside smaller ones.
+const CrsMaxNumBits = 4096
+
+// Get CRS public parameters hash
+func GetPublicParamsHash() common.Hash {
+	return currentKeySet().publicParamsHash
+}
+
+func PublicParamsPresent() bool {
+	return currentKeySet().publicParams != nil
 }
 
 // Generate keys for the fhevm (sks, cks, psk)
-func generateFhevmKeys() (unsafe.Pointer, unsafe.Pointer, unsafe.Pointer) {
-	var keys = C.generate_fhevm_keys()
+func generateFhevmKeys(p ParameterSet) (unsafe.Pointer, unsafe.Pointer, unsafe.Pointer) {
+	var keys = C.generate_fhevm_keys(C.uint8_t(p))
 	return keys.sks, keys.cks, keys.pks
 }
 
 func AllGlobalKeysPresent() bool {
-	return sks != nil && cks != nil && pks != nil
+	ks := currentKeySet()
+	return ks.sks != nil && ks.cks != nil && ks.pks != nil
 }
 
-func InitGlobalKeysWithNewKeys() {
-	sks, cks, pks = generateFhevmKeys()
-	initCiphertextSizes()
+// Generates and registers a new key set with the default parameter set, including CRS public parameters, without
+// activating it.
+func GenerateKeySet() (*KeySet, error) {
+	return GenerateKeySetWithParameters(ParameterSetDefault, true)
+}
+
+// Same as GenerateKeySet(), but without CRS public parameters, which are slow to generate. Proven input lists can't
+// be verified with the resulting key set.
+func GenerateKeySetWithoutCrs() (*KeySet, error) {
+	return GenerateKeySetWithParameters(ParameterSetDefault, false)
 }
 
-func initCiphertextSizes() {
-	ExpandedFheCiphertextSize = make(map[FheUintType]uint)
+// Generates and registers a new key set with the parameter set `p`, without activating it. CRS public parameters are
+// only generated if `withCrs` is set.
+func GenerateKeySetWithParameters(p ParameterSet, withCrs bool) (*KeySet, error) {
+	if !p.IsValid() {
+		return nil, fmt.Errorf("cannot generate keys: %s", p)
+	}
+	ks := &KeySet{parameterSet: p}
+	ks.sks, ks.cks, ks.pks = generateFhevmKeys(p)
+	pksBytes, err := serializePublicKey(ks.pks)
+	if err != nil {
+		return nil, err
+	}
+	ks.pksHash = crypto.Keccak256Hash(pksBytes)
+	ks.id = keySetIdFromPksHash(ks.pksHash)
+	if withCrs {
+		ks.publicParams = C.generate_public_params(C.uint8_t(p), C.size_t(CrsMaxNumBits))
+		publicParamsBytes, err := serializePublicParams(ks.publicParams)
+		if err != nil {
+			return nil, err
+		}
+		ks.publicParamsHash = crypto.Keccak256Hash(publicParamsBytes)
+	}
+	if err := registerKeySet(ks); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
 
-	ExpandedFheCiphertextSize[FheBool] = uint(len(new(TfheCiphertext).TrivialEncrypt(*big.NewInt(0), FheBool).Serialize()))
-	ExpandedFheCiphertextSize[FheUint4] = uint(len(new(TfheCiphertext).TrivialEncrypt(*big.NewInt(0), FheUint4).Serialize()))
-	ExpandedFheCiphertextSize[FheUint8] = uint(len(new(TfheCiphertext).TrivialEncrypt(*big.NewInt(0), FheUint8).Serialize()))
-	ExpandedFheCiphertextSize[FheUint16] = uint(len(new(TfheCiphertext).TrivialEncrypt(*big.NewInt(0), FheUint16).Serialize()))
-	ExpandedFheCiphertextSize[FheUint32] = uint(len(new(TfheCiphertext).TrivialEncrypt(*big.NewInt(0), FheUint32).Serialize()))
-	ExpandedFheCiphertextSize[FheUint64] = uint(len(new(TfheCiphertext).TrivialEncrypt(*big.NewInt(0), FheUint64).Serialize()))
-	ExpandedFheCiphertextSize[FheUint160] = uint(len(new(TfheCiphertext).TrivialEncrypt(*big.NewInt(0), FheUint160).Serialize()))
-	ExpandedFheCiphertextSize[FheUint2048] = uint(len(new(TfheCiphertext).TrivialEncrypt(*big.NewInt(0), FheUint2048).Serialize()))
+func InitGlobalKeysWithNewKeys() {
+	ks, err := GenerateKeySet()
+	if err != nil {
+		panic(err)
+	}
+	activateKeySet(ks)
 }
 
-func InitGlobalKeysFromFiles(keysDir string) error {
-	if _, err := os.Stat(keysDir); os.IsNotExist(err) {
-		return fmt.Errorf("init_keys: global keys directory doesn't exist (FHEVM_GO_KEYS_DIR): %s", keysDir)
+// Computes the expanded ciphertext sizes under the parameter set of `ks`, by trivially encrypting under it.
+func expandedCiphertextSizes(ks *KeySet) map[FheUintType]uint {
+	sizes := make(map[FheUintType]uint)
+	for _, t := range []FheUintType{FheBool, FheUint4, FheUint8, FheUint16, FheUint32, FheUint64, FheUint128, FheUint160, FheUint2048} {
+		sizes[t] = uint(len(new(TfheCiphertext).trivialEncrypt(*big.NewInt(0), t, ks).Serialize()))
 	}
+	return sizes
+}
+
+// Serializes key loading, see InitGlobalKeysFromFiles().
+var keyLoadingMu sync.Mutex
+
+func keysPresentInDir(keysDir string) bool {
+	_, err := os.Stat(path.Join(keysDir, ServerKeyFileName))
+	return err == nil
+}
+
+// Loads and registers the key set in `keysDir`. If the directory holds a manifest, the key files are checked against
+// it first. The key set is only registered if it passes its self-test.
+func loadKeySetFromDir(keysDir string, logger Logger) (*KeySet, error) {
 	// read keys from files
-	var sksPath = path.Join(keysDir, "sks")
+	var sksPath = path.Join(keysDir, ServerKeyFileName)
 	sksBytes, err := os.ReadFile(sksPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	var pksPath = path.Join(keysDir, "pks")
+	var pksPath = path.Join(keysDir, PublicKeyFileName)
 	pksBytes, err := os.ReadFile(pksPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	sks = C.deserialize_server_key(toDynamicBufferView(sksBytes))
-
-	pksHash = crypto.Keccak256Hash(pksBytes)
-	pks = C.deserialize_compact_public_key(toDynamicBufferView(pksBytes))
+	ks := &KeySet{}
+	ks.pksHash = crypto.Keccak256Hash(pksBytes)
+	ks.id = keySetIdFromPksHash(ks.pksHash)
+	// Loading the same keys again, e.g. when initializing several fhEVM instances, reuses the registered key set.
+	if registered, found := GetKeySet(ks.id); found {
+		logger.Info("key set is already loaded", "keySetId", fmt.Sprintf("%08x", ks.id), "dir", keysDir)
+		return registered, nil
+	}
 
-	initCiphertextSizes()
+	// Keys without a manifest predate parameter set selection, so they have the default parameter set.
+	if _, err := os.Stat(path.Join(keysDir, KeyManifestFileName)); err == nil {
+		manifest, err := VerifyKeyManifest(keysDir)
+		if err != nil {
+			logger.Error("key files don't match their manifest", "dir", keysDir, "err", err)
+			return nil, fmt.Errorf("init_keys: %s: %v", keysDir, err)
+		}
+		if ks.parameterSet, err = manifest.GetParameterSet(); err != nil {
+			return nil, fmt.Errorf("init_keys: %s: %v", keysDir, err)
+		}
+		logger.Info("key files match their manifest", "dir", keysDir, "parameterSet", ks.parameterSet)
+	} else {
+		logger.Info("no key manifest found, key file checksums are not verified", "dir", keysDir,
+			"parameterSet", ks.parameterSet)
+	}
 
-	fmt.Println("INFO: global keys loaded from: " + keysDir)
+	ks.sks = C.deserialize_server_key(toDynamicBufferView(sksBytes))
+	ks.pks = C.deserialize_compact_public_key(toDynamicBufferView(pksBytes))
 
-	return nil
-}
+	// The client key is optional, e.g. if decryption is done by a KMS. With it, the self-test also checks decryption.
+	var cksPath = path.Join(keysDir, ClientKeyFileName)
+	if _, err := os.Stat(cksPath); err == nil {
+		cksBytes, err := os.ReadFile(cksPath)
+		if err != nil {
+			return nil, err
+		}
+		ks.cks = C.deserialize_client_key(toDynamicBufferView(cksBytes))
+	}
 
-// initialize keys automatically only if FHEVM_GO_KEYS_DIR is set
-func init() {
-	var keysDirPath, present = os.LookupEnv("FHEVM_GO_KEYS_DIR")
-	if present {
-		err := InitGlobalKeysFromFiles(keysDirPath)
+	// The CRS is optional. Without it, proven compact lists can't be verified.
+	var crsPath = path.Join(keysDir, PublicParamsFileName)
+	if _, err := os.Stat(crsPath); err == nil {
+		crsBytes, err := os.ReadFile(crsPath)
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+		ks.publicParams = C.deserialize_public_params(toDynamicBufferView(crsBytes))
+		if ks.publicParams == nil {
+			return nil, fmt.Errorf("init_keys: failed to deserialize CRS public parameters from: %s", crsPath)
 		}
-		fmt.Println("INFO: global keys are initialized automatically using FHEVM_GO_KEYS_DIR env variable")
+		ks.publicParamsHash = crypto.Keccak256Hash(crsBytes)
 	} else {
-		fmt.Println("INFO: global keys aren't initialized automatically (FHEVM_GO_KEYS_DIR env variable not set)")
+		logger.Info("no CRS found, proven input lists can't be verified", "dir", keysDir)
+	}
+
+	if err := ks.SelfTest(); err != nil {
+		logger.Error("key set self-test failed", "keySetId", fmt.Sprintf("%08x", ks.id), "dir", keysDir, "err", err)
+		return nil, fmt.Errorf("init_keys: %s: %w", keysDir, err)
 	}
+	logger.Info("key set self-test passed", "keySetId", fmt.Sprintf("%08x", ks.id), "clientKey", ks.cks != nil)
+
+	if err := registerKeySet(ks); err != nil {
+		return nil, fmt.Errorf("init_keys: %s: %v", keysDir, err)
+	}
+
+	// Key switching keys from other key sets are optional and named after their source key set, e.g. "ksk-1a2b3c4d".
+	kskPaths, err := filepath.Glob(path.Join(keysDir, "ksk-*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, kskPath := range kskPaths {
+		fromId, err := strconv.ParseUint(strings.TrimPrefix(path.Base(kskPath), "ksk-"), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("init_keys: invalid key switching key file name: %s", kskPath)
+		}
+		kskBytes, err := os.ReadFile(kskPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := RegisterKeySwitchingKey(uint32(fromId), ks.id, kskBytes); err != nil {
+			return nil, fmt.Errorf("init_keys: %s: %w", kskPath, err)
+		}
+	}
+	logger.Info("key set loaded", "keySetId", fmt.Sprintf("%08x", ks.id), "dir", keysDir)
+	return ks, nil
+}
+
+// Loads the key sets in `keysDir`. Keys directly in `keysDir` form the active key set. Each subdirectory holding keys
+// is loaded as an additional key set, in lexical order of the subdirectory names. If there are no keys directly in
+// `keysDir`, the key set of the last subdirectory is the active one, e.g. for the layout:
+//
+//	keysDir/v1/{sks,pks,crs}
+//	keysDir/v2/{sks,pks,crs}
+//
+// ciphertexts are encrypted under v2, while ciphertexts encrypted under v1 can still be computed on.
+//
+// Each key set is checked against the manifest of its directory, if any, and self-tested before it is registered, see
+// KeySet.SelfTest(). Progress and failures are reported through `logger`.
+//
+// It can be called concurrently, e.g. by several fhEVM instances initialized at once: calls are serialized, such that
+// keys loaded by one call are reused by the others.
+func InitGlobalKeysFromFiles(keysDir string, logger Logger) error {
+	keyLoadingMu.Lock()
+	defer keyLoadingMu.Unlock()
+	if _, err := os.Stat(keysDir); os.IsNotExist(err) {
+		return fmt.Errorf("init_keys: global keys directory doesn't exist (FHEVM_GO_KEYS_DIR): %s", keysDir)
+	}
+	entries, err := os.ReadDir(keysDir)
+	if err != nil {
+		return err
+	}
+	var active *KeySet
+	// os.ReadDir() returns entries sorted by name.
+	for _, entry := range entries {
+		subDir := path.Join(keysDir, entry.Name())
+		if !entry.IsDir() || !keysPresentInDir(subDir) {
+			continue
+		}
+		if active, err = loadKeySetFromDir(subDir, logger); err != nil {
+			return err
+		}
+	}
+	if keysPresentInDir(keysDir) || active == nil {
+		if active, err = loadKeySetFromDir(keysDir, logger); err != nil {
+			return err
+		}
+	}
+	activateKeySet(active)
+
+	logger.Info("global keys loaded", "dir", keysDir, "activeKeySetId", fmt.Sprintf("%08x", active.id))
+
+	return nil
 }
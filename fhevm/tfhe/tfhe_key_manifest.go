@@ -0,0 +1,166 @@
+package tfhe
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"PureChain/common"
+	"PureChain/crypto"
+)
+
+// Name of the manifest file in a keys directory.
+const KeyManifestFileName = "manifest.json"
+
+const keyManifestVersion = 1
+
+// Names of the key files in a keys directory. Only "sks" and "pks" are required to load a key set.
+const (
+	ServerKeyFileName    = "sks"
+	ClientKeyFileName    = "cks"
+	PublicKeyFileName    = "pks"
+	PublicParamsFileName = "crs"
+)
+
+// Describes the key set in a keys directory: which parameters it was generated with and the hashes of its files.
+type KeyManifest struct {
+	Version int `json:"version"`
+	// Key set id, as returned by KeySet.Id(), in hex.
+	KeySetId string `json:"keySetId"`
+	// Parameter set name, as returned by ParameterSet.String(). Manifests without it are of the default parameter set.
+	ParameterSet          string `json:"parameterSet,omitempty"`
+	Parameters            string `json:"parameters"`
+	CompressionParameters string `json:"compressionParameters"`
+	// Maximum number of bits a proven compact list can hold, if the CRS is present.
+	CrsMaxNumBits int `json:"crsMaxNumBits,omitempty"`
+	// Key files, by file name.
+	Files map[string]KeyManifestFile `json:"files"`
+}
+
+type KeyManifestFile struct {
+	// Keccak256 hash of the file, e.g. the same as GetPksHash() for the public key.
+	Keccak256 common.Hash `json:"keccak256"`
+	Size      int         `json:"size"`
+}
+
+// Writes the keys of `ks` to `keysDir`, along with a manifest, and returns the manifest. The CRS is only written if the
+// key set holds it, the client key only if `withClientKey` is set too. `keysDir` is created if it doesn't exist.
+func WriteKeySetToDir(ks *KeySet, keysDir string, withClientKey bool) (*KeyManifest, error) {
+	files := make(map[string][]byte)
+	var err error
+	if files[ServerKeyFileName], err = serializeServerKey(ks.sks); err != nil {
+		return nil, err
+	}
+	if files[PublicKeyFileName], err = serializePublicKey(ks.pks); err != nil {
+		return nil, err
+	}
+	if withClientKey && ks.cks != nil {
+		if files[ClientKeyFileName], err = serializeClientKey(ks.cks); err != nil {
+			return nil, err
+		}
+	}
+	if ks.publicParams != nil {
+		if files[PublicParamsFileName], err = serializePublicParams(ks.publicParams); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest := &KeyManifest{
+		Version:               keyManifestVersion,
+		KeySetId:              fmt.Sprintf("%08x", ks.id),
+		ParameterSet:          ks.parameterSet.String(),
+		Parameters:            ks.parameterSet.ParametersName(),
+		CompressionParameters: CompressionParametersName,
+		Files:                 make(map[string]KeyManifestFile),
+	}
+	if ks.publicParams != nil {
+		manifest.CrsMaxNumBits = CrsMaxNumBits
+	}
+	if err := os.MkdirAll(keysDir, 0o755); err != nil {
+		return nil, err
+	}
+	for name, bytes := range files {
+		// Only the public key and the CRS are public.
+		perm := os.FileMode(0o600)
+		if name == PublicKeyFileName || name == PublicParamsFileName {
+			perm = 0o644
+		}
+		if err := os.WriteFile(path.Join(keysDir, name), bytes, perm); err != nil {
+			return nil, err
+		}
+		manifest.Files[name] = KeyManifestFile{Keccak256: crypto.Keccak256Hash(bytes), Size: len(bytes)}
+	}
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path.Join(keysDir, KeyManifestFileName), manifestBytes, 0o644); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func ReadKeyManifest(keysDir string) (*KeyManifest, error) {
+	manifestBytes, err := os.ReadFile(path.Join(keysDir, KeyManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &KeyManifest{}
+	if err := json.Unmarshal(manifestBytes, manifest); err != nil {
+		return nil, fmt.Errorf("invalid key manifest in %s: %v", keysDir, err)
+	}
+	return manifest, nil
+}
+
+// Returns the parameter set of the manifest's keys.
+func (manifest *KeyManifest) GetParameterSet() (ParameterSet, error) {
+	if manifest.ParameterSet == "" {
+		return ParameterSetDefault, nil
+	}
+	return ParseParameterSet(manifest.ParameterSet)
+}
+
+// Checks the files in `keysDir` against its manifest: every file listed must be present with the listed hash and
+// size, the public key must match the key set id and the parameters must be the ones of the manifest's parameter set.
+// Returns the manifest.
+func VerifyKeyManifest(keysDir string) (*KeyManifest, error) {
+	manifest, err := ReadKeyManifest(keysDir)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Version != keyManifestVersion {
+		return nil, fmt.Errorf("unsupported key manifest version %d", manifest.Version)
+	}
+	parameterSet, err := manifest.GetParameterSet()
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Parameters != parameterSet.ParametersName() || manifest.CompressionParameters != CompressionParametersName {
+		return nil, fmt.Errorf("keys were generated with parameters %s and %s, expected %s and %s for the %s parameter set",
+			manifest.Parameters, manifest.CompressionParameters, parameterSet.ParametersName(), CompressionParametersName,
+			parameterSet)
+	}
+	for _, required := range []string{ServerKeyFileName, PublicKeyFileName} {
+		if _, found := manifest.Files[required]; !found {
+			return nil, fmt.Errorf("key manifest doesn't list the %s file", required)
+		}
+	}
+	for name, file := range manifest.Files {
+		bytes, err := os.ReadFile(path.Join(keysDir, name))
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes) != file.Size {
+			return nil, fmt.Errorf("%s file has size %d, manifest says %d", name, len(bytes), file.Size)
+		}
+		if hash := crypto.Keccak256Hash(bytes); hash != file.Keccak256 {
+			return nil, fmt.Errorf("%s file has hash %s, manifest says %s", name, hash.Hex(), file.Keccak256.Hex())
+		}
+	}
+	keySetId := fmt.Sprintf("%08x", keySetIdFromPksHash(manifest.Files[PublicKeyFileName].Keccak256))
+	if keySetId != manifest.KeySetId {
+		return nil, fmt.Errorf("public key has key set id %s, manifest says %s", keySetId, manifest.KeySetId)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,165 @@
+package tfhe
+
+import (
+	"container/list"
+	"unsafe"
+)
+
+// Keeps deserialized ciphertexts alive across operations, such that chained operations don't deserialize their
+// operands again. It doesn't save serializations: the handle of a ciphertext is the hash of its serialization, so
+// FheLib results are serialized right after the operation, as are results inserted in the ResultCache.
+//
+// Ciphertexts use a cache once attached to it with Attach(), and results of operations on attached ciphertexts are
+// attached too. The cache is bounded by the expanded size of the ciphertexts it holds, as an approximation of their
+// native size: the least recently used ones are serialized, if needed, and destroyed to make room. A cache is not
+// safe for concurrent use and must be released with Release() once it is no longer needed, e.g. at the end of a
+// transaction, as the native ciphertexts it holds are not garbage collected.
+type NativeCiphertextCache struct {
+	maxBytes uint64
+	bytes    uint64
+	// Ciphertexts holding a native pointer, least recently used first.
+	lru      *list.List
+	released bool
+}
+
+func NewNativeCiphertextCache(maxBytes uint64) *NativeCiphertextCache {
+	return &NativeCiphertextCache{maxBytes: maxBytes, lru: list.New()}
+}
+
+// Makes `ct` use the cache. Ciphertexts attached to another cache that is not released yet keep using it.
+func (c *NativeCiphertextCache) Attach(ct *TfheCiphertext) {
+	if c == nil || c.released || ct.nativeCache.usable() {
+		return
+	}
+	ct.nativeCache = c
+}
+
+// Returns the number of native ciphertexts held.
+func (c *NativeCiphertextCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	return c.lru.Len()
+}
+
+// Returns the approximate size of the native ciphertexts held, in bytes.
+func (c *NativeCiphertextCache) Bytes() uint64 {
+	if c == nil {
+		return 0
+	}
+	return c.bytes
+}
+
+// Serializes the held ciphertexts that are not serialized yet and destroys all native ciphertexts. Ciphertexts
+// attached to the cache stay usable, but don't use a cache anymore.
+func (c *NativeCiphertextCache) Release() {
+	if c == nil || c.released {
+		return
+	}
+	for c.lru.Len() != 0 {
+		c.evict(c.lru.Front())
+	}
+	c.released = true
+}
+
+func (c *NativeCiphertextCache) usable() bool {
+	return c != nil && !c.released
+}
+
+// Makes the cache hold `ptr` as the native ciphertext of `ct`, evicting the least recently used unpinned ciphertexts
+// to make room for it. Returns false if there is no room, in which case the caller keeps ownership of `ptr`.
+func (c *NativeCiphertextCache) admit(ct *TfheCiphertext, ptr unsafe.Pointer) bool {
+	if !c.usable() {
+		return false
+	}
+	size := nativeCiphertextSize(ct)
+	if size > c.maxBytes {
+		return false
+	}
+	for elem := c.lru.Front(); elem != nil && c.bytes+size > c.maxBytes; {
+		next := elem.Next()
+		if elem.Value.(*TfheCiphertext).pins == 0 {
+			c.evict(elem)
+		}
+		elem = next
+	}
+	if c.bytes+size > c.maxBytes {
+		return false
+	}
+	ct.native = ptr
+	ct.nativeElem = c.lru.PushBack(ct)
+	c.bytes += size
+	return true
+}
+
+func (c *NativeCiphertextCache) touch(ct *TfheCiphertext) {
+	c.lru.MoveToBack(ct.nativeElem)
+}
+
+func (c *NativeCiphertextCache) evict(elem *list.Element) {
+	ct := c.lru.Remove(elem).(*TfheCiphertext)
+	// The native ciphertext is the only representation of results that were not serialized yet.
+	ct.Serialize()
+	destroyCiphertext(ct.native, ct.FheUintType)
+	ct.native = nil
+	ct.nativeElem = nil
+	c.bytes -= nativeCiphertextSize(ct)
+}
+
+func nativeCiphertextSize(ct *TfheCiphertext) uint64 {
+	if ks, found := GetKeySet(ct.KeySetId); found {
+		return uint64(ks.ExpandedCiphertextSize(ct.FheUintType))
+	}
+	size, _ := GetExpandedFheCiphertextSize(ct.FheUintType)
+	return uint64(size)
+}
+
+// Returns the usable cache of the first of `cts` that has one, if any.
+func nativeCacheOf(cts ...*TfheCiphertext) *NativeCiphertextCache {
+	for _, ct := range cts {
+		if ct.nativeCache.usable() {
+			return ct.nativeCache
+		}
+	}
+	return nil
+}
+
+// Returns the native ciphertext of `ct` and a function to call once done with it. The native ciphertext is taken
+// from the cache if held there. Otherwise, it is deserialized and admitted to the cache, if any. It is pinned until
+// the returned function is called, such that it is not evicted while in use. Returns a nil pointer if
+// deserialization fails.
+func (ct *TfheCiphertext) borrowNative() (unsafe.Pointer, func()) {
+	if ct.native != nil {
+		ct.nativeCache.touch(ct)
+		ct.pins++
+		return ct.native, ct.unpin
+	}
+	ptr := Deserialize(ct.Serialize(), ct.FheUintType)
+	if ptr == nil {
+		return nil, func() {}
+	}
+	if ct.nativeCache.admit(ct, ptr) {
+		ct.pins++
+		return ptr, ct.unpin
+	}
+	return ptr, func() { destroyCiphertext(ptr, ct.FheUintType) }
+}
+
+func (ct *TfheCiphertext) unpin() {
+	ct.pins--
+}
+
+// Takes ownership of `ptr`, the native result of an operation. It is held by the cache of `ct`, if any, and only
+// serialized when needed. Otherwise, it is serialized right away and destroyed.
+func (ct *TfheCiphertext) adoptNative(ptr unsafe.Pointer) error {
+	if ct.nativeCache.admit(ct, ptr) {
+		return nil
+	}
+	defer destroyCiphertext(ptr, ct.FheUintType)
+	ser, err := serialize(ptr, ct.FheUintType)
+	if err != nil {
+		return err
+	}
+	ct.Serialization = ser
+	return nil
+}
@@ -0,0 +1,59 @@
+package tfhe
+
+import "fmt"
+
+// TFHE parameter set a key set is generated with, see fhevm_config() in tfhe_wrappers.c. Ciphertexts are only
+// compatible with keys of their parameter set, so a chain picks one and all its nodes must use it.
+type ParameterSet uint8
+
+const (
+	// Classic PBS parameters.
+	ParameterSetDefault ParameterSet = 0
+	// Multi-bit PBS parameters: lower latency on machines with many cores, at the cost of a bigger server key.
+	ParameterSetMultiBit ParameterSet = 1
+	// Parameters suited to compact public key encryption: smaller encrypted inputs, at the cost of slower operations.
+	ParameterSetCompactPk ParameterSet = 2
+)
+
+var parameterSetNames = map[ParameterSet]string{
+	ParameterSetDefault:   "default",
+	ParameterSetMultiBit:  "multi-bit",
+	ParameterSetCompactPk: "compact-pk",
+}
+
+// tfhe-rs names of the PBS parameters of each parameter set.
+var parameterSetParametersNames = map[ParameterSet]string{
+	ParameterSetDefault:   "PARAM_MESSAGE_2_CARRY_2_KS_PBS",
+	ParameterSetMultiBit:  "PARAM_MULTI_BIT_MESSAGE_2_CARRY_2_GROUP_3_KS_PBS",
+	ParameterSetCompactPk: "PARAM_MESSAGE_2_CARRY_2_COMPACT_PK_KS_PBS",
+}
+
+// tfhe-rs name of the compression parameters, the same for all parameter sets.
+const CompressionParametersName = "COMP_PARAM_MESSAGE_2_CARRY_2_KS_PBS"
+
+func (p ParameterSet) String() string {
+	if name, found := parameterSetNames[p]; found {
+		return name
+	}
+	return fmt.Sprintf("unknown parameter set %d", uint8(p))
+}
+
+func (p ParameterSet) IsValid() bool {
+	_, found := parameterSetNames[p]
+	return found
+}
+
+// Returns the tfhe-rs name of the PBS parameters of the parameter set.
+func (p ParameterSet) ParametersName() string {
+	return parameterSetParametersNames[p]
+}
+
+// Parses a parameter set name as returned by ParameterSet.String(), e.g. "multi-bit".
+func ParseParameterSet(name string) (ParameterSet, error) {
+	for p, n := range parameterSetNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return ParameterSetDefault, fmt.Errorf("unknown parameter set: %s", name)
+}
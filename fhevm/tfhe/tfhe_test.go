@@ -3,15 +3,41 @@ package tfhe
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"math/big"
 	"math/bits"
 	"os"
+	"path"
+	"sync"
 	"testing"
 )
 
+// Size limit given to compact list expanders in tests.
+const testMaxListBytes uint64 = 4 * 1024 * 1024
+
+// Size limit given to DeserializeCompact() in tests.
+const testMaxCompactCiphertextBytes uint64 = 1024 * 1024
+
+// Logs through the test, see Logger.
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Debug(msg string, keyvals ...interface{}) {
+	l.t.Log(append([]interface{}{"DEBUG", msg}, keyvals...)...)
+}
+
+func (l testLogger) Info(msg string, keyvals ...interface{}) {
+	l.t.Log(append([]interface{}{"INFO", msg}, keyvals...)...)
+}
+
+func (l testLogger) Error(msg string, keyvals ...interface{}) {
+	l.t.Log(append([]interface{}{"ERROR", msg}, keyvals...)...)
+}
+
 // generate keys if not present
 func setup() {
 	if !AllGlobalKeysPresent() {
@@ -40,7 +66,8 @@ func TfheEncryptDecrypt(t *testing.T, fheUintType FheUintType) {
 		val.SetUint64(1333337)
 	case FheUint64:
 		val.SetUint64(13333377777777777)
-
+	case FheUint128:
+		val.SetString("1edd3edac274a90128356fb8caa11bd2", 16)
 	case FheUint160:
 		hexValue := "12345676876661323221435343"
 		byteValue, err := hex.DecodeString(hexValue)
@@ -77,6 +104,8 @@ func TfheTrivialEncryptDecrypt(t *testing.T, fheUintType FheUintType) {
 		val.SetUint64(1333337)
 	case FheUint64:
 		val.SetUint64(13333377777777777)
+	case FheUint128:
+		val.SetString("1edd3edac274a90128356fb8caa11bd2", 16)
 	case FheUint160:
 		hexValue := "12345676876661323221435343"
 		byteValue, err := hex.DecodeString(hexValue)
@@ -97,6 +126,60 @@ func TfheTrivialEncryptDecrypt(t *testing.T, fheUintType FheUintType) {
 	}
 }
 
+func TfheGenerateRandom(t *testing.T, fheUintType FheUintType) {
+	seed := [16]byte{1, 2, 3}
+	ct1 := new(TfheCiphertext)
+	if err := ct1.GenerateRandom(seed, fheUintType, nil); err != nil {
+		t.Fatalf("GenerateRandom failed: %v", err)
+	}
+	ct2 := new(TfheCiphertext)
+	if err := ct2.GenerateRandom(seed, fheUintType, nil); err != nil {
+		t.Fatalf("GenerateRandom failed: %v", err)
+	}
+	if ct1.GetHash() != ct2.GetHash() {
+		t.Fatalf("GenerateRandom is not deterministic for the same seed")
+	}
+	res, err := ct1.Decrypt()
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if res.BitLen() > int(fheUintType.NumBits()) {
+		t.Fatalf("random value %s doesn't fit in %d bits", res.Text(10), fheUintType.NumBits())
+	}
+	if fheUintType == FheBool {
+		return
+	}
+	randomBits := uint64(3)
+	ct3 := new(TfheCiphertext)
+	if err := ct3.GenerateRandom([16]byte{4, 5, 6}, fheUintType, &randomBits); err != nil {
+		t.Fatalf("bounded GenerateRandom failed: %v", err)
+	}
+	res, err = ct3.Decrypt()
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if res.Uint64() >= 8 {
+		t.Fatalf("bounded random value %d is not smaller than 8", res.Uint64())
+	}
+}
+
+func TfheGenerateRandomBounded(t *testing.T, fheUintType FheUintType, bound *big.Int) {
+	ct := new(TfheCiphertext)
+	if err := ct.GenerateRandomBounded([16]byte{7, 8, 9}, fheUintType, bound); err != nil {
+		t.Fatalf("GenerateRandomBounded failed: %v", err)
+	}
+	if ct.Type() != fheUintType {
+		t.Fatalf("GenerateRandomBounded returned %s instead of %s", ct.Type(), fheUintType)
+	}
+	res, err := ct.Decrypt()
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if res.Cmp(bound) >= 0 {
+		t.Fatalf("bounded random value %s is not smaller than %s", res.Text(10), bound.Text(10))
+	}
+}
+
 func TfheSerializeDeserialize(t *testing.T, fheUintType FheUintType) {
 	var val big.Int
 	switch fheUintType {
@@ -155,7 +238,7 @@ func TfheSerializeDeserializeCompact(t *testing.T, fheUintType FheUintType) {
 
 	ser := EncryptAndSerializeCompact(val, fheUintType)
 	ct1 := new(TfheCiphertext)
-	err := ct1.DeserializeCompact(ser, fheUintType)
+	err := ct1.DeserializeCompact(ser, fheUintType, testMaxCompactCiphertextBytes)
 	if err != nil {
 		t.Fatalf("ct1 compact deserialization failed")
 	}
@@ -244,7 +327,7 @@ func TfheDeserializeCompact(t *testing.T, fheUintType FheUintType) {
 
 	ser := EncryptAndSerializeCompact(val, fheUintType)
 	ct := new(TfheCiphertext)
-	err := ct.DeserializeCompact(ser, fheUintType)
+	err := ct.DeserializeCompact(ser, fheUintType, testMaxCompactCiphertextBytes)
 	if err != nil {
 		t.Fatalf("compact deserialization failed")
 	}
@@ -256,7 +339,7 @@ func TfheDeserializeCompact(t *testing.T, fheUintType FheUintType) {
 
 func TfheDeserializeCompactFailure(t *testing.T, fheUintType FheUintType) {
 	ct := new(TfheCiphertext)
-	err := ct.DeserializeCompact(make([]byte, 10), fheUintType)
+	err := ct.DeserializeCompact(make([]byte, 10), fheUintType, testMaxCompactCiphertextBytes)
 	if err == nil {
 		t.Fatalf("compact deserialization must have failed")
 	}
@@ -500,6 +583,95 @@ func TfheScalarRem(t *testing.T, fheUintType FheUintType) {
 	}
 }
 
+func TfheDivRem(t *testing.T, fheUintType FheUintType) {
+	var a, b big.Int
+	a.SetUint64(13)
+	b.SetUint64(4)
+	expectedDiv := new(big.Int).Div(&a, &b)
+	expectedRem := new(big.Int).Rem(&a, &b)
+	ctA := new(TfheCiphertext)
+	ctA.Encrypt(a, fheUintType)
+	ctB := new(TfheCiphertext)
+	ctB.Encrypt(b, fheUintType)
+	ctDiv, _ := ctA.Div(ctB)
+	res, err := ctDiv.Decrypt()
+	if err != nil || res.Uint64() != expectedDiv.Uint64() {
+		t.Fatalf("%d != %d", expectedDiv.Uint64(), res.Uint64())
+	}
+	ctRem, _ := ctA.Rem(ctB)
+	res, err = ctRem.Decrypt()
+	if err != nil || res.Uint64() != expectedRem.Uint64() {
+		t.Fatalf("%d != %d", expectedRem.Uint64(), res.Uint64())
+	}
+}
+
+func TfheScalarLeft(t *testing.T, fheUintType FheUintType) {
+	cases := []struct {
+		name     string
+		op       func(ct *TfheCiphertext, scalar *big.Int) (*TfheCiphertext, error)
+		scalar   uint64
+		ct       uint64
+		expected uint64
+	}{
+		{"sub", (*TfheCiphertext).ScalarLeftSub, 7, 3, 4},
+		{"div", (*TfheCiphertext).ScalarLeftDiv, 7, 3, 2},
+		{"rem", (*TfheCiphertext).ScalarLeftRem, 7, 3, 1},
+		{"shl", (*TfheCiphertext).ScalarLeftShl, 1, 2, 4},
+		{"shr", (*TfheCiphertext).ScalarLeftShr, 8, 2, 2},
+		{"rotl", (*TfheCiphertext).ScalarLeftRotl, 1, 1, 2},
+		{"rotr", (*TfheCiphertext).ScalarLeftRotr, 2, 1, 1},
+		{"le", (*TfheCiphertext).ScalarLeftLe, 7, 3, 0},
+		{"lt", (*TfheCiphertext).ScalarLeftLt, 3, 7, 1},
+		{"ge", (*TfheCiphertext).ScalarLeftGe, 3, 7, 0},
+		{"gt", (*TfheCiphertext).ScalarLeftGt, 7, 3, 1},
+	}
+	for _, c := range cases {
+		ct := new(TfheCiphertext)
+		ct.Encrypt(*new(big.Int).SetUint64(c.ct), fheUintType)
+		ctRes, err := c.op(ct, new(big.Int).SetUint64(c.scalar))
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		res, err := ctRes.Decrypt()
+		if err != nil || res.Uint64() != c.expected {
+			t.Fatalf("%s: %d != %d", c.name, c.expected, res.Uint64())
+		}
+	}
+}
+
+func TestTfheScalarLeftSubWrapsAround(t *testing.T) {
+	ct := new(TfheCiphertext)
+	ct.Encrypt(*big.NewInt(7), FheUint8)
+	ctRes, err := ct.ScalarLeftSub(big.NewInt(3))
+	if err != nil {
+		t.Fatalf("ScalarLeftSub failed with %v", err)
+	}
+	res, err := ctRes.Decrypt()
+	if err != nil || res.Uint64() != 252 {
+		t.Fatalf("3 - 7 = %d, expected 252", res.Uint64())
+	}
+}
+
+func TestTfheScalarLeftUnsupportedTypes(t *testing.T) {
+	ops := map[string]func(ct *TfheCiphertext, scalar *big.Int) (*TfheCiphertext, error){
+		"sub": (*TfheCiphertext).ScalarLeftSub, "div": (*TfheCiphertext).ScalarLeftDiv,
+		"rem": (*TfheCiphertext).ScalarLeftRem, "shl": (*TfheCiphertext).ScalarLeftShl,
+		"shr": (*TfheCiphertext).ScalarLeftShr, "rotl": (*TfheCiphertext).ScalarLeftRotl,
+		"rotr": (*TfheCiphertext).ScalarLeftRotr, "le": (*TfheCiphertext).ScalarLeftLe,
+		"lt": (*TfheCiphertext).ScalarLeftLt, "ge": (*TfheCiphertext).ScalarLeftGe,
+		"gt": (*TfheCiphertext).ScalarLeftGt,
+	}
+	for _, fheUintType := range []FheUintType{FheBool, FheUint128, FheUint160, FheUint2048} {
+		ct := new(TfheCiphertext)
+		ct.Encrypt(*big.NewInt(1), fheUintType)
+		for name, op := range ops {
+			if _, err := op(ct, big.NewInt(1)); err == nil {
+				t.Fatalf("scalar-left %s must have failed on %s", name, fheUintType)
+			}
+		}
+	}
+}
+
 func TfheBitAnd(t *testing.T, fheUintType FheUintType) {
 	var a, b big.Int
 	switch fheUintType {
@@ -1757,7 +1929,7 @@ func TfheCompact160ListSerDeserRoundTrip(t *testing.T, input []big.Int) {
 	if err != nil {
 		t.Fatalf("EncryptAndSerializeCompact160List failed with %v", err)
 	}
-	cts, err := DeserializeAndExpandCompact160List(serList)
+	cts, err := DeserializeAndExpandCompact160List(serList, testMaxListBytes)
 	if err != nil {
 		t.Fatalf("DeserializeAndExpandCompact160List failed with %v", err)
 	}
@@ -1811,6 +1983,259 @@ func TestTfheCompact160ListEmptyInput(t *testing.T) {
 	}
 }
 
+func TfheProvenCompact160ListRoundTrip(t *testing.T, input []big.Int) {
+	serList, err := EncryptAndProveCompact160List(input, nil)
+	if err != nil {
+		t.Fatalf("EncryptAndProveCompact160List failed with %v", err)
+	}
+	cts, err := VerifyAndExpandProvenCompact160List(serList, len(input), nil, testMaxListBytes)
+	if err != nil {
+		t.Fatalf("VerifyAndExpandProvenCompact160List failed with %v", err)
+	}
+	if len(cts) != len(input) {
+		t.Fatalf("VerifyAndExpandProvenCompact160List returned %d ciphertexts, expected %d", len(cts), len(input))
+	}
+	for i, ct := range cts {
+		v, err := ct.Decrypt()
+		if err != nil {
+			t.Fatalf("Decrypt of ct%d failed with %v", i, err)
+		}
+		if v.Cmp(&input[i]) != 0 {
+			t.Fatalf("v%d=%v is not equal to in%d=%v", i, v, i, input[i])
+		}
+	}
+}
+
+func TestTfheProvenCompact160ListRoundTrip64Bit(t *testing.T) {
+	TfheProvenCompact160ListRoundTrip(t, []big.Int{*big.NewInt(79), *big.NewInt(42)})
+}
+
+func TestTfheProvenCompact160ListRoundTrip160Bit(t *testing.T) {
+	in1, _ := new(big.Int).SetString("1edd3edac274a90128356fb8caa11bd2", 16)
+	in2, _ := new(big.Int).SetString("9f24d93621347ca0832d1a3980750eea", 16)
+	TfheProvenCompact160ListRoundTrip(t, []big.Int{*in1, *in2})
+}
+
+func TestTfheProvenCompact2048ListRoundTrip(t *testing.T) {
+	in, _ := new(big.Int).SetString("9f24d93621347ca0832d1a3980750eea1edd3edac274a90128356fb8caa11bd2", 16)
+	serList, err := EncryptAndProveCompact2048List([]big.Int{*in}, nil)
+	if err != nil {
+		t.Fatalf("EncryptAndProveCompact2048List failed with %v", err)
+	}
+	cts, err := VerifyAndExpandProvenCompact2048List(serList, 1, nil, testMaxListBytes)
+	if err != nil {
+		t.Fatalf("VerifyAndExpandProvenCompact2048List failed with %v", err)
+	}
+	if len(cts) != 1 || cts[0].Type() != FheUint2048 {
+		t.Fatalf("VerifyAndExpandProvenCompact2048List returned unexpected ciphertexts")
+	}
+	v, err := cts[0].Decrypt()
+	if err != nil || v.Cmp(in) != 0 {
+		t.Fatalf("decrypted value %v is not equal to %v", v, in)
+	}
+}
+
+func TestTfheProvenCompact160ListRejectsUnprovenList(t *testing.T) {
+	serList, err := EncryptAndSerializeCompact160List([]big.Int{*big.NewInt(42)})
+	if err != nil {
+		t.Fatalf("EncryptAndSerializeCompact160List failed with %v", err)
+	}
+	_, err = VerifyAndExpandProvenCompact160List(serList, 1, nil, testMaxListBytes)
+	if !errors.Is(err, ErrInvalidSerialization) {
+		t.Fatalf("VerifyAndExpandProvenCompact160List must have failed on a list without a proof, got %v", err)
+	}
+}
+
+func TestTfheProvenCompactListRejectsOtherMetadata(t *testing.T) {
+	types := []FheUintType{FheUint8}
+	serList, err := EncryptAndProveCompactList([]big.Int{*big.NewInt(3)}, types, []byte("alice"))
+	if err != nil {
+		t.Fatalf("EncryptAndProveCompactList failed with %v", err)
+	}
+	if _, err = VerifyAndExpandProvenCompactList(serList, types, []byte("alice"), testMaxListBytes); err != nil {
+		t.Fatalf("VerifyAndExpandProvenCompactList failed with %v", err)
+	}
+	_, err = VerifyAndExpandProvenCompactList(serList, types, []byte("bob"), testMaxListBytes)
+	if !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("VerifyAndExpandProvenCompactList must have failed on other metadata, got %v", err)
+	}
+}
+
+func TestTfheProvenCompact160ListEmptyInput(t *testing.T) {
+	_, err := EncryptAndProveCompact160List(make([]big.Int, 0), nil)
+	if err == nil {
+		t.Fatalf("EncryptAndProveCompact160List must have failed on empty input")
+	}
+}
+
+func TestTfheProvenCompactMixedListRoundTrip(t *testing.T) {
+	in2048, _ := new(big.Int).SetString("9f24d93621347ca0832d1a3980750eea1edd3edac274a90128356fb8caa11bd2", 16)
+	in160, _ := new(big.Int).SetString("1edd3edac274a90128356fb8caa11bd2", 16)
+	input := []big.Int{*big.NewInt(1), *big.NewInt(7), *big.NewInt(42), *big.NewInt(1337), *in160, *in2048}
+	types := []FheUintType{FheBool, FheUint4, FheUint8, FheUint64, FheUint160, FheUint2048}
+	serList, err := EncryptAndProveCompactList(input, types, nil)
+	if err != nil {
+		t.Fatalf("EncryptAndProveCompactList failed with %v", err)
+	}
+	cts, err := VerifyAndExpandProvenCompactList(serList, types, nil, testMaxListBytes)
+	if err != nil {
+		t.Fatalf("VerifyAndExpandProvenCompactList failed with %v", err)
+	}
+	if len(cts) != len(input) {
+		t.Fatalf("VerifyAndExpandProvenCompactList returned %d ciphertexts, expected %d", len(cts), len(input))
+	}
+	for i, ct := range cts {
+		if ct.Type() != types[i] {
+			t.Fatalf("ct%d has type %s, expected %s", i, ct.Type(), types[i])
+		}
+		v, err := ct.Decrypt()
+		if err != nil {
+			t.Fatalf("Decrypt of ct%d failed with %v", i, err)
+		}
+		if v.Cmp(&input[i]) != 0 {
+			t.Fatalf("v%d=%v is not equal to in%d=%v", i, v, i, input[i])
+		}
+	}
+}
+
+func TestTfheProvenCompactMixedListTypeMismatch(t *testing.T) {
+	serList, err := EncryptAndProveCompactList([]big.Int{*big.NewInt(3), *big.NewInt(4)}, []FheUintType{FheUint8, FheUint32}, nil)
+	if err != nil {
+		t.Fatalf("EncryptAndProveCompactList failed with %v", err)
+	}
+	_, err = VerifyAndExpandProvenCompactList(serList, []FheUintType{FheUint8, FheUint64}, nil, testMaxListBytes)
+	if !errors.Is(err, ErrListMismatch) {
+		t.Fatalf("VerifyAndExpandProvenCompactList must have failed on a type mismatch, got %v", err)
+	}
+	_, err = VerifyAndExpandProvenCompactList(serList, []FheUintType{FheUint8}, nil, testMaxListBytes)
+	if !errors.Is(err, ErrListMismatch) {
+		t.Fatalf("VerifyAndExpandProvenCompactList must have failed on a count mismatch, got %v", err)
+	}
+	// The mismatch is found before the proof is verified, so it is reported even with metadata the proof wasn't made for.
+	_, err = VerifyAndExpandProvenCompactList(serList, []FheUintType{FheUint8}, []byte("bob"), testMaxListBytes)
+	if !errors.Is(err, ErrListMismatch) {
+		t.Fatalf("VerifyAndExpandProvenCompactList must have failed on a count mismatch before verifying the proof, got %v", err)
+	}
+}
+
+func TestTfheProvenCompact160ListCountMismatch(t *testing.T) {
+	serList, err := EncryptAndProveCompact160List([]big.Int{*big.NewInt(3), *big.NewInt(4)}, nil)
+	if err != nil {
+		t.Fatalf("EncryptAndProveCompact160List failed with %v", err)
+	}
+	_, err = VerifyAndExpandProvenCompact160List(serList, 1, []byte("bob"), testMaxListBytes)
+	if !errors.Is(err, ErrListMismatch) {
+		t.Fatalf("VerifyAndExpandProvenCompact160List must have failed on a count mismatch before verifying the proof, got %v", err)
+	}
+}
+
+func TestTfheProvenCompactMixedListValueTooBig(t *testing.T) {
+	_, err := EncryptAndProveCompactList([]big.Int{*big.NewInt(16)}, []FheUintType{FheUint4}, nil)
+	if err == nil {
+		t.Fatalf("EncryptAndProveCompactList must have failed on a value that doesn't fit its type")
+	}
+}
+
+func TestTfheProvenCompactListTooLarge(t *testing.T) {
+	serList, err := EncryptAndProveCompact160List([]big.Int{*big.NewInt(42)}, nil)
+	if err != nil {
+		t.Fatalf("EncryptAndProveCompact160List failed with %v", err)
+	}
+	_, err = VerifyAndExpandProvenCompact160List(serList, 1, nil, uint64(len(serList)-1))
+	if !errors.Is(err, ErrInvalidInputSize) {
+		t.Fatalf("VerifyAndExpandProvenCompact160List must have failed on a list over the size limit, got %v", err)
+	}
+	_, err = VerifyAndExpandProvenCompact160List(serList, 1, nil, uint64(len(serList)))
+	if err != nil {
+		t.Fatalf("VerifyAndExpandProvenCompact160List failed on a list at the size limit with %v", err)
+	}
+	_, err = VerifyAndExpandProvenCompactList(nil, []FheUintType{FheUint8}, nil, testMaxListBytes)
+	if !errors.Is(err, ErrInvalidInputSize) {
+		t.Fatalf("VerifyAndExpandProvenCompactList must have failed on an empty list, got %v", err)
+	}
+}
+
+func TestTfheProvenCompactListGarbage(t *testing.T) {
+	garbage := make([]byte, 1024)
+	for i := range garbage {
+		garbage[i] = byte(i)
+	}
+	_, err := VerifyAndExpandProvenCompactList(garbage, []FheUintType{FheUint8}, nil, testMaxListBytes)
+	if !errors.Is(err, ErrInvalidSerialization) {
+		t.Fatalf("VerifyAndExpandProvenCompactList must have failed on garbage input, got %v", err)
+	}
+}
+
+func TestTfheDeserializeCompactRejectsBadInput(t *testing.T) {
+	ct := new(TfheCiphertext)
+	if err := ct.DeserializeCompact(nil, FheUint8, testMaxCompactCiphertextBytes); !errors.Is(err, ErrInvalidInputSize) {
+		t.Fatalf("DeserializeCompact must have failed on empty input, got %v", err)
+	}
+	if err := ct.DeserializeCompact(make([]byte, testMaxCompactCiphertextBytes+1), FheUint8, testMaxCompactCiphertextBytes); !errors.Is(err, ErrInvalidInputSize) {
+		t.Fatalf("DeserializeCompact must have failed on oversized input, got %v", err)
+	}
+	// A ciphertext that was not serialized in the safe, versioned format.
+	ser := new(TfheCiphertext).TrivialEncrypt(*big.NewInt(1), FheUint8).Serialize()
+	if err := ct.DeserializeCompact(ser, FheUint8, testMaxCompactCiphertextBytes); !errors.Is(err, ErrInvalidSerialization) {
+		t.Fatalf("DeserializeCompact must have failed on a non-compact ciphertext, got %v", err)
+	}
+}
+
+func TfheCompressedRoundTrip(t *testing.T, fheUintType FheUintType) {
+	var value big.Int
+	switch fheUintType {
+	case FheBool:
+		value = *big.NewInt(1)
+	case FheUint4:
+		value = *big.NewInt(9)
+	default:
+		value = *big.NewInt(137)
+	}
+	ct := new(TfheCiphertext)
+	ct.Encrypt(value, fheUintType)
+	compressed, err := ct.SerializeCompressed()
+	if err != nil {
+		t.Fatalf("SerializeCompressed failed with %v", err)
+	}
+	if len(compressed) >= len(ct.Serialize()) {
+		t.Fatalf("compressed size %d is not smaller than uncompressed size %d", len(compressed), len(ct.Serialize()))
+	}
+	decompressed := new(TfheCiphertext)
+	if err := decompressed.DeserializeCompressed(compressed, fheUintType); err != nil {
+		t.Fatalf("DeserializeCompressed failed with %v", err)
+	}
+	res, err := decompressed.Decrypt()
+	if err != nil || res.Cmp(&value) != 0 {
+		t.Fatalf("decrypted value %v != %v", res, &value)
+	}
+}
+
+func TestTfheCompressedRoundTripBool(t *testing.T) {
+	TfheCompressedRoundTrip(t, FheBool)
+}
+
+func TestTfheCompressedRoundTrip4(t *testing.T) {
+	TfheCompressedRoundTrip(t, FheUint4)
+}
+
+func TestTfheCompressedRoundTrip64(t *testing.T) {
+	TfheCompressedRoundTrip(t, FheUint64)
+}
+
+func TestTfheCompressedRoundTrip2048(t *testing.T) {
+	TfheCompressedRoundTrip(t, FheUint2048)
+}
+
+func TestTfheDeserializeCompressedRejectsBadInput(t *testing.T) {
+	ct := new(TfheCiphertext)
+	if err := ct.DeserializeCompressed(nil, FheUint8); err == nil {
+		t.Fatalf("DeserializeCompressed must have failed on empty input")
+	}
+	if err := ct.DeserializeCompressed([]byte{1, 2, 3}, FheUint8); err == nil {
+		t.Fatalf("DeserializeCompressed must have failed on garbage input")
+	}
+}
+
 func TestTfheEncryptDecryptBool(t *testing.T) {
 	TfheEncryptDecrypt(t, FheBool)
 }
@@ -1839,6 +2264,10 @@ func TestTfheEncryptDecrypt160(t *testing.T) {
 	TfheEncryptDecrypt(t, FheUint160)
 }
 
+func TestTfheEncryptDecrypt128(t *testing.T) {
+	TfheEncryptDecrypt(t, FheUint128)
+}
+
 func TestTfheTrivialEncryptDecryptBool(t *testing.T) {
 	TfheTrivialEncryptDecrypt(t, FheBool)
 }
@@ -1867,6 +2296,116 @@ func TestTfheTrivialEncryptDecrypt160(t *testing.T) {
 	TfheTrivialEncryptDecrypt(t, FheUint160)
 }
 
+func TestTfheTrivialEncryptDecrypt128(t *testing.T) {
+	TfheTrivialEncryptDecrypt(t, FheUint128)
+}
+
+func TestTfheGenerateRandomBool(t *testing.T) {
+	TfheGenerateRandom(t, FheBool)
+}
+
+func TestTfheGenerateRandom4(t *testing.T) {
+	TfheGenerateRandom(t, FheUint4)
+}
+
+func TestTfheGenerateRandom8(t *testing.T) {
+	TfheGenerateRandom(t, FheUint8)
+}
+
+func TestTfheGenerateRandom16(t *testing.T) {
+	TfheGenerateRandom(t, FheUint16)
+}
+
+func TestTfheGenerateRandom32(t *testing.T) {
+	TfheGenerateRandom(t, FheUint32)
+}
+
+func TestTfheGenerateRandom64(t *testing.T) {
+	TfheGenerateRandom(t, FheUint64)
+}
+
+func TestTfheGenerateRandom128(t *testing.T) {
+	TfheGenerateRandom(t, FheUint128)
+}
+
+func TestTfheGenerateRandom160(t *testing.T) {
+	TfheGenerateRandom(t, FheUint160)
+}
+
+func TestTfheGenerateRandomBounded4(t *testing.T) {
+	TfheGenerateRandomBounded(t, FheUint4, big.NewInt(3))
+}
+
+func TestTfheGenerateRandomBounded8(t *testing.T) {
+	TfheGenerateRandomBounded(t, FheUint8, big.NewInt(6))
+}
+
+func TestTfheGenerateRandomBounded16(t *testing.T) {
+	TfheGenerateRandomBounded(t, FheUint16, big.NewInt(1000))
+}
+
+func TestTfheGenerateRandomBounded32(t *testing.T) {
+	TfheGenerateRandomBounded(t, FheUint32, big.NewInt(100003))
+}
+
+func TestTfheGenerateRandomBounded64(t *testing.T) {
+	TfheGenerateRandomBounded(t, FheUint64, new(big.Int).SetUint64(0xFFFFFFFFFFFFFFFF))
+}
+
+func TestTfheGenerateRandomBounded128(t *testing.T) {
+	bound, _ := new(big.Int).SetString("1edd3edac274a90128356fb8caa11bd2", 16)
+	TfheGenerateRandomBounded(t, FheUint128, bound)
+}
+
+func TestTfheGenerateRandomBounded160(t *testing.T) {
+	TfheGenerateRandomBounded(t, FheUint160, big.NewInt(1337))
+}
+
+func TestTfheGenerateRandomBoundedPowerOf2(t *testing.T) {
+	TfheGenerateRandomBounded(t, FheUint8, big.NewInt(16))
+	TfheGenerateRandomBounded(t, FheUint8, big.NewInt(256))
+}
+
+func TestTfheBoundedRandomReductionBits(t *testing.T) {
+	maxUint160 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1))
+	cases := []struct {
+		fheUintType FheUintType
+		bound       *big.Int
+		expected    uint
+	}{
+		{FheUint8, big.NewInt(6), 64},
+		{FheUint32, big.NewInt(100003), 64},
+		{FheUint32, new(big.Int).SetUint64(0xFFFFFFFF), 64},
+		{FheUint64, big.NewInt(6), 64},
+		{FheUint64, new(big.Int).SetUint64(0xFFFFFFFFFFFFFFFF), 128},
+		{FheUint128, big.NewInt(6), 128},
+		{FheUint128, new(big.Int).Lsh(big.NewInt(1), 100), 160},
+		{FheUint160, big.NewInt(6), 160},
+		{FheUint160, new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 140), big.NewInt(1)), 256},
+		{FheUint160, maxUint160, 256},
+	}
+	for _, c := range cases {
+		width, err := BoundedRandomReductionBits(c.fheUintType, c.bound)
+		if err != nil || width != c.expected {
+			t.Fatalf("%s with bound %s: expected %d, got %d (%v)", c.fheUintType, c.bound.Text(10), c.expected, width, err)
+		}
+	}
+	if _, err := BoundedRandomReductionBits(FheUint8, big.NewInt(257)); err == nil {
+		t.Fatalf("expected failure for a bound bigger than the type")
+	}
+}
+
+func TestTfheGenerateRandomBounded160Above128Bits(t *testing.T) {
+	bound := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 150), big.NewInt(3))
+	TfheGenerateRandomBounded(t, FheUint160, bound)
+}
+
+func TestTfheGenerateRandomInvalidType(t *testing.T) {
+	if err := new(TfheCiphertext).GenerateRandom([16]byte{}, FheUint2048, nil); err == nil {
+		t.Fatalf("GenerateRandom should fail for FheUint2048")
+	}
+}
+
 func TestTfheSerializeDeserializeBool(t *testing.T) {
 	TfheSerializeDeserialize(t, FheBool)
 }
@@ -2179,6 +2718,54 @@ func TestTfheScalarRem64(t *testing.T) {
 	TfheScalarRem(t, FheUint64)
 }
 
+func TestTfheDivRem4(t *testing.T) {
+	TfheDivRem(t, FheUint4)
+}
+
+func TestTfheDivRem8(t *testing.T) {
+	TfheDivRem(t, FheUint8)
+}
+
+func TestTfheDivRem16(t *testing.T) {
+	TfheDivRem(t, FheUint16)
+}
+
+func TestTfheDivRem32(t *testing.T) {
+	TfheDivRem(t, FheUint32)
+}
+
+func TestTfheDivRem64(t *testing.T) {
+	TfheDivRem(t, FheUint64)
+}
+
+func TestTfheScalarLeft4(t *testing.T) {
+	TfheScalarLeft(t, FheUint4)
+}
+
+func TestTfheScalarLeft8(t *testing.T) {
+	TfheScalarLeft(t, FheUint8)
+}
+
+func TestTfheScalarLeft16(t *testing.T) {
+	TfheScalarLeft(t, FheUint16)
+}
+
+func TestTfheScalarLeft32(t *testing.T) {
+	TfheScalarLeft(t, FheUint32)
+}
+
+func TestTfheScalarLeft64(t *testing.T) {
+	TfheScalarLeft(t, FheUint64)
+}
+
+func TestTfheScalarLeftBoolNotSupported(t *testing.T) {
+	ct := new(TfheCiphertext)
+	ct.Encrypt(*big.NewInt(1), FheBool)
+	if _, err := ct.ScalarLeftSub(big.NewInt(1)); err == nil {
+		t.Fatalf("scalar-left sub on bool should fail")
+	}
+}
+
 func TestTfheBitAnd4(t *testing.T) {
 	TfheBitAnd(t, FheUint4)
 }
@@ -2946,3 +3533,303 @@ func TestTfheEqArrayNotEqualDifferentLen32(t *testing.T) {
 func TestTfheEqArrayNotEqualDifferentLen64(t *testing.T) {
 	TfheEqArrayNotEqualSameLen(t, FheUint64)
 }
+
+// Generates a key set next to the active one, such that tests can compute on ciphertexts from both.
+func generateInactiveKeySet(t *testing.T) *KeySet {
+	ks, err := GenerateKeySet()
+	if err != nil {
+		t.Fatalf("GenerateKeySet failed: %v", err)
+	}
+	if ks.Id() == GetKeySetId() {
+		t.Fatalf("generated key set must not be active")
+	}
+	return ks
+}
+
+func TestTfheKeySetRouting(t *testing.T) {
+	active := GetKeySetId()
+	ks := generateInactiveKeySet(t)
+	activeCt := new(TfheCiphertext).Encrypt(*big.NewInt(3), FheUint8)
+	if err := ActivateKeySet(ks.Id()); err != nil {
+		t.Fatalf("ActivateKeySet failed: %v", err)
+	}
+	rotatedCt := new(TfheCiphertext).Encrypt(*big.NewInt(4), FheUint8)
+	if err := ActivateKeySet(active); err != nil {
+		t.Fatalf("ActivateKeySet failed: %v", err)
+	}
+	if activeCt.KeySetId != active || rotatedCt.KeySetId != ks.Id() {
+		t.Fatalf("unexpected key sets %08x and %08x", activeCt.KeySetId, rotatedCt.KeySetId)
+	}
+
+	// Ciphertexts from a key set that isn't active are computed on with their own server key.
+	res, err := rotatedCt.ScalarAdd(big.NewInt(1))
+	if err != nil {
+		t.Fatalf("ScalarAdd failed: %v", err)
+	}
+	if res.KeySetId != ks.Id() {
+		t.Fatalf("result key set %08x != %08x", res.KeySetId, ks.Id())
+	}
+	decrypted, err := res.Decrypt()
+	if err != nil || decrypted.Uint64() != 5 {
+		t.Fatalf("decrypted value %v != 5, err: %v", decrypted, err)
+	}
+
+	if _, err := activeCt.Add(rotatedCt); !errors.Is(err, ErrKeySetMismatch) {
+		t.Fatalf("expected ErrKeySetMismatch, got: %v", err)
+	}
+}
+
+func TestTfheUnknownKeySet(t *testing.T) {
+	ct := new(TfheCiphertext).TrivialEncrypt(*big.NewInt(1), FheUint8)
+	ct.KeySetId = GetKeySetId() + 1
+	if _, err := ct.Not(); !errors.Is(err, ErrUnknownKeySet) {
+		t.Fatalf("expected ErrUnknownKeySet, got: %v", err)
+	}
+	compressed, err := new(TfheCiphertext).TrivialEncrypt(*big.NewInt(1), FheUint8).SerializeCompressed()
+	if err != nil {
+		t.Fatalf("SerializeCompressed failed: %v", err)
+	}
+	if err := new(TfheCiphertext).DeserializeCompressedWithKeySet(compressed, FheUint8, GetKeySetId()+1); !errors.Is(err, ErrUnknownKeySet) {
+		t.Fatalf("expected ErrUnknownKeySet, got: %v", err)
+	}
+}
+
+func TestTfheSwitchKeySet(t *testing.T) {
+	ks := generateInactiveKeySet(t)
+	if _, err := GenerateKeySwitchingKey(GetKeySetId(), ks.Id()); err != nil {
+		t.Fatalf("GenerateKeySwitchingKey failed: %v", err)
+	}
+	ct := new(TfheCiphertext).Encrypt(*big.NewInt(9), FheUint32)
+	switched, err := ct.SwitchKeySet(ks.Id())
+	if err != nil {
+		t.Fatalf("SwitchKeySet failed: %v", err)
+	}
+	if switched.KeySetId != ks.Id() || switched.Type() != FheUint32 {
+		t.Fatalf("unexpected switched ciphertext: key set %08x, type %s", switched.KeySetId, switched.Type())
+	}
+	decrypted, err := switched.Decrypt()
+	if err != nil || decrypted.Uint64() != 9 {
+		t.Fatalf("decrypted value %v != 9, err: %v", decrypted, err)
+	}
+
+	// Only the registered direction can be switched.
+	if _, err := switched.SwitchKeySet(GetKeySetId()); !errors.Is(err, ErrNoKeySwitchingKey) {
+		t.Fatalf("expected ErrNoKeySwitchingKey, got: %v", err)
+	}
+}
+
+func TestTfheKeyManifest(t *testing.T) {
+	ks, err := GenerateKeySetWithoutCrs()
+	if err != nil {
+		t.Fatalf("GenerateKeySetWithoutCrs failed: %v", err)
+	}
+	dir := t.TempDir()
+	manifest, err := WriteKeySetToDir(ks, dir, false)
+	if err != nil {
+		t.Fatalf("WriteKeySetToDir failed: %v", err)
+	}
+	if _, found := manifest.Files[ClientKeyFileName]; found {
+		t.Fatalf("client key must not be written")
+	}
+	if manifest.Files[PublicKeyFileName].Keccak256 != ks.PksHash() {
+		t.Fatalf("manifest public key hash doesn't match the key set")
+	}
+	if _, err := VerifyKeyManifest(dir); err != nil {
+		t.Fatalf("VerifyKeyManifest failed: %v", err)
+	}
+
+	// Any change to a key file is detected.
+	pksPath := path.Join(dir, PublicKeyFileName)
+	pksBytes, err := os.ReadFile(pksPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pksBytes[len(pksBytes)-1] ^= 1
+	if err := os.WriteFile(pksPath, pksBytes, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyKeyManifest(dir); err == nil {
+		t.Fatalf("VerifyKeyManifest must fail on a modified public key")
+	}
+	if _, err := loadKeySetFromDir(dir, testLogger{t}); err == nil {
+		t.Fatalf("loading keys that don't match their manifest must fail")
+	}
+}
+
+func TestTfheKeySetSelfTest(t *testing.T) {
+	if err := activeKeySet.SelfTest(); err != nil {
+		t.Fatalf("SelfTest of the active key set failed: %v", err)
+	}
+	other, err := GenerateKeySetWithoutCrs()
+	if err != nil {
+		t.Fatalf("GenerateKeySetWithoutCrs failed: %v", err)
+	}
+	// The server key of another key set computes garbage that the client key detects.
+	mixed := &KeySet{sks: other.sks, cks: activeKeySet.cks, pks: activeKeySet.pks}
+	if err := mixed.SelfTest(); !errors.Is(err, ErrKeySetSelfTestFailed) {
+		t.Fatalf("expected ErrKeySetSelfTestFailed for a foreign server key, got: %v", err)
+	}
+	mixed = &KeySet{sks: activeKeySet.sks, cks: other.cks, pks: activeKeySet.pks}
+	if err := mixed.SelfTest(); !errors.Is(err, ErrKeySetSelfTestFailed) {
+		t.Fatalf("expected ErrKeySetSelfTestFailed for a foreign client key, got: %v", err)
+	}
+}
+
+func TestTfheParameterSets(t *testing.T) {
+	for _, p := range []ParameterSet{ParameterSetDefault, ParameterSetMultiBit, ParameterSetCompactPk} {
+		parsed, err := ParseParameterSet(p.String())
+		if err != nil || parsed != p {
+			t.Fatalf("parameter set %s doesn't round trip, got %s, err: %v", p, parsed, err)
+		}
+	}
+	if _, err := ParseParameterSet("unknown"); err == nil {
+		t.Fatalf("ParseParameterSet must fail on an unknown name")
+	}
+
+	ks, err := GenerateKeySetWithParameters(ParameterSetMultiBit, false)
+	if err != nil {
+		t.Fatalf("GenerateKeySetWithParameters failed: %v", err)
+	}
+	if ks.ParameterSet() != ParameterSetMultiBit {
+		t.Fatalf("expected the multi-bit parameter set, got %s", ks.ParameterSet())
+	}
+	if err := ks.SelfTest(); err != nil {
+		t.Fatalf("SelfTest of the multi-bit key set failed: %v", err)
+	}
+	if ks.ExpandedCiphertextSize(FheUint8) == 0 {
+		t.Fatalf("expanded ciphertext sizes of the multi-bit parameter set are not computed")
+	}
+	if _, err := GenerateKeySwitchingKey(GetKeySetId(), ks.Id()); err == nil {
+		t.Fatalf("GenerateKeySwitchingKey must fail between parameter sets")
+	}
+
+	dir := t.TempDir()
+	if _, err := WriteKeySetToDir(ks, dir, false); err != nil {
+		t.Fatalf("WriteKeySetToDir failed: %v", err)
+	}
+	manifest, err := VerifyKeyManifest(dir)
+	if err != nil {
+		t.Fatalf("VerifyKeyManifest failed: %v", err)
+	}
+	if p, err := manifest.GetParameterSet(); err != nil || p != ParameterSetMultiBit {
+		t.Fatalf("manifest has parameter set %s, err: %v", p, err)
+	}
+	if manifest.Parameters != ParameterSetMultiBit.ParametersName() {
+		t.Fatalf("manifest has parameters %s, expected %s", manifest.Parameters, ParameterSetMultiBit.ParametersName())
+	}
+}
+
+func TestTfheNativeCiphertextCache(t *testing.T) {
+	cache := NewNativeCiphertextCache(1024 * 1024 * 1024)
+	a := new(TfheCiphertext).Encrypt(*big.NewInt(10), FheUint32)
+	b := new(TfheCiphertext).Encrypt(*big.NewInt(20), FheUint32)
+	cache.Attach(a)
+	cache.Attach(b)
+	sum, err := a.Add(b)
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	sum, err = sum.Add(a)
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	// Operands and both results are held natively, and results are not serialized until needed.
+	if cache.Len() != 4 || cache.Bytes() == 0 {
+		t.Fatalf("expected 4 native ciphertexts, got %d (%d bytes)", cache.Len(), cache.Bytes())
+	}
+	if sum.Serialization != nil {
+		t.Fatalf("expected the result not to be serialized before it is needed")
+	}
+	hash := sum.GetHash()
+	if sum.Serialization == nil {
+		t.Fatalf("expected hashing to serialize the result")
+	}
+
+	// A cache with room for a single ciphertext evicts the least recently used one.
+	small := NewNativeCiphertextCache(uint64(ExpandedFheCiphertextSize[FheUint32]))
+	c := new(TfheCiphertext).Encrypt(*big.NewInt(1), FheUint32)
+	d := new(TfheCiphertext).Encrypt(*big.NewInt(2), FheUint32)
+	small.Attach(c)
+	small.Attach(d)
+	if _, err := c.Add(d); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if small.Len() > 1 {
+		t.Fatalf("expected at most 1 native ciphertext, got %d", small.Len())
+	}
+	small.Release()
+
+	cache.Release()
+	if cache.Len() != 0 || cache.Bytes() != 0 {
+		t.Fatalf("expected an empty cache after release, got %d (%d bytes)", cache.Len(), cache.Bytes())
+	}
+	res, err := sum.Decrypt()
+	if err != nil || res.Uint64() != 40 {
+		t.Fatalf("expected 40 after release, got %d, err: %v", res.Uint64(), err)
+	}
+	if sum.GetHash() != hash {
+		t.Fatalf("hash changed after release")
+	}
+}
+
+// Meant to be run with the race detector: operations run on several goroutines under two key sets, while the active
+// key set is switched between them.
+func TestTfheConcurrentOperations(t *testing.T) {
+	original := GetKeySetId()
+	other, err := GenerateKeySetWithoutCrs()
+	if err != nil {
+		t.Fatalf("GenerateKeySetWithoutCrs failed: %v", err)
+	}
+	defer ActivateKeySet(original)
+
+	done := make(chan struct{})
+	var switcher sync.WaitGroup
+	switcher.Add(1)
+	go func() {
+		defer switcher.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			id := original
+			if i%2 == 1 {
+				id = other.Id()
+			}
+			if err := ActivateKeySet(id); err != nil {
+				t.Errorf("ActivateKeySet failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 4; i++ {
+				// Operands are encrypted under whichever key set is active, but always under the same one.
+				ks := currentKeySet()
+				a := new(TfheCiphertext).trivialEncrypt(*big.NewInt(int64(g)), FheUint16, ks)
+				b := new(TfheCiphertext).trivialEncrypt(*big.NewInt(int64(i)), FheUint16, ks)
+				sum, err := a.Add(b)
+				if err != nil {
+					t.Errorf("Add failed: %v", err)
+					return
+				}
+				res, err := sum.Decrypt()
+				if err != nil || res.Uint64() != uint64(g+i) {
+					t.Errorf("expected %d, got %d, err: %v", g+i, res.Uint64(), err)
+				}
+				if sum.KeySetId != ks.Id() {
+					t.Errorf("result is under key set %08x, operands under %08x", sum.KeySetId, ks.Id())
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(done)
+	switcher.Wait()
+}
@@ -1,19 +1,41 @@
 #include "tfhe_wrappers.h"
 
-FhevmKeys generate_fhevm_keys(){
+Config* fhevm_config(uint8_t parameter_set){
 	ConfigBuilder* builder;
 	Config *config;
-	ClientKey *cks;
-	ServerKey *sks;
-	CompactPublicKey *pks;
+
+	ShortintPBSParameters params;
+	switch (parameter_set) {
+	case FHEVM_PARAMETER_SET_MULTI_BIT:
+		params = SHORTINT_PARAM_MULTI_BIT_MESSAGE_2_CARRY_2_GROUP_3_KS_PBS;
+		break;
+	case FHEVM_PARAMETER_SET_COMPACT_PK:
+		params = SHORTINT_PARAM_MESSAGE_2_CARRY_2_COMPACT_PK_KS_PBS;
+		break;
+	default:
+		params = SHORTINT_PARAM_MESSAGE_2_CARRY_2_KS_PBS;
+	}
 
 	int r;
 	r = config_builder_default(&builder);
 	assert(r == 0);
-	r = config_builder_use_custom_parameters(&builder, SHORTINT_PARAM_MESSAGE_2_CARRY_2_KS_PBS);
+	r = config_builder_use_custom_parameters(&builder, params);
+	assert(r == 0);
+	// Compression keys are part of the server key and are used to compress persisted ciphertexts.
+	r = config_builder_enable_compression(&builder, &SHORTINT_COMP_PARAM_MESSAGE_2_CARRY_2_KS_PBS);
 	assert(r == 0);
 	r = config_builder_build(builder, &config);
 	assert(r == 0);
+	return config;
+}
+
+FhevmKeys generate_fhevm_keys(uint8_t parameter_set){
+	Config *config = fhevm_config(parameter_set);
+	ClientKey *cks;
+	ServerKey *sks;
+	CompactPublicKey *pks;
+
+	int r;
 	r = generate_keys(config, &cks, &sks);
 	assert(r == 0);
 	r = compact_public_key_new(cks, &pks);
@@ -23,10 +45,44 @@ FhevmKeys generate_fhevm_keys(){
 	return keys;
 }
 
+void* generate_public_params(uint8_t parameter_set, size_t max_num_bits) {
+	Config *config = fhevm_config(parameter_set);
+	CompactPkeCrs *crs = NULL;
+	CompactPkePublicParams *public_params = NULL;
+
+	int r;
+	r = compact_pke_crs_from_config(config, max_num_bits, &crs);
+	assert(r == 0);
+	r = compact_pke_crs_public_params(crs, &public_params);
+	assert(r == 0);
+	r = compact_pke_crs_destroy(crs);
+	assert(r == 0);
+	return public_params;
+}
+
+int serialize_public_params(void *public_params, DynamicBuffer* out) {
+	return compact_pke_public_params_serialize(public_params, true, out);
+}
+
+void* deserialize_public_params(DynamicBufferView in) {
+	CompactPkePublicParams* public_params = NULL;
+	const int r = compact_pke_public_params_deserialize(in, true, true, &public_params);
+	if(r != 0) return NULL;
+	return public_params;
+}
+
 int serialize_compact_public_key(void *pks, DynamicBuffer* out) {
 	return compact_public_key_serialize(pks, out);
 }
 
+int serialize_server_key(void *sks, DynamicBuffer* out) {
+	return server_key_serialize(sks, out);
+}
+
+int serialize_client_key(void *cks, DynamicBuffer* out) {
+	return client_key_serialize(cks, out);
+}
+
 void* deserialize_server_key(DynamicBufferView in) {
 	ServerKey* sks = NULL;
 	const int r = server_key_deserialize(in, &sks);
@@ -48,6 +104,9 @@ void* deserialize_compact_public_key(DynamicBufferView in) {
 	return pks;
 }
 
+// tfhe-rs keeps the server key in thread-local storage, so every wrapper that computes sets it before computing, within
+// the same call. A goroutine stays on the same OS thread for the duration of a cgo call, so wrappers can be called
+// concurrently from several goroutines, with different server keys.
 void checked_set_server_key(void *sks) {
 	const int r = set_server_key(sks);
 	assert(r == 0);
@@ -136,11 +195,11 @@ void* deserialize_fhe_bool(DynamicBufferView in) {
 	return ct;
 }
 
-void* deserialize_compact_fhe_bool(DynamicBufferView in) {
+void* deserialize_compact_fhe_bool(DynamicBufferView in, uint64_t size_limit, void* sks) {
 	CompactFheBoolList* list = NULL;
 	FheBool* ct = NULL;
 
-	int r = compact_fhe_bool_list_deserialize(in, &list);
+	int r = compact_fhe_bool_list_safe_deserialize_conformant(in, size_limit, sks, &list);
 	if(r != 0) {
 		return NULL;
 	}
@@ -174,11 +233,11 @@ void* deserialize_fhe_uint4(DynamicBufferView in) {
 	return ct;
 }
 
-void* deserialize_compact_fhe_uint4(DynamicBufferView in) {
+void* deserialize_compact_fhe_uint4(DynamicBufferView in, uint64_t size_limit, void* sks) {
 	CompactFheUint4List* list = NULL;
 	FheUint4* ct = NULL;
 
-	int r = compact_fhe_uint4_list_deserialize(in, &list);
+	int r = compact_fhe_uint4_list_safe_deserialize_conformant(in, size_limit, sks, &list);
 	if(r != 0) {
 		return NULL;
 	}
@@ -212,11 +271,11 @@ void* deserialize_fhe_uint8(DynamicBufferView in) {
 	return ct;
 }
 
-void* deserialize_compact_fhe_uint8(DynamicBufferView in) {
+void* deserialize_compact_fhe_uint8(DynamicBufferView in, uint64_t size_limit, void* sks) {
 	CompactFheUint8List* list = NULL;
 	FheUint8* ct = NULL;
 
-	int r = compact_fhe_uint8_list_deserialize(in, &list);
+	int r = compact_fhe_uint8_list_safe_deserialize_conformant(in, size_limit, sks, &list);
 	if(r != 0) {
 		return NULL;
 	}
@@ -250,11 +309,11 @@ void* deserialize_fhe_uint16(DynamicBufferView in) {
 	return ct;
 }
 
-void* deserialize_compact_fhe_uint16(DynamicBufferView in) {
+void* deserialize_compact_fhe_uint16(DynamicBufferView in, uint64_t size_limit, void* sks) {
 	CompactFheUint16List* list = NULL;
 	FheUint16* ct = NULL;
 
-	int r = compact_fhe_uint16_list_deserialize(in, &list);
+	int r = compact_fhe_uint16_list_safe_deserialize_conformant(in, size_limit, sks, &list);
 	if(r != 0) {
 		return NULL;
 	}
@@ -288,11 +347,11 @@ void* deserialize_fhe_uint32(DynamicBufferView in) {
 	return ct;
 }
 
-void* deserialize_compact_fhe_uint32(DynamicBufferView in) {
+void* deserialize_compact_fhe_uint32(DynamicBufferView in, uint64_t size_limit, void* sks) {
 	CompactFheUint32List* list = NULL;
 	FheUint32* ct = NULL;
 
-	int r = compact_fhe_uint32_list_deserialize(in, &list);
+	int r = compact_fhe_uint32_list_safe_deserialize_conformant(in, size_limit, sks, &list);
 	if(r != 0) {
 		return NULL;
 	}
@@ -326,11 +385,11 @@ void* deserialize_fhe_uint64(DynamicBufferView in) {
 	return ct;
 }
 
-void* deserialize_compact_fhe_uint64(DynamicBufferView in) {
+void* deserialize_compact_fhe_uint64(DynamicBufferView in, uint64_t size_limit, void* sks) {
 	CompactFheUint64List* list = NULL;
 	FheUint64* ct = NULL;
 
-	int r = compact_fhe_uint64_list_deserialize(in, &list);
+	int r = compact_fhe_uint64_list_safe_deserialize_conformant(in, size_limit, sks, &list);
 	if(r != 0) {
 		return NULL;
 	}
@@ -352,6 +411,19 @@ void* deserialize_compact_fhe_uint64(DynamicBufferView in) {
 }
 
 
+int serialize_fhe_uint128(void *ct, DynamicBuffer* out) {
+	return fhe_uint128_serialize(ct, out);
+}
+
+void* deserialize_fhe_uint128(DynamicBufferView in) {
+	FheUint128* ct = NULL;
+	const int r = fhe_uint128_deserialize(in, &ct);
+	if(r != 0) {
+		return NULL;
+	}
+	return ct;
+}
+
 int serialize_fhe_uint160(void *ct, DynamicBuffer* out) {
 	return fhe_uint160_serialize(ct, out);
 }
@@ -378,11 +450,11 @@ void* deserialize_fhe_uint2048(DynamicBufferView in) {
 	return ct;
 }
 
-void* deserialize_compact_fhe_uint160(DynamicBufferView in) {
+void* deserialize_compact_fhe_uint160(DynamicBufferView in, uint64_t size_limit, void* sks) {
 	CompactFheUint160List* list = NULL;
 	FheUint160* ct = NULL;
 
-	int r = compact_fhe_uint160_list_deserialize(in, &list);
+	int r = compact_fhe_uint160_list_safe_deserialize_conformant(in, size_limit, sks, &list);
 	if(r != 0) {
 		return NULL;
 	}
@@ -403,11 +475,11 @@ void* deserialize_compact_fhe_uint160(DynamicBufferView in) {
 	return ct;
 }
 
-void* deserialize_compact_fhe_uint2048(DynamicBufferView in) {
+void* deserialize_compact_fhe_uint2048(DynamicBufferView in, uint64_t size_limit, void* sks) {
 	CompactFheUint2048List* list = NULL;
 	FheUint2048* ct = NULL;
 
-	int r = compact_fhe_uint2048_list_deserialize(in, &list);
+	int r = compact_fhe_uint2048_list_safe_deserialize_conformant(in, size_limit, sks, &list);
 	if(r != 0) {
 		return NULL;
 	}
@@ -428,6 +500,515 @@ void* deserialize_compact_fhe_uint2048(DynamicBufferView in) {
 	return ct;
 }
 
+int compress_fhe_bool(void *ct, void* sks, DynamicBuffer* out) {
+	CompressedCiphertextListBuilder* builder = NULL;
+	CompressedCiphertextList* list = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_builder_new(&builder);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_builder_push_fhe_bool(builder, ct);
+	if(r == 0) {
+		r = compressed_ciphertext_list_builder_build(builder, &list);
+	}
+	const int r_destroy = compressed_ciphertext_list_builder_destroy(builder);
+	assert(r_destroy == 0);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_serialize(list, out);
+	const int r_destroy_list = compressed_ciphertext_list_destroy(list);
+	assert(r_destroy_list == 0);
+	return r;
+}
+
+void* decompress_fhe_bool(DynamicBufferView in, void* sks) {
+	CompressedCiphertextList* list = NULL;
+	FheBool* ct = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_deserialize(in, &list);
+	if(r != 0) {
+		return NULL;
+	}
+	r = compressed_ciphertext_list_get_fhe_bool(list, 0, &ct);
+	if(r != 0) {
+		ct = NULL;
+	}
+	r = compressed_ciphertext_list_destroy(list);
+	assert(r == 0);
+	return ct;
+}
+
+int compress_fhe_uint4(void *ct, void* sks, DynamicBuffer* out) {
+	CompressedCiphertextListBuilder* builder = NULL;
+	CompressedCiphertextList* list = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_builder_new(&builder);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_builder_push_fhe_uint4(builder, ct);
+	if(r == 0) {
+		r = compressed_ciphertext_list_builder_build(builder, &list);
+	}
+	const int r_destroy = compressed_ciphertext_list_builder_destroy(builder);
+	assert(r_destroy == 0);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_serialize(list, out);
+	const int r_destroy_list = compressed_ciphertext_list_destroy(list);
+	assert(r_destroy_list == 0);
+	return r;
+}
+
+void* decompress_fhe_uint4(DynamicBufferView in, void* sks) {
+	CompressedCiphertextList* list = NULL;
+	FheUint4* ct = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_deserialize(in, &list);
+	if(r != 0) {
+		return NULL;
+	}
+	r = compressed_ciphertext_list_get_fhe_uint4(list, 0, &ct);
+	if(r != 0) {
+		ct = NULL;
+	}
+	r = compressed_ciphertext_list_destroy(list);
+	assert(r == 0);
+	return ct;
+}
+
+int compress_fhe_uint8(void *ct, void* sks, DynamicBuffer* out) {
+	CompressedCiphertextListBuilder* builder = NULL;
+	CompressedCiphertextList* list = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_builder_new(&builder);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_builder_push_fhe_uint8(builder, ct);
+	if(r == 0) {
+		r = compressed_ciphertext_list_builder_build(builder, &list);
+	}
+	const int r_destroy = compressed_ciphertext_list_builder_destroy(builder);
+	assert(r_destroy == 0);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_serialize(list, out);
+	const int r_destroy_list = compressed_ciphertext_list_destroy(list);
+	assert(r_destroy_list == 0);
+	return r;
+}
+
+void* decompress_fhe_uint8(DynamicBufferView in, void* sks) {
+	CompressedCiphertextList* list = NULL;
+	FheUint8* ct = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_deserialize(in, &list);
+	if(r != 0) {
+		return NULL;
+	}
+	r = compressed_ciphertext_list_get_fhe_uint8(list, 0, &ct);
+	if(r != 0) {
+		ct = NULL;
+	}
+	r = compressed_ciphertext_list_destroy(list);
+	assert(r == 0);
+	return ct;
+}
+
+int compress_fhe_uint16(void *ct, void* sks, DynamicBuffer* out) {
+	CompressedCiphertextListBuilder* builder = NULL;
+	CompressedCiphertextList* list = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_builder_new(&builder);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_builder_push_fhe_uint16(builder, ct);
+	if(r == 0) {
+		r = compressed_ciphertext_list_builder_build(builder, &list);
+	}
+	const int r_destroy = compressed_ciphertext_list_builder_destroy(builder);
+	assert(r_destroy == 0);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_serialize(list, out);
+	const int r_destroy_list = compressed_ciphertext_list_destroy(list);
+	assert(r_destroy_list == 0);
+	return r;
+}
+
+void* decompress_fhe_uint16(DynamicBufferView in, void* sks) {
+	CompressedCiphertextList* list = NULL;
+	FheUint16* ct = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_deserialize(in, &list);
+	if(r != 0) {
+		return NULL;
+	}
+	r = compressed_ciphertext_list_get_fhe_uint16(list, 0, &ct);
+	if(r != 0) {
+		ct = NULL;
+	}
+	r = compressed_ciphertext_list_destroy(list);
+	assert(r == 0);
+	return ct;
+}
+
+int compress_fhe_uint32(void *ct, void* sks, DynamicBuffer* out) {
+	CompressedCiphertextListBuilder* builder = NULL;
+	CompressedCiphertextList* list = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_builder_new(&builder);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_builder_push_fhe_uint32(builder, ct);
+	if(r == 0) {
+		r = compressed_ciphertext_list_builder_build(builder, &list);
+	}
+	const int r_destroy = compressed_ciphertext_list_builder_destroy(builder);
+	assert(r_destroy == 0);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_serialize(list, out);
+	const int r_destroy_list = compressed_ciphertext_list_destroy(list);
+	assert(r_destroy_list == 0);
+	return r;
+}
+
+void* decompress_fhe_uint32(DynamicBufferView in, void* sks) {
+	CompressedCiphertextList* list = NULL;
+	FheUint32* ct = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_deserialize(in, &list);
+	if(r != 0) {
+		return NULL;
+	}
+	r = compressed_ciphertext_list_get_fhe_uint32(list, 0, &ct);
+	if(r != 0) {
+		ct = NULL;
+	}
+	r = compressed_ciphertext_list_destroy(list);
+	assert(r == 0);
+	return ct;
+}
+
+int compress_fhe_uint64(void *ct, void* sks, DynamicBuffer* out) {
+	CompressedCiphertextListBuilder* builder = NULL;
+	CompressedCiphertextList* list = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_builder_new(&builder);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_builder_push_fhe_uint64(builder, ct);
+	if(r == 0) {
+		r = compressed_ciphertext_list_builder_build(builder, &list);
+	}
+	const int r_destroy = compressed_ciphertext_list_builder_destroy(builder);
+	assert(r_destroy == 0);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_serialize(list, out);
+	const int r_destroy_list = compressed_ciphertext_list_destroy(list);
+	assert(r_destroy_list == 0);
+	return r;
+}
+
+void* decompress_fhe_uint64(DynamicBufferView in, void* sks) {
+	CompressedCiphertextList* list = NULL;
+	FheUint64* ct = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_deserialize(in, &list);
+	if(r != 0) {
+		return NULL;
+	}
+	r = compressed_ciphertext_list_get_fhe_uint64(list, 0, &ct);
+	if(r != 0) {
+		ct = NULL;
+	}
+	r = compressed_ciphertext_list_destroy(list);
+	assert(r == 0);
+	return ct;
+}
+
+int compress_fhe_uint128(void *ct, void* sks, DynamicBuffer* out) {
+	CompressedCiphertextListBuilder* builder = NULL;
+	CompressedCiphertextList* list = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_builder_new(&builder);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_builder_push_fhe_uint128(builder, ct);
+	if(r == 0) {
+		r = compressed_ciphertext_list_builder_build(builder, &list);
+	}
+	const int r_destroy = compressed_ciphertext_list_builder_destroy(builder);
+	assert(r_destroy == 0);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_serialize(list, out);
+	const int r_destroy_list = compressed_ciphertext_list_destroy(list);
+	assert(r_destroy_list == 0);
+	return r;
+}
+
+void* decompress_fhe_uint128(DynamicBufferView in, void* sks) {
+	CompressedCiphertextList* list = NULL;
+	FheUint128* ct = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_deserialize(in, &list);
+	if(r != 0) {
+		return NULL;
+	}
+	r = compressed_ciphertext_list_get_fhe_uint128(list, 0, &ct);
+	if(r != 0) {
+		ct = NULL;
+	}
+	r = compressed_ciphertext_list_destroy(list);
+	assert(r == 0);
+	return ct;
+}
+
+int compress_fhe_uint160(void *ct, void* sks, DynamicBuffer* out) {
+	CompressedCiphertextListBuilder* builder = NULL;
+	CompressedCiphertextList* list = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_builder_new(&builder);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_builder_push_fhe_uint160(builder, ct);
+	if(r == 0) {
+		r = compressed_ciphertext_list_builder_build(builder, &list);
+	}
+	const int r_destroy = compressed_ciphertext_list_builder_destroy(builder);
+	assert(r_destroy == 0);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_serialize(list, out);
+	const int r_destroy_list = compressed_ciphertext_list_destroy(list);
+	assert(r_destroy_list == 0);
+	return r;
+}
+
+void* decompress_fhe_uint160(DynamicBufferView in, void* sks) {
+	CompressedCiphertextList* list = NULL;
+	FheUint160* ct = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_deserialize(in, &list);
+	if(r != 0) {
+		return NULL;
+	}
+	r = compressed_ciphertext_list_get_fhe_uint160(list, 0, &ct);
+	if(r != 0) {
+		ct = NULL;
+	}
+	r = compressed_ciphertext_list_destroy(list);
+	assert(r == 0);
+	return ct;
+}
+
+int compress_fhe_uint2048(void *ct, void* sks, DynamicBuffer* out) {
+	CompressedCiphertextListBuilder* builder = NULL;
+	CompressedCiphertextList* list = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_builder_new(&builder);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_builder_push_fhe_uint2048(builder, ct);
+	if(r == 0) {
+		r = compressed_ciphertext_list_builder_build(builder, &list);
+	}
+	const int r_destroy = compressed_ciphertext_list_builder_destroy(builder);
+	assert(r_destroy == 0);
+	if(r != 0) {
+		return r;
+	}
+	r = compressed_ciphertext_list_serialize(list, out);
+	const int r_destroy_list = compressed_ciphertext_list_destroy(list);
+	assert(r_destroy_list == 0);
+	return r;
+}
+
+void* decompress_fhe_uint2048(DynamicBufferView in, void* sks) {
+	CompressedCiphertextList* list = NULL;
+	FheUint2048* ct = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = compressed_ciphertext_list_deserialize(in, &list);
+	if(r != 0) {
+		return NULL;
+	}
+	r = compressed_ciphertext_list_get_fhe_uint2048(list, 0, &ct);
+	if(r != 0) {
+		ct = NULL;
+	}
+	r = compressed_ciphertext_list_destroy(list);
+	assert(r == 0);
+	return ct;
+}
+
+void* generate_key_switching_key(void* cks_from, void* sks_from, void* cks_to, void* sks_to) {
+	KeySwitchingKey* ksk = NULL;
+	const int r = key_switching_key_new(cks_from, sks_from, cks_to, sks_to, SHORTINT_PARAM_KEYSWITCH_MESSAGE_2_CARRY_2_KS_PBS, &ksk);
+	if(r != 0) return NULL;
+	return ksk;
+}
+
+int serialize_key_switching_key(void* ksk, DynamicBuffer* out) {
+	return key_switching_key_safe_serialize(ksk, out, SAFE_SERIALIZATION_SIZE_LIMIT);
+}
+
+void* deserialize_key_switching_key(DynamicBufferView in) {
+	KeySwitchingKey* ksk = NULL;
+	const int r = key_switching_key_safe_deserialize(in, SAFE_SERIALIZATION_SIZE_LIMIT, &ksk);
+	if(r != 0) return NULL;
+	return ksk;
+}
+
+void destroy_key_switching_key(void* ksk) {
+	const int r = key_switching_key_destroy(ksk);
+	assert(r == 0);
+}
+
+void* key_switch_fhe_bool(void* ct, void* ksk, void* sks_to) {
+	FheBool* result = NULL;
+
+	checked_set_server_key(sks_to);
+
+	const int r = fhe_bool_key_switch(ct, ksk, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* key_switch_fhe_uint4(void* ct, void* ksk, void* sks_to) {
+	FheUint4* result = NULL;
+
+	checked_set_server_key(sks_to);
+
+	const int r = fhe_uint4_key_switch(ct, ksk, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* key_switch_fhe_uint8(void* ct, void* ksk, void* sks_to) {
+	FheUint8* result = NULL;
+
+	checked_set_server_key(sks_to);
+
+	const int r = fhe_uint8_key_switch(ct, ksk, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* key_switch_fhe_uint16(void* ct, void* ksk, void* sks_to) {
+	FheUint16* result = NULL;
+
+	checked_set_server_key(sks_to);
+
+	const int r = fhe_uint16_key_switch(ct, ksk, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* key_switch_fhe_uint32(void* ct, void* ksk, void* sks_to) {
+	FheUint32* result = NULL;
+
+	checked_set_server_key(sks_to);
+
+	const int r = fhe_uint32_key_switch(ct, ksk, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* key_switch_fhe_uint64(void* ct, void* ksk, void* sks_to) {
+	FheUint64* result = NULL;
+
+	checked_set_server_key(sks_to);
+
+	const int r = fhe_uint64_key_switch(ct, ksk, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* key_switch_fhe_uint128(void* ct, void* ksk, void* sks_to) {
+	FheUint128* result = NULL;
+
+	checked_set_server_key(sks_to);
+
+	const int r = fhe_uint128_key_switch(ct, ksk, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* key_switch_fhe_uint160(void* ct, void* ksk, void* sks_to) {
+	FheUint160* result = NULL;
+
+	checked_set_server_key(sks_to);
+
+	const int r = fhe_uint160_key_switch(ct, ksk, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* key_switch_fhe_uint2048(void* ct, void* ksk, void* sks_to) {
+	FheUint2048* result = NULL;
+
+	checked_set_server_key(sks_to);
+
+	const int r = fhe_uint2048_key_switch(ct, ksk, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
 void destroy_fhe_bool(void* ct) {
 	const int r = fhe_bool_destroy(ct);
 	assert(r == 0);
@@ -458,11 +1039,21 @@ void destroy_fhe_uint64(void* ct) {
 	assert(r == 0);
 }
 
+void destroy_fhe_uint128(void* ct) {
+	const int r = fhe_uint128_destroy(ct);
+	assert(r == 0);
+}
+
 void destroy_fhe_uint160(void* ct) {
 	const int r = fhe_uint160_destroy(ct);
 	assert(r == 0);
 }
 
+void destroy_fhe_uint256(void* ct) {
+	const int r = fhe_uint256_destroy(ct);
+	assert(r == 0);
+}
+
 void destroy_fhe_uint2048(void* ct) {
 	const int r = fhe_uint2048_destroy(ct);
 	assert(r == 0);
@@ -699,101 +1290,211 @@ void* mul_fhe_uint4(void* ct1, void* ct2, void* sks)
 	return result;
 }
 
-void* mul_fhe_uint8(void* ct1, void* ct2, void* sks)
+void* mul_fhe_uint8(void* ct1, void* ct2, void* sks)
+{
+	FheUint8* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint8_mul(ct1, ct2, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* mul_fhe_uint16(void* ct1, void* ct2, void* sks)
+{
+	FheUint16* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint16_mul(ct1, ct2, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* mul_fhe_uint32(void* ct1, void* ct2, void* sks)
+{
+	FheUint32* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint32_mul(ct1, ct2, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* mul_fhe_uint64(void* ct1, void* ct2, void* sks)
+{
+	FheUint64* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint64_mul(ct1, ct2, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* scalar_mul_fhe_uint4(void* ct, uint8_t pt, void* sks)
+{
+	FheUint4* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint4_scalar_mul(ct, pt, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* scalar_mul_fhe_uint8(void* ct, uint8_t pt, void* sks)
+{
+	FheUint8* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint8_scalar_mul(ct, pt, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* scalar_mul_fhe_uint16(void* ct, uint16_t pt, void* sks)
+{
+	FheUint16* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint16_scalar_mul(ct, pt, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* scalar_mul_fhe_uint32(void* ct, uint32_t pt, void* sks)
+{
+	FheUint32* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint32_scalar_mul(ct, pt, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* scalar_mul_fhe_uint64(void* ct, uint64_t pt, void* sks)
+{
+	FheUint64* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint64_scalar_mul(ct, pt, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* div_fhe_uint4(void* ct1, void* ct2, void* sks)
+{
+	FheUint4* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint4_div(ct1, ct2, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* div_fhe_uint8(void* ct1, void* ct2, void* sks)
 {
 	FheUint8* result = NULL;
 
 	checked_set_server_key(sks);
 
-	const int r = fhe_uint8_mul(ct1, ct2, &result);
+	const int r = fhe_uint8_div(ct1, ct2, &result);
 	if(r != 0) return NULL;
 	return result;
 }
 
-void* mul_fhe_uint16(void* ct1, void* ct2, void* sks)
+void* div_fhe_uint16(void* ct1, void* ct2, void* sks)
 {
 	FheUint16* result = NULL;
 
 	checked_set_server_key(sks);
 
-	const int r = fhe_uint16_mul(ct1, ct2, &result);
+	const int r = fhe_uint16_div(ct1, ct2, &result);
 	if(r != 0) return NULL;
 	return result;
 }
 
-void* mul_fhe_uint32(void* ct1, void* ct2, void* sks)
+void* div_fhe_uint32(void* ct1, void* ct2, void* sks)
 {
 	FheUint32* result = NULL;
 
 	checked_set_server_key(sks);
 
-	const int r = fhe_uint32_mul(ct1, ct2, &result);
+	const int r = fhe_uint32_div(ct1, ct2, &result);
 	if(r != 0) return NULL;
 	return result;
 }
 
-void* mul_fhe_uint64(void* ct1, void* ct2, void* sks)
+void* div_fhe_uint64(void* ct1, void* ct2, void* sks)
 {
 	FheUint64* result = NULL;
 
 	checked_set_server_key(sks);
 
-	const int r = fhe_uint64_mul(ct1, ct2, &result);
+	const int r = fhe_uint64_div(ct1, ct2, &result);
 	if(r != 0) return NULL;
 	return result;
 }
 
-void* scalar_mul_fhe_uint4(void* ct, uint8_t pt, void* sks)
+void* rem_fhe_uint4(void* ct1, void* ct2, void* sks)
 {
 	FheUint4* result = NULL;
 
 	checked_set_server_key(sks);
 
-	const int r = fhe_uint4_scalar_mul(ct, pt, &result);
+	const int r = fhe_uint4_rem(ct1, ct2, &result);
 	if(r != 0) return NULL;
 	return result;
 }
 
-void* scalar_mul_fhe_uint8(void* ct, uint8_t pt, void* sks)
+void* rem_fhe_uint8(void* ct1, void* ct2, void* sks)
 {
 	FheUint8* result = NULL;
 
 	checked_set_server_key(sks);
 
-	const int r = fhe_uint8_scalar_mul(ct, pt, &result);
+	const int r = fhe_uint8_rem(ct1, ct2, &result);
 	if(r != 0) return NULL;
 	return result;
 }
 
-void* scalar_mul_fhe_uint16(void* ct, uint16_t pt, void* sks)
+void* rem_fhe_uint16(void* ct1, void* ct2, void* sks)
 {
 	FheUint16* result = NULL;
 
 	checked_set_server_key(sks);
 
-	const int r = fhe_uint16_scalar_mul(ct, pt, &result);
+	const int r = fhe_uint16_rem(ct1, ct2, &result);
 	if(r != 0) return NULL;
 	return result;
 }
 
-void* scalar_mul_fhe_uint32(void* ct, uint32_t pt, void* sks)
+void* rem_fhe_uint32(void* ct1, void* ct2, void* sks)
 {
 	FheUint32* result = NULL;
 
 	checked_set_server_key(sks);
 
-	const int r = fhe_uint32_scalar_mul(ct, pt, &result);
+	const int r = fhe_uint32_rem(ct1, ct2, &result);
 	if(r != 0) return NULL;
 	return result;
 }
 
-void* scalar_mul_fhe_uint64(void* ct, uint64_t pt, void* sks)
+void* rem_fhe_uint64(void* ct1, void* ct2, void* sks)
 {
 	FheUint64* result = NULL;
 
 	checked_set_server_key(sks);
 
-	const int r = fhe_uint64_scalar_mul(ct, pt, &result);
+	const int r = fhe_uint64_rem(ct1, ct2, &result);
 	if(r != 0) return NULL;
 	return result;
 }
@@ -908,6 +1609,39 @@ void* scalar_rem_fhe_uint64(void* ct, uint64_t pt, void* sks)
 	return result;
 }
 
+void* scalar_rem_fhe_uint128(void* ct, struct U128 pt, void* sks)
+{
+	FheUint128* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint128_scalar_rem(ct, pt, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* scalar_rem_fhe_uint160(void* ct, struct U256 pt, void* sks)
+{
+	FheUint160* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint160_scalar_rem(ct, pt, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* scalar_rem_fhe_uint256(void* ct, struct U256 pt, void* sks)
+{
+	FheUint256* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint256_scalar_rem(ct, pt, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
 void* bitand_fhe_bool(void* ct1, void* ct2, void* sks)
 {
 	FheBool* result = NULL;
@@ -2781,6 +3515,11 @@ int decrypt_fhe_uint64(void* cks, void* ct, uint64_t* res)
 	return fhe_uint64_decrypt(ct, cks, res);
 }
 
+int decrypt_fhe_uint128(void* cks, void* ct, struct U128 *res)
+{
+	return fhe_uint128_decrypt(ct, cks, res);
+}
+
 int decrypt_fhe_uint160(void* cks, void* ct, struct U256 *res)
 {
 	return fhe_uint160_decrypt(ct, cks, res);
@@ -2886,6 +3625,15 @@ void* public_key_encrypt_fhe_uint64(void* pks, uint64_t value) {
 	return ct;
 }
 
+void* public_key_encrypt_fhe_uint128(void* pks, struct U128 value) {
+	FheUint128* ct = NULL;
+
+	int r = fhe_uint128_try_encrypt_with_compact_public_key_u128(value, pks, &ct);
+  	assert(r == 0);
+
+	return ct;
+}
+
 void* public_key_encrypt_fhe_uint160(void* pks, struct U256 *value) {
 	CompactFheUint160List* list = NULL;
 	FheUint160* ct = NULL;
@@ -2977,6 +3725,17 @@ void* trivial_encrypt_fhe_uint64(void* sks, uint64_t value) {
 	return ct;
 }
 
+void* trivial_encrypt_fhe_uint128(void* sks, struct U128 value) {
+	FheUint128* ct = NULL;
+
+	checked_set_server_key(sks);
+
+	int r = fhe_uint128_try_encrypt_trivial_u128(value, &ct);
+  	assert(r == 0);
+
+	return ct;
+}
+
 void* trivial_encrypt_fhe_uint160(void* sks, struct U256* value) {
 	FheUint160* ct = NULL;
 
@@ -3005,7 +3764,7 @@ void public_key_encrypt_and_serialize_fhe_bool_list(void* pks, bool value, Dynam
 	int r = compact_fhe_bool_list_try_encrypt_with_compact_public_key_bool(&value, 1, pks, &list);
   	assert(r == 0);
 
-	r = compact_fhe_bool_list_serialize(list, out);
+	r = compact_fhe_bool_list_safe_serialize(list, out, SAFE_SERIALIZATION_SIZE_LIMIT);
 	assert(r == 0);
 
 	r = compact_fhe_bool_list_destroy(list);
@@ -3018,7 +3777,7 @@ void public_key_encrypt_and_serialize_fhe_uint4_list(void* pks, uint8_t value, D
 	int r = compact_fhe_uint4_list_try_encrypt_with_compact_public_key_u8(&value, 1, pks, &list);
   	assert(r == 0);
 
-	r = compact_fhe_uint4_list_serialize(list, out);
+	r = compact_fhe_uint4_list_safe_serialize(list, out, SAFE_SERIALIZATION_SIZE_LIMIT);
 	assert(r == 0);
 
 	r = compact_fhe_uint4_list_destroy(list);
@@ -3031,7 +3790,7 @@ void public_key_encrypt_and_serialize_fhe_uint8_list(void* pks, uint8_t value, D
 	int r = compact_fhe_uint8_list_try_encrypt_with_compact_public_key_u8(&value, 1, pks, &list);
   	assert(r == 0);
 
-	r = compact_fhe_uint8_list_serialize(list, out);
+	r = compact_fhe_uint8_list_safe_serialize(list, out, SAFE_SERIALIZATION_SIZE_LIMIT);
 	assert(r == 0);
 
 	r = compact_fhe_uint8_list_destroy(list);
@@ -3044,7 +3803,7 @@ void public_key_encrypt_and_serialize_fhe_uint16_list(void* pks, uint16_t value,
 	int r = compact_fhe_uint16_list_try_encrypt_with_compact_public_key_u16(&value, 1, pks, &list);
   	assert(r == 0);
 
-	r = compact_fhe_uint16_list_serialize(list, out);
+	r = compact_fhe_uint16_list_safe_serialize(list, out, SAFE_SERIALIZATION_SIZE_LIMIT);
 	assert(r == 0);
 
 	r = compact_fhe_uint16_list_destroy(list);
@@ -3057,7 +3816,7 @@ void public_key_encrypt_and_serialize_fhe_uint32_list(void* pks, uint32_t value,
 	int r = compact_fhe_uint32_list_try_encrypt_with_compact_public_key_u32(&value, 1, pks, &list);
   	assert(r == 0);
 
-	r = compact_fhe_uint32_list_serialize(list, out);
+	r = compact_fhe_uint32_list_safe_serialize(list, out, SAFE_SERIALIZATION_SIZE_LIMIT);
 	assert(r == 0);
 
 	r = compact_fhe_uint32_list_destroy(list);
@@ -3070,7 +3829,7 @@ void public_key_encrypt_and_serialize_fhe_uint64_list(void* pks, uint64_t value,
 	int r = compact_fhe_uint64_list_try_encrypt_with_compact_public_key_u64(&value, 1, pks, &list);
   	assert(r == 0);
 
-	r = compact_fhe_uint64_list_serialize(list, out);
+	r = compact_fhe_uint64_list_safe_serialize(list, out, SAFE_SERIALIZATION_SIZE_LIMIT);
 	assert(r == 0);
 
 	r = compact_fhe_uint64_list_destroy(list);
@@ -3084,7 +3843,7 @@ void public_key_encrypt_and_serialize_fhe_uint160_list(void* pks, struct U256 *v
 	int r = compact_fhe_uint160_list_try_encrypt_with_compact_public_key_u256(value, 1, pks, &list);
   	assert(r == 0);
 
-	r = compact_fhe_uint160_list_serialize(list, out);
+	r = compact_fhe_uint160_list_safe_serialize(list, out, SAFE_SERIALIZATION_SIZE_LIMIT);
 	assert(r == 0);
 
 	r = compact_fhe_uint160_list_destroy(list);
@@ -3098,7 +3857,7 @@ void public_key_encrypt_and_serialize_fhe_uint2048_list(void* pks, struct U2048
 	int r = compact_fhe_uint2048_list_try_encrypt_with_compact_public_key_u2048(value, 1, pks, &list);
   	assert(r == 0);
 
-	r = compact_fhe_uint2048_list_serialize(list, out);
+	r = compact_fhe_uint2048_list_safe_serialize(list, out, SAFE_SERIALIZATION_SIZE_LIMIT);
 	assert(r == 0);
 
 	r = compact_fhe_uint2048_list_destroy(list);
@@ -3305,6 +4064,56 @@ void* cast_64_32(void* ct, void* sks) {
 	return result;
 }
 
+void* cast_128_4(void* ct, void* sks) {
+	FheUint4* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint128_cast_into_fhe_uint4(ct, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* cast_128_8(void* ct, void* sks) {
+	FheUint8* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint128_cast_into_fhe_uint8(ct, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* cast_128_16(void* ct, void* sks) {
+	FheUint16* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint128_cast_into_fhe_uint16(ct, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* cast_128_32(void* ct, void* sks) {
+	FheUint32* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint128_cast_into_fhe_uint32(ct, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* cast_128_64(void* ct, void* sks) {
+	FheUint64* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint128_cast_into_fhe_uint64(ct, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
 void* cast_160_4(void* ct, void* sks) {
 	FheUint4* result = NULL;
 
@@ -3354,3 +4163,199 @@ void* cast_160_64(void* ct, void* sks) {
 	if(r != 0) return NULL;
 	return result;
 }
+
+void* cast_160_128(void* ct, void* sks) {
+	FheUint128* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint160_cast_into_fhe_uint128(ct, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* cast_256_160(void* ct, void* sks) {
+	FheUint160* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint256_cast_into_fhe_uint160(ct, &result);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_random_fhe_bool(void* sks, uint64_t seed_low, uint64_t seed_high)
+{
+	FheBool* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_bool_generate_oblivious_pseudo_random(&result, seed_low, seed_high);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_random_fhe_uint4(void* sks, uint64_t seed_low, uint64_t seed_high)
+{
+	FheUint4* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint4_generate_oblivious_pseudo_random(&result, seed_low, seed_high);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_random_fhe_uint8(void* sks, uint64_t seed_low, uint64_t seed_high)
+{
+	FheUint8* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint8_generate_oblivious_pseudo_random(&result, seed_low, seed_high);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_random_fhe_uint16(void* sks, uint64_t seed_low, uint64_t seed_high)
+{
+	FheUint16* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint16_generate_oblivious_pseudo_random(&result, seed_low, seed_high);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_random_fhe_uint32(void* sks, uint64_t seed_low, uint64_t seed_high)
+{
+	FheUint32* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint32_generate_oblivious_pseudo_random(&result, seed_low, seed_high);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_random_fhe_uint64(void* sks, uint64_t seed_low, uint64_t seed_high)
+{
+	FheUint64* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint64_generate_oblivious_pseudo_random(&result, seed_low, seed_high);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_random_fhe_uint128(void* sks, uint64_t seed_low, uint64_t seed_high)
+{
+	FheUint128* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint128_generate_oblivious_pseudo_random(&result, seed_low, seed_high);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_random_fhe_uint160(void* sks, uint64_t seed_low, uint64_t seed_high)
+{
+	FheUint160* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint160_generate_oblivious_pseudo_random(&result, seed_low, seed_high);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_random_fhe_uint256(void* sks, uint64_t seed_low, uint64_t seed_high)
+{
+	FheUint256* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint256_generate_oblivious_pseudo_random(&result, seed_low, seed_high);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_bounded_random_fhe_uint4(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits)
+{
+	FheUint4* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint4_generate_oblivious_pseudo_random_bounded(&result, seed_low, seed_high, random_bits);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_bounded_random_fhe_uint8(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits)
+{
+	FheUint8* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint8_generate_oblivious_pseudo_random_bounded(&result, seed_low, seed_high, random_bits);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_bounded_random_fhe_uint16(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits)
+{
+	FheUint16* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint16_generate_oblivious_pseudo_random_bounded(&result, seed_low, seed_high, random_bits);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_bounded_random_fhe_uint32(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits)
+{
+	FheUint32* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint32_generate_oblivious_pseudo_random_bounded(&result, seed_low, seed_high, random_bits);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_bounded_random_fhe_uint64(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits)
+{
+	FheUint64* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint64_generate_oblivious_pseudo_random_bounded(&result, seed_low, seed_high, random_bits);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_bounded_random_fhe_uint128(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits)
+{
+	FheUint128* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint128_generate_oblivious_pseudo_random_bounded(&result, seed_low, seed_high, random_bits);
+	if(r != 0) return NULL;
+	return result;
+}
+
+void* generate_bounded_random_fhe_uint160(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits)
+{
+	FheUint160* result = NULL;
+
+	checked_set_server_key(sks);
+
+	const int r = fhe_uint160_generate_oblivious_pseudo_random_bounded(&result, seed_low, seed_high, random_bits);
+	if(r != 0) return NULL;
+	return result;
+}
@@ -26,6 +26,14 @@ func toDynamicBufferView(in []byte) C.DynamicBufferView {
 	}
 }
 
+// Returns a pointer to and the length of the metadata a zero-knowledge proof is bound to. Empty metadata is allowed.
+func toMetadataView(metadata []byte) (*C.uint8_t, C.size_t) {
+	if len(metadata) == 0 {
+		return nil, 0
+	}
+	return (*C.uint8_t)(unsafe.Pointer(&metadata[0])), C.size_t(len(metadata))
+}
+
 func serialize(ptr unsafe.Pointer, t FheUintType) ([]byte, error) {
 	out := &C.DynamicBuffer{}
 	var ret C.int
@@ -42,6 +50,8 @@ func serialize(ptr unsafe.Pointer, t FheUintType) ([]byte, error) {
 		ret = C.serialize_fhe_uint32(ptr, out)
 	case FheUint64:
 		ret = C.serialize_fhe_uint64(ptr, out)
+	case FheUint128:
+		ret = C.serialize_fhe_uint128(ptr, out)
 	case FheUint160:
 		ret = C.serialize_fhe_uint160(ptr, out)
 	case FheUint2048:
@@ -58,6 +68,38 @@ func serialize(ptr unsafe.Pointer, t FheUintType) ([]byte, error) {
 }
 
 func SerializePublicKey() ([]byte, error) {
+	return serializePublicKey(currentKeySet().pks)
+}
+
+func serializeServerKey(sks unsafe.Pointer) ([]byte, error) {
+	if sks == nil {
+		return nil, errors.New("serialize: no server key available")
+	}
+	out := &C.DynamicBuffer{}
+	ret := C.serialize_server_key(sks, out)
+	if ret != 0 {
+		return nil, errors.New("serialize: failed to serialize server key")
+	}
+	ser := C.GoBytes(unsafe.Pointer(out.pointer), C.int(out.length))
+	C.destroy_dynamic_buffer(out)
+	return ser, nil
+}
+
+func serializeClientKey(cks unsafe.Pointer) ([]byte, error) {
+	if cks == nil {
+		return nil, errors.New("serialize: no client key available")
+	}
+	out := &C.DynamicBuffer{}
+	ret := C.serialize_client_key(cks, out)
+	if ret != 0 {
+		return nil, errors.New("serialize: failed to serialize client key")
+	}
+	ser := C.GoBytes(unsafe.Pointer(out.pointer), C.int(out.length))
+	C.destroy_dynamic_buffer(out)
+	return ser, nil
+}
+
+func serializePublicKey(pks unsafe.Pointer) ([]byte, error) {
 	if pks == nil {
 		return nil, errors.New("serialize: no public key available")
 	}
@@ -72,6 +114,7 @@ func SerializePublicKey() ([]byte, error) {
 }
 
 func EncryptAndSerializeCompact(value uint64, fheUintType FheUintType) []byte {
+	ks := currentKeySet()
 	out := &C.DynamicBuffer{}
 	switch fheUintType {
 	case FheBool:
@@ -79,31 +122,31 @@ func EncryptAndSerializeCompact(value uint64, fheUintType FheUintType) []byte {
 		if value == 1 {
 			val = true
 		}
-		C.public_key_encrypt_and_serialize_fhe_bool_list(pks, C.bool(val), out)
+		C.public_key_encrypt_and_serialize_fhe_bool_list(ks.pks, C.bool(val), out)
 	case FheUint4:
-		C.public_key_encrypt_and_serialize_fhe_uint4_list(pks, C.uint8_t(value), out)
+		C.public_key_encrypt_and_serialize_fhe_uint4_list(ks.pks, C.uint8_t(value), out)
 	case FheUint8:
-		C.public_key_encrypt_and_serialize_fhe_uint8_list(pks, C.uint8_t(value), out)
+		C.public_key_encrypt_and_serialize_fhe_uint8_list(ks.pks, C.uint8_t(value), out)
 	case FheUint16:
-		C.public_key_encrypt_and_serialize_fhe_uint16_list(pks, C.uint16_t(value), out)
+		C.public_key_encrypt_and_serialize_fhe_uint16_list(ks.pks, C.uint16_t(value), out)
 	case FheUint32:
-		C.public_key_encrypt_and_serialize_fhe_uint32_list(pks, C.uint32_t(value), out)
+		C.public_key_encrypt_and_serialize_fhe_uint32_list(ks.pks, C.uint32_t(value), out)
 	case FheUint64:
-		C.public_key_encrypt_and_serialize_fhe_uint64_list(pks, C.uint64_t(value), out)
+		C.public_key_encrypt_and_serialize_fhe_uint64_list(ks.pks, C.uint64_t(value), out)
 	case FheUint160:
 		value_big := new(big.Int).SetUint64(value)
 		input, err := bigIntToU256(value_big)
 		if err != nil {
 			panic(err)
 		}
-		C.public_key_encrypt_and_serialize_fhe_uint160_list(pks, input, out)
+		C.public_key_encrypt_and_serialize_fhe_uint160_list(ks.pks, input, out)
 	case FheUint2048:
 		value_big := new(big.Int).SetUint64(value)
 		input, err := bigIntToU2048(value_big)
 		if err != nil {
 			panic(err)
 		}
-		C.public_key_encrypt_and_serialize_fhe_uint2048_list(pks, input, out)
+		C.public_key_encrypt_and_serialize_fhe_uint2048_list(ks.pks, input, out)
 	}
 
 	ser := C.GoBytes(unsafe.Pointer(out.pointer), C.int(out.length))
@@ -111,6 +154,16 @@ func EncryptAndSerializeCompact(value uint64, fheUintType FheUintType) []byte {
 	return ser
 }
 
+// bigIntToU128 splits a big.Int of at most 128 bits into the two words of a U128
+func bigIntToU128(value *big.Int) (C.U128, error) {
+	if value.BitLen() > 128 {
+		return C.U128{}, fmt.Errorf("big.Int too large for U128")
+	}
+	low := new(big.Int).And(value, new(big.Int).SetUint64(^uint64(0)))
+	high := new(big.Int).Rsh(value, 64)
+	return C.U128{w0: C.uint64_t(low.Uint64()), w1: C.uint64_t(high.Uint64())}, nil
+}
+
 // bigIntToU256 uses x to convert big.Int to U256
 func bigIntToU256(value *big.Int) (*C.U256, error) {
 	// Convert big.Int to 32-byte big-endian slice
@@ -143,6 +196,13 @@ func bigIntToU2048(value *big.Int) (*C.U2048, error) {
 	return &result, nil
 }
 
+// u128ToBigInt converts a U128 to a *big.Int.
+func u128ToBigInt(value *C.U128) *big.Int {
+	result := new(big.Int).SetUint64(uint64(value.w1))
+	result.Lsh(result, 64)
+	return result.Or(result, new(big.Int).SetUint64(uint64(value.w0)))
+}
+
 // u256ToBigInt converts a U256 to a *big.Int.
 func u256ToBigInt(value *C.U256) *big.Int {
 	// Allocate a byte slice with enough space (32 bytes for U256)
@@ -161,6 +221,7 @@ func u2048ToBigInt(value *C.U2048) *big.Int {
 }
 
 func EncryptAndSerializeCompact160List(values []big.Int) ([]byte, error) {
+	ks := currentKeySet()
 	if len(values) == 0 {
 		return nil, fmt.Errorf("EncryptAndSerializeCompact160List empty array given")
 	}
@@ -174,14 +235,14 @@ func EncryptAndSerializeCompact160List(values []big.Int) ([]byte, error) {
 	}
 
 	var list *C.CompactFheUint160List
-	ret := C.compact_fhe_uint160_list_try_encrypt_with_compact_public_key_u256(&inputArray[0], (C.size_t)(len(inputArray)), (*C.CompactPublicKey)(pks), &list)
+	ret := C.compact_fhe_uint160_list_try_encrypt_with_compact_public_key_u256(&inputArray[0], (C.size_t)(len(inputArray)), (*C.CompactPublicKey)(ks.pks), &list)
 	if ret != 0 {
 		return nil, fmt.Errorf("EncryptAndSerializeCompact160List failed to encrypt with %d", ret)
 	}
 	defer C.compact_fhe_uint160_list_destroy(list)
 
 	ser := C.DynamicBuffer{}
-	ret = C.compact_fhe_uint160_list_serialize(list, &ser)
+	ret = C.compact_fhe_uint160_list_safe_serialize(list, &ser, C.SAFE_SERIALIZATION_SIZE_LIMIT)
 	if ret != 0 {
 		return nil, fmt.Errorf("EncryptAndSerializeCompact160List failed to serialize with %d", ret)
 	}
@@ -190,11 +251,16 @@ func EncryptAndSerializeCompact160List(values []big.Int) ([]byte, error) {
 	return C.GoBytes(unsafe.Pointer(ser.pointer), C.int(ser.length)), nil
 }
 
-func DeserializeAndExpandCompact160List(in []byte) ([]*TfheCiphertext, error) {
+// Deserializes and expands an untrusted compact list of at most `sizeLimit` bytes.
+func DeserializeAndExpandCompact160List(in []byte, sizeLimit uint64) ([]*TfheCiphertext, error) {
+	ks := currentKeySet()
+	if err := checkInputSize(in, sizeLimit); err != nil {
+		return nil, fmt.Errorf("DeserializeCompact160List %w", err)
+	}
 	var list *C.CompactFheUint160List
-	ret := C.compact_fhe_uint160_list_deserialize(toDynamicBufferView(in), &list)
+	ret := C.compact_fhe_uint160_list_safe_deserialize_conformant(toDynamicBufferView(in), C.uint64_t(sizeLimit), (*C.ServerKey)(ks.sks), &list)
 	if ret != 0 {
-		return nil, fmt.Errorf("DeserializeCompact160List failed to deserialize list with %d", ret)
+		return nil, fmt.Errorf("DeserializeCompact160List %w: failed to deserialize list with %d", ErrInvalidSerialization, ret)
 	}
 	defer C.compact_fhe_uint160_list_destroy(list)
 
@@ -227,6 +293,7 @@ func DeserializeAndExpandCompact160List(in []byte) ([]*TfheCiphertext, error) {
 		ct := new(TfheCiphertext)
 		ct.Serialization = ser
 		ct.FheUintType = FheUint160
+		ct.KeySetId = ks.id
 		ct.computeHash()
 		cts = append(cts, ct)
 	}
@@ -234,6 +301,7 @@ func DeserializeAndExpandCompact160List(in []byte) ([]*TfheCiphertext, error) {
 }
 
 func EncryptAndSerializeCompact2048List(values []big.Int) ([]byte, error) {
+	ks := currentKeySet()
 	if len(values) == 0 {
 		return nil, fmt.Errorf("EncryptAndSerializeCompact2048List empty array given")
 	}
@@ -247,14 +315,14 @@ func EncryptAndSerializeCompact2048List(values []big.Int) ([]byte, error) {
 	}
 
 	var list *C.CompactFheUint2048List
-	ret := C.compact_fhe_uint2048_list_try_encrypt_with_compact_public_key_u2048(&inputArray[0], (C.size_t)(len(inputArray)), (*C.CompactPublicKey)(pks), &list)
+	ret := C.compact_fhe_uint2048_list_try_encrypt_with_compact_public_key_u2048(&inputArray[0], (C.size_t)(len(inputArray)), (*C.CompactPublicKey)(ks.pks), &list)
 	if ret != 0 {
 		return nil, fmt.Errorf("EncryptAndSerializeCompact2048List failed to encrypt with %d", ret)
 	}
 	defer C.compact_fhe_uint2048_list_destroy(list)
 
 	ser := C.DynamicBuffer{}
-	ret = C.compact_fhe_uint2048_list_serialize(list, &ser)
+	ret = C.compact_fhe_uint2048_list_safe_serialize(list, &ser, C.SAFE_SERIALIZATION_SIZE_LIMIT)
 	if ret != 0 {
 		return nil, fmt.Errorf("EncryptAndSerializeCompact2048List failed to serialize with %d", ret)
 	}
@@ -263,11 +331,16 @@ func EncryptAndSerializeCompact2048List(values []big.Int) ([]byte, error) {
 	return C.GoBytes(unsafe.Pointer(ser.pointer), C.int(ser.length)), nil
 }
 
-func DeserializeAndExpandCompact2048List(in []byte) ([]*TfheCiphertext, error) {
+// Deserializes and expands an untrusted compact list of at most `sizeLimit` bytes.
+func DeserializeAndExpandCompact2048List(in []byte, sizeLimit uint64) ([]*TfheCiphertext, error) {
+	ks := currentKeySet()
+	if err := checkInputSize(in, sizeLimit); err != nil {
+		return nil, fmt.Errorf("DeserializeCompact2048List %w", err)
+	}
 	var list *C.CompactFheUint2048List
-	ret := C.compact_fhe_uint2048_list_deserialize(toDynamicBufferView(in), &list)
+	ret := C.compact_fhe_uint2048_list_safe_deserialize_conformant(toDynamicBufferView(in), C.uint64_t(sizeLimit), (*C.ServerKey)(ks.sks), &list)
 	if ret != 0 {
-		return nil, fmt.Errorf("DeserializeCompact2048List failed to deserialize list with %d", ret)
+		return nil, fmt.Errorf("DeserializeCompact2048List %w: failed to deserialize list with %d", ErrInvalidSerialization, ret)
 	}
 	defer C.compact_fhe_uint2048_list_destroy(list)
 
@@ -300,6 +373,471 @@ func DeserializeAndExpandCompact2048List(in []byte) ([]*TfheCiphertext, error) {
 		ct := new(TfheCiphertext)
 		ct.Serialization = ser
 		ct.FheUintType = FheUint2048
+		ct.KeySetId = ks.id
+		ct.computeHash()
+		cts = append(cts, ct)
+	}
+	return cts, nil
+}
+
+func SerializePublicParams() ([]byte, error) {
+	return serializePublicParams(currentKeySet().publicParams)
+}
+
+func serializePublicParams(publicParams unsafe.Pointer) ([]byte, error) {
+	if publicParams == nil {
+		return nil, errors.New("serialize: no CRS public parameters available")
+	}
+	out := &C.DynamicBuffer{}
+	ret := C.serialize_public_params(publicParams, out)
+	if ret != 0 {
+		return nil, errors.New("serialize: failed to serialize CRS public parameters")
+	}
+	ser := C.GoBytes(unsafe.Pointer(out.pointer), C.int(out.length))
+	C.destroy_dynamic_buffer(out)
+	return ser, nil
+}
+
+// Encrypts the given values in a compact FheUint160 list, together with a zero-knowledge proof that the encryptor knows
+// the plaintext values. The proof is bound to `metadata`, which must be given again to verify it. Meant to be used on
+// the client side.
+func EncryptAndProveCompact160List(values []big.Int, metadata []byte) ([]byte, error) {
+	ks := currentKeySet()
+	if len(values) == 0 {
+		return nil, fmt.Errorf("EncryptAndProveCompact160List empty array given")
+	}
+	if ks.publicParams == nil {
+		return nil, fmt.Errorf("EncryptAndProveCompact160List no CRS public parameters available")
+	}
+	inputArray := make([]C.U256, len(values))
+	for i, v := range values {
+		u256, err := bigIntToU256(&v)
+		if err != nil {
+			return nil, err
+		}
+		inputArray[i] = *u256
+	}
+
+	var list *C.ProvenCompactFheUint160List
+	metadataPtr, metadataLen := toMetadataView(metadata)
+	ret := C.proven_compact_fhe_uint160_list_try_encrypt_with_compact_public_key_u256(&inputArray[0], (C.size_t)(len(inputArray)),
+		(*C.CompactPkePublicParams)(ks.publicParams), (*C.CompactPublicKey)(ks.pks), metadataPtr, metadataLen, C.ZkComputeLoadProof, &list)
+	if ret != 0 {
+		return nil, fmt.Errorf("EncryptAndProveCompact160List failed to encrypt with %d", ret)
+	}
+	defer C.proven_compact_fhe_uint160_list_destroy(list)
+
+	ser := C.DynamicBuffer{}
+	ret = C.proven_compact_fhe_uint160_list_safe_serialize(list, &ser, C.SAFE_SERIALIZATION_SIZE_LIMIT)
+	if ret != 0 {
+		return nil, fmt.Errorf("EncryptAndProveCompact160List failed to serialize with %d", ret)
+	}
+	defer C.destroy_dynamic_buffer(&ser)
+
+	return C.GoBytes(unsafe.Pointer(ser.pointer), C.int(ser.length)), nil
+}
+
+// Verifies the zero-knowledge proof of an untrusted proven compact FheUint160 list of at most `sizeLimit` bytes against
+// `metadata` and expands it. Verification fails if the proof was made for other metadata. The list must contain exactly
+// `count` ciphertexts, which is checked before the proof is verified.
+func VerifyAndExpandProvenCompact160List(in []byte, count int, metadata []byte, sizeLimit uint64) ([]*TfheCiphertext, error) {
+	ks := currentKeySet()
+	if ks.publicParams == nil {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact160List no CRS public parameters available")
+	}
+	if err := checkInputSize(in, sizeLimit); err != nil {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact160List %w", err)
+	}
+	var list *C.ProvenCompactFheUint160List
+	ret := C.proven_compact_fhe_uint160_list_safe_deserialize_conformant(toDynamicBufferView(in), C.uint64_t(sizeLimit), (*C.ServerKey)(ks.sks), &list)
+	if ret != 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact160List %w: failed to deserialize list with %d", ErrInvalidSerialization, ret)
+	}
+	defer C.proven_compact_fhe_uint160_list_destroy(list)
+
+	var len C.size_t
+	ret = C.proven_compact_fhe_uint160_list_len(list, &len)
+	if ret != 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact160List failed to get list length with %d", ret)
+	}
+	if len == 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact160List length is 0")
+	}
+	if int(len) != count {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact160List %w: list has %d ciphertexts, expected %d", ErrListMismatch, len, count)
+	}
+
+	expanded := make([]*C.FheUint160, len)
+	metadataPtr, metadataLen := toMetadataView(metadata)
+	ret = C.proven_compact_fhe_uint160_list_verify_and_expand(list, (*C.CompactPkePublicParams)(ks.publicParams), (*C.CompactPublicKey)(ks.pks), metadataPtr, metadataLen, &expanded[0], len)
+	if ret != 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact160List %w: failed to verify proof or expand list with %d", ErrInvalidProof, ret)
+	}
+	defer func() {
+		for _, c := range expanded {
+			C.destroy_fhe_uint160(unsafe.Pointer(c))
+		}
+	}()
+
+	cts := make([]*TfheCiphertext, 0, len)
+	for _, c := range expanded {
+		ser, err := serialize(unsafe.Pointer(c), FheUint160)
+		if err != nil {
+			return nil, err
+		}
+		ct := new(TfheCiphertext)
+		ct.Serialization = ser
+		ct.FheUintType = FheUint160
+		ct.KeySetId = ks.id
+		ct.computeHash()
+		cts = append(cts, ct)
+	}
+	return cts, nil
+}
+
+// Encrypts the given values in a compact FheUint2048 list, together with a zero-knowledge proof that the encryptor
+// knows the plaintext values. The proof is bound to `metadata`, which must be given again to verify it. Meant to be
+// used on the client side.
+func EncryptAndProveCompact2048List(values []big.Int, metadata []byte) ([]byte, error) {
+	ks := currentKeySet()
+	if len(values) == 0 {
+		return nil, fmt.Errorf("EncryptAndProveCompact2048List empty array given")
+	}
+	if ks.publicParams == nil {
+		return nil, fmt.Errorf("EncryptAndProveCompact2048List no CRS public parameters available")
+	}
+	inputArray := make([]C.U2048, len(values))
+	for i, v := range values {
+		u2048, err := bigIntToU2048(&v)
+		if err != nil {
+			return nil, err
+		}
+		inputArray[i] = *u2048
+	}
+
+	var list *C.ProvenCompactFheUint2048List
+	metadataPtr, metadataLen := toMetadataView(metadata)
+	ret := C.proven_compact_fhe_uint2048_list_try_encrypt_with_compact_public_key_u2048(&inputArray[0], (C.size_t)(len(inputArray)),
+		(*C.CompactPkePublicParams)(ks.publicParams), (*C.CompactPublicKey)(ks.pks), metadataPtr, metadataLen, C.ZkComputeLoadProof, &list)
+	if ret != 0 {
+		return nil, fmt.Errorf("EncryptAndProveCompact2048List failed to encrypt with %d", ret)
+	}
+	defer C.proven_compact_fhe_uint2048_list_destroy(list)
+
+	ser := C.DynamicBuffer{}
+	ret = C.proven_compact_fhe_uint2048_list_safe_serialize(list, &ser, C.SAFE_SERIALIZATION_SIZE_LIMIT)
+	if ret != 0 {
+		return nil, fmt.Errorf("EncryptAndProveCompact2048List failed to serialize with %d", ret)
+	}
+	defer C.destroy_dynamic_buffer(&ser)
+
+	return C.GoBytes(unsafe.Pointer(ser.pointer), C.int(ser.length)), nil
+}
+
+// Verifies the zero-knowledge proof of an untrusted proven compact FheUint2048 list of at most `sizeLimit` bytes against
+// `metadata` and expands it. Verification fails if the proof was made for other metadata. The list must contain exactly
+// `count` ciphertexts, which is checked before the proof is verified.
+func VerifyAndExpandProvenCompact2048List(in []byte, count int, metadata []byte, sizeLimit uint64) ([]*TfheCiphertext, error) {
+	ks := currentKeySet()
+	if ks.publicParams == nil {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact2048List no CRS public parameters available")
+	}
+	if err := checkInputSize(in, sizeLimit); err != nil {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact2048List %w", err)
+	}
+	var list *C.ProvenCompactFheUint2048List
+	ret := C.proven_compact_fhe_uint2048_list_safe_deserialize_conformant(toDynamicBufferView(in), C.uint64_t(sizeLimit), (*C.ServerKey)(ks.sks), &list)
+	if ret != 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact2048List %w: failed to deserialize list with %d", ErrInvalidSerialization, ret)
+	}
+	defer C.proven_compact_fhe_uint2048_list_destroy(list)
+
+	var len C.size_t
+	ret = C.proven_compact_fhe_uint2048_list_len(list, &len)
+	if ret != 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact2048List failed to get list length with %d", ret)
+	}
+	if len == 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact2048List length is 0")
+	}
+	if int(len) != count {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact2048List %w: list has %d ciphertexts, expected %d", ErrListMismatch, len, count)
+	}
+
+	expanded := make([]*C.FheUint2048, len)
+	metadataPtr, metadataLen := toMetadataView(metadata)
+	ret = C.proven_compact_fhe_uint2048_list_verify_and_expand(list, (*C.CompactPkePublicParams)(ks.publicParams), (*C.CompactPublicKey)(ks.pks), metadataPtr, metadataLen, &expanded[0], len)
+	if ret != 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompact2048List %w: failed to verify proof or expand list with %d", ErrInvalidProof, ret)
+	}
+	defer func() {
+		for _, c := range expanded {
+			C.destroy_fhe_uint2048(unsafe.Pointer(c))
+		}
+	}()
+
+	cts := make([]*TfheCiphertext, 0, len)
+	for _, c := range expanded {
+		ser, err := serialize(unsafe.Pointer(c), FheUint2048)
+		if err != nil {
+			return nil, err
+		}
+		ct := new(TfheCiphertext)
+		ct.Serialization = ser
+		ct.FheUintType = FheUint2048
+		ct.KeySetId = ks.id
+		ct.computeHash()
+		cts = append(cts, ct)
+	}
+	return cts, nil
+}
+
+// Pushes a single value, encrypted at the given type, to a compact ciphertext list builder.
+func pushToCompactList(builder *C.CompactCiphertextListBuilder, value *big.Int, t FheUintType) error {
+	if !IsValidFheType(byte(t)) {
+		return fmt.Errorf("unsupported type %d", t)
+	}
+	if value.Sign() < 0 || uint(value.BitLen()) > t.NumBits() {
+		return fmt.Errorf("value %s doesn't fit in %s", value, t)
+	}
+	var ret C.int
+	switch t {
+	case FheBool:
+		ret = C.compact_ciphertext_list_builder_push_bool(builder, C.bool(value.Sign() != 0))
+	case FheUint4:
+		ret = C.compact_ciphertext_list_builder_push_u4(builder, C.uint8_t(value.Uint64()))
+	case FheUint8:
+		ret = C.compact_ciphertext_list_builder_push_u8(builder, C.uint8_t(value.Uint64()))
+	case FheUint16:
+		ret = C.compact_ciphertext_list_builder_push_u16(builder, C.uint16_t(value.Uint64()))
+	case FheUint32:
+		ret = C.compact_ciphertext_list_builder_push_u32(builder, C.uint32_t(value.Uint64()))
+	case FheUint64:
+		ret = C.compact_ciphertext_list_builder_push_u64(builder, C.uint64_t(value.Uint64()))
+	case FheUint128:
+		u128, err := bigIntToU128(value)
+		if err != nil {
+			return err
+		}
+		ret = C.compact_ciphertext_list_builder_push_u128(builder, u128)
+	case FheUint160:
+		u256, err := bigIntToU256(value)
+		if err != nil {
+			return err
+		}
+		ret = C.compact_ciphertext_list_builder_push_u160(builder, *u256)
+	case FheUint2048:
+		u2048, err := bigIntToU2048(value)
+		if err != nil {
+			return err
+		}
+		ret = C.compact_ciphertext_list_builder_push_u2048(builder, *u2048)
+	}
+	if ret != 0 {
+		return fmt.Errorf("failed to push %s with %d", t, ret)
+	}
+	return nil
+}
+
+// Gets the ciphertext at `index` from an expanded compact list. Fails if it wasn't encrypted at the given type.
+func getFromCompactListExpander(expander *C.CompactCiphertextListExpander, index int, t FheUintType) (unsafe.Pointer, error) {
+	i := C.size_t(index)
+	var ret C.int
+	var ptr unsafe.Pointer
+	switch t {
+	case FheBool:
+		var out *C.FheBool
+		ret = C.compact_ciphertext_list_expander_get_fhe_bool(expander, i, &out)
+		ptr = unsafe.Pointer(out)
+	case FheUint4:
+		var out *C.FheUint4
+		ret = C.compact_ciphertext_list_expander_get_fhe_uint4(expander, i, &out)
+		ptr = unsafe.Pointer(out)
+	case FheUint8:
+		var out *C.FheUint8
+		ret = C.compact_ciphertext_list_expander_get_fhe_uint8(expander, i, &out)
+		ptr = unsafe.Pointer(out)
+	case FheUint16:
+		var out *C.FheUint16
+		ret = C.compact_ciphertext_list_expander_get_fhe_uint16(expander, i, &out)
+		ptr = unsafe.Pointer(out)
+	case FheUint32:
+		var out *C.FheUint32
+		ret = C.compact_ciphertext_list_expander_get_fhe_uint32(expander, i, &out)
+		ptr = unsafe.Pointer(out)
+	case FheUint64:
+		var out *C.FheUint64
+		ret = C.compact_ciphertext_list_expander_get_fhe_uint64(expander, i, &out)
+		ptr = unsafe.Pointer(out)
+	case FheUint128:
+		var out *C.FheUint128
+		ret = C.compact_ciphertext_list_expander_get_fhe_uint128(expander, i, &out)
+		ptr = unsafe.Pointer(out)
+	case FheUint160:
+		var out *C.FheUint160
+		ret = C.compact_ciphertext_list_expander_get_fhe_uint160(expander, i, &out)
+		ptr = unsafe.Pointer(out)
+	case FheUint2048:
+		var out *C.FheUint2048
+		ret = C.compact_ciphertext_list_expander_get_fhe_uint2048(expander, i, &out)
+		ptr = unsafe.Pointer(out)
+	default:
+		return nil, fmt.Errorf("unsupported type %d", t)
+	}
+	if ret != 0 || ptr == nil {
+		return nil, fmt.Errorf("failed to get %s at index %d with %d", t, index, ret)
+	}
+	return ptr, nil
+}
+
+// Returns the type of a ciphertext kind of a compact list. Fails for kinds we don't support.
+func fheUintTypeOfKind(kind C.FheTypes) (FheUintType, error) {
+	switch kind {
+	case C.Type_FheBool:
+		return FheBool, nil
+	case C.Type_FheUint4:
+		return FheUint4, nil
+	case C.Type_FheUint8:
+		return FheUint8, nil
+	case C.Type_FheUint16:
+		return FheUint16, nil
+	case C.Type_FheUint32:
+		return FheUint32, nil
+	case C.Type_FheUint64:
+		return FheUint64, nil
+	case C.Type_FheUint128:
+		return FheUint128, nil
+	case C.Type_FheUint160:
+		return FheUint160, nil
+	case C.Type_FheUint2048:
+		return FheUint2048, nil
+	}
+	return 0, fmt.Errorf("unsupported kind %d", kind)
+}
+
+// Checks that a deserialized proven compact list contains exactly one ciphertext per given type, each encrypted at
+// that type. Only reads the list, so that a list that doesn't match the types it was priced with is rejected before
+// its proof is verified and it is expanded.
+func checkProvenCompactListTypes(list *C.ProvenCompactCiphertextList, types []FheUintType) error {
+	var listLen C.size_t
+	ret := C.proven_compact_ciphertext_list_len(list, &listLen)
+	if ret != 0 {
+		return fmt.Errorf("failed to get list length with %d", ret)
+	}
+	if int(listLen) != len(types) {
+		return fmt.Errorf("%w: list has %d ciphertexts, expected %d", ErrListMismatch, listLen, len(types))
+	}
+	for i, t := range types {
+		var kind C.FheTypes
+		ret = C.proven_compact_ciphertext_list_get_kind_of(list, C.size_t(i), &kind)
+		if ret != 0 {
+			return fmt.Errorf("failed to get the kind at index %d with %d", i, ret)
+		}
+		listType, err := fheUintTypeOfKind(kind)
+		if err != nil {
+			return fmt.Errorf("%w: %v at index %d", ErrListMismatch, err, i)
+		}
+		if listType != t {
+			return fmt.Errorf("%w: list has %s at index %d, expected %s", ErrListMismatch, listType, i, t)
+		}
+	}
+	return nil
+}
+
+// Encrypts the given values in a compact list, each value at its own type, together with a zero-knowledge proof that
+// the encryptor knows the plaintext values. The proof is bound to `metadata`, which must be given again to verify it.
+// Meant to be used on the client side.
+func EncryptAndProveCompactList(values []big.Int, types []FheUintType, metadata []byte) ([]byte, error) {
+	ks := currentKeySet()
+	if len(values) == 0 {
+		return nil, fmt.Errorf("EncryptAndProveCompactList empty array given")
+	}
+	if len(values) != len(types) {
+		return nil, fmt.Errorf("EncryptAndProveCompactList got %d values but %d types", len(values), len(types))
+	}
+	if ks.publicParams == nil {
+		return nil, fmt.Errorf("EncryptAndProveCompactList no CRS public parameters available")
+	}
+
+	var builder *C.CompactCiphertextListBuilder
+	ret := C.compact_ciphertext_list_builder_new((*C.CompactPublicKey)(ks.pks), &builder)
+	if ret != 0 {
+		return nil, fmt.Errorf("EncryptAndProveCompactList failed to create list builder with %d", ret)
+	}
+	defer C.compact_ciphertext_list_builder_destroy(builder)
+
+	for i := range values {
+		if err := pushToCompactList(builder, &values[i], types[i]); err != nil {
+			return nil, fmt.Errorf("EncryptAndProveCompactList %v", err)
+		}
+	}
+
+	var list *C.ProvenCompactCiphertextList
+	metadataPtr, metadataLen := toMetadataView(metadata)
+	ret = C.compact_ciphertext_list_builder_build_with_proof(builder, (*C.CompactPkePublicParams)(ks.publicParams), metadataPtr, metadataLen, C.ZkComputeLoadProof, &list)
+	if ret != 0 {
+		return nil, fmt.Errorf("EncryptAndProveCompactList failed to encrypt with %d", ret)
+	}
+	defer C.proven_compact_ciphertext_list_destroy(list)
+
+	ser := C.DynamicBuffer{}
+	ret = C.proven_compact_ciphertext_list_safe_serialize(list, &ser, C.SAFE_SERIALIZATION_SIZE_LIMIT)
+	if ret != 0 {
+		return nil, fmt.Errorf("EncryptAndProveCompactList failed to serialize with %d", ret)
+	}
+	defer C.destroy_dynamic_buffer(&ser)
+
+	return C.GoBytes(unsafe.Pointer(ser.pointer), C.int(ser.length)), nil
+}
+
+// Verifies the zero-knowledge proof of an untrusted proven compact list of at most `sizeLimit` bytes against `metadata`
+// and expands it. Verification fails if the proof was made for other metadata. The list must contain exactly one
+// ciphertext per given type, each encrypted at that type, which is checked before the proof is verified. No casts are
+// performed.
+func VerifyAndExpandProvenCompactList(in []byte, types []FheUintType, metadata []byte, sizeLimit uint64) ([]*TfheCiphertext, error) {
+	ks := currentKeySet()
+	if len(types) == 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompactList no types given")
+	}
+	if ks.publicParams == nil {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompactList no CRS public parameters available")
+	}
+	if err := checkInputSize(in, sizeLimit); err != nil {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompactList %w", err)
+	}
+	var list *C.ProvenCompactCiphertextList
+	ret := C.proven_compact_ciphertext_list_safe_deserialize_conformant(toDynamicBufferView(in), C.uint64_t(sizeLimit), (*C.ServerKey)(ks.sks), &list)
+	if ret != 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompactList %w: failed to deserialize list with %d", ErrInvalidSerialization, ret)
+	}
+	defer C.proven_compact_ciphertext_list_destroy(list)
+	if err := checkProvenCompactListTypes(list, types); err != nil {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompactList %w", err)
+	}
+
+	var expander *C.CompactCiphertextListExpander
+	metadataPtr, metadataLen := toMetadataView(metadata)
+	ret = C.proven_compact_ciphertext_list_verify_and_expand(list, (*C.CompactPkePublicParams)(ks.publicParams), (*C.CompactPublicKey)(ks.pks), metadataPtr, metadataLen, &expander)
+	if ret != 0 {
+		return nil, fmt.Errorf("VerifyAndExpandProvenCompactList %w: failed to verify proof or expand list with %d", ErrInvalidProof, ret)
+	}
+	defer C.compact_ciphertext_list_expander_destroy(expander)
+
+	cts := make([]*TfheCiphertext, 0, len(types))
+	for i, t := range types {
+		ptr, err := getFromCompactListExpander(expander, i, t)
+		if err != nil {
+			return nil, fmt.Errorf("VerifyAndExpandProvenCompactList %v", err)
+		}
+		ser, err := serialize(ptr, t)
+		destroyCiphertext(ptr, t)
+		if err != nil {
+			return nil, err
+		}
+		ct := new(TfheCiphertext)
+		ct.Serialization = ser
+		ct.FheUintType = t
+		ct.KeySetId = ks.id
 		ct.computeHash()
 		cts = append(cts, ct)
 	}
@@ -307,13 +845,16 @@ func DeserializeAndExpandCompact2048List(in []byte) ([]*TfheCiphertext, error) {
 }
 
 func castFheUint160To(ct *TfheCiphertext, fheUintType FheUintType) (*TfheCiphertext, error) {
+	sks, err := serverKeyOf(ct)
+	if err != nil {
+		return nil, err
+	}
 	ptr160 := C.deserialize_fhe_uint160(toDynamicBufferView(ct.Serialize()))
 	if ptr160 == nil {
 		return nil, errors.New("CastFheUint160To failed to deserialize FheUint160 ciphertext")
 	}
 	defer C.destroy_fhe_uint160(ptr160)
 
-	var err error
 	var resPtr unsafe.Pointer
 	switch fheUintType {
 	case FheBool:
@@ -349,6 +890,7 @@ func castFheUint160To(ct *TfheCiphertext, fheUintType FheUintType) (*TfheCiphert
 		return nil, err
 	}
 	res.FheUintType = fheUintType
+	res.KeySetId = ct.KeySetId
 	res.computeHash()
 	return res, nil
 }
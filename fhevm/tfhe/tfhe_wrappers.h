@@ -3,14 +3,33 @@
 #undef NDEBUG
 #include <assert.h>
 
+// Upper bound on the size of anything serialized with tfhe-rs safe serialization. Deserialization of untrusted
+// inputs is bounded by a caller-provided limit instead.
+#define SAFE_SERIALIZATION_SIZE_LIMIT (1ull << 30)
+
 typedef struct FhevmKeys{
 	void *sks, *cks, *pks;
 } FhevmKeys;
 
-FhevmKeys generate_fhevm_keys();
+// Parameter sets keys can be generated with, see ParameterSet in tfhe_parameter_sets.go.
+#define FHEVM_PARAMETER_SET_DEFAULT 0
+#define FHEVM_PARAMETER_SET_MULTI_BIT 1
+#define FHEVM_PARAMETER_SET_COMPACT_PK 2
+
+FhevmKeys generate_fhevm_keys(uint8_t parameter_set);
+
+void* generate_public_params(uint8_t parameter_set, size_t max_num_bits);
+
+int serialize_public_params(void *public_params, DynamicBuffer* out);
+
+void* deserialize_public_params(DynamicBufferView in);
 
 int serialize_compact_public_key(void *pks, DynamicBuffer* out);
 
+int serialize_server_key(void *sks, DynamicBuffer* out);
+
+int serialize_client_key(void *cks, DynamicBuffer* out);
+
 void* deserialize_server_key(DynamicBufferView in);
 
 void* deserialize_client_key(DynamicBufferView in);
@@ -23,37 +42,41 @@ int serialize_fhe_bool(void *ct, DynamicBuffer* out);
 
 void* deserialize_fhe_bool(DynamicBufferView in);
 
-void* deserialize_compact_fhe_bool(DynamicBufferView in);
+void* deserialize_compact_fhe_bool(DynamicBufferView in, uint64_t size_limit, void* sks);
 
 int serialize_fhe_uint4(void *ct, DynamicBuffer* out);
 
 void* deserialize_fhe_uint4(DynamicBufferView in);
 
-void* deserialize_compact_fhe_uint4(DynamicBufferView in);
+void* deserialize_compact_fhe_uint4(DynamicBufferView in, uint64_t size_limit, void* sks);
 
 int serialize_fhe_uint8(void *ct, DynamicBuffer* out);
 
 void* deserialize_fhe_uint8(DynamicBufferView in);
 
-void* deserialize_compact_fhe_uint8(DynamicBufferView in);
+void* deserialize_compact_fhe_uint8(DynamicBufferView in, uint64_t size_limit, void* sks);
 
 int serialize_fhe_uint16(void *ct, DynamicBuffer* out);
 
 void* deserialize_fhe_uint16(DynamicBufferView in);
 
-void* deserialize_compact_fhe_uint16(DynamicBufferView in);
+void* deserialize_compact_fhe_uint16(DynamicBufferView in, uint64_t size_limit, void* sks);
 
 int serialize_fhe_uint32(void *ct, DynamicBuffer* out);
 
 void* deserialize_fhe_uint32(DynamicBufferView in);
 
-void* deserialize_compact_fhe_uint32(DynamicBufferView in);
+void* deserialize_compact_fhe_uint32(DynamicBufferView in, uint64_t size_limit, void* sks);
 
 int serialize_fhe_uint64(void *ct, DynamicBuffer* out);
 
 void* deserialize_fhe_uint64(DynamicBufferView in);
 
-void* deserialize_compact_fhe_uint64(DynamicBufferView in);
+void* deserialize_compact_fhe_uint64(DynamicBufferView in, uint64_t size_limit, void* sks);
+
+int serialize_fhe_uint128(void *ct, DynamicBuffer* out);
+
+void* deserialize_fhe_uint128(DynamicBufferView in);
 
 int serialize_fhe_uint160(void *ct, DynamicBuffer* out);
 
@@ -63,9 +86,71 @@ void* deserialize_fhe_uint160(DynamicBufferView in);
 
 void* deserialize_fhe_uint2048(DynamicBufferView in);
 
-void* deserialize_compact_fhe_uint160(DynamicBufferView in);
+void* deserialize_compact_fhe_uint160(DynamicBufferView in, uint64_t size_limit, void* sks);
+
+void* deserialize_compact_fhe_uint2048(DynamicBufferView in, uint64_t size_limit, void* sks);
+
+int compress_fhe_bool(void *ct, void* sks, DynamicBuffer* out);
+
+void* decompress_fhe_bool(DynamicBufferView in, void* sks);
+
+int compress_fhe_uint4(void *ct, void* sks, DynamicBuffer* out);
+
+void* decompress_fhe_uint4(DynamicBufferView in, void* sks);
+
+int compress_fhe_uint8(void *ct, void* sks, DynamicBuffer* out);
+
+void* decompress_fhe_uint8(DynamicBufferView in, void* sks);
+
+int compress_fhe_uint16(void *ct, void* sks, DynamicBuffer* out);
+
+void* decompress_fhe_uint16(DynamicBufferView in, void* sks);
+
+int compress_fhe_uint32(void *ct, void* sks, DynamicBuffer* out);
+
+void* decompress_fhe_uint32(DynamicBufferView in, void* sks);
+
+int compress_fhe_uint64(void *ct, void* sks, DynamicBuffer* out);
 
-void* deserialize_compact_fhe_uint2048(DynamicBufferView in);
+void* decompress_fhe_uint64(DynamicBufferView in, void* sks);
+
+int compress_fhe_uint128(void *ct, void* sks, DynamicBuffer* out);
+
+void* decompress_fhe_uint128(DynamicBufferView in, void* sks);
+
+int compress_fhe_uint160(void *ct, void* sks, DynamicBuffer* out);
+
+void* decompress_fhe_uint160(DynamicBufferView in, void* sks);
+
+int compress_fhe_uint2048(void *ct, void* sks, DynamicBuffer* out);
+
+void* decompress_fhe_uint2048(DynamicBufferView in, void* sks);
+
+void* generate_key_switching_key(void* cks_from, void* sks_from, void* cks_to, void* sks_to);
+
+int serialize_key_switching_key(void* ksk, DynamicBuffer* out);
+
+void* deserialize_key_switching_key(DynamicBufferView in);
+
+void destroy_key_switching_key(void* ksk);
+
+void* key_switch_fhe_bool(void* ct, void* ksk, void* sks_to);
+
+void* key_switch_fhe_uint4(void* ct, void* ksk, void* sks_to);
+
+void* key_switch_fhe_uint8(void* ct, void* ksk, void* sks_to);
+
+void* key_switch_fhe_uint16(void* ct, void* ksk, void* sks_to);
+
+void* key_switch_fhe_uint32(void* ct, void* ksk, void* sks_to);
+
+void* key_switch_fhe_uint64(void* ct, void* ksk, void* sks_to);
+
+void* key_switch_fhe_uint128(void* ct, void* ksk, void* sks_to);
+
+void* key_switch_fhe_uint160(void* ct, void* ksk, void* sks_to);
+
+void* key_switch_fhe_uint2048(void* ct, void* ksk, void* sks_to);
 
 void destroy_fhe_bool(void* ct);
 
@@ -79,8 +164,12 @@ void destroy_fhe_uint32(void* ct);
 
 void destroy_fhe_uint64(void* ct);
 
+void destroy_fhe_uint128(void* ct);
+
 void destroy_fhe_uint160(void* ct);
 
+void destroy_fhe_uint256(void* ct);
+
 void destroy_fhe_uint2048(void* ct);
 
 void* add_fhe_uint4(void* ct1, void* ct2, void* sks);
@@ -143,6 +232,26 @@ void* scalar_mul_fhe_uint32(void* ct, uint32_t pt, void* sks);
 
 void* scalar_mul_fhe_uint64(void* ct, uint64_t pt, void* sks);
 
+void* div_fhe_uint4(void* ct1, void* ct2, void* sks);
+
+void* div_fhe_uint8(void* ct1, void* ct2, void* sks);
+
+void* div_fhe_uint16(void* ct1, void* ct2, void* sks);
+
+void* div_fhe_uint32(void* ct1, void* ct2, void* sks);
+
+void* div_fhe_uint64(void* ct1, void* ct2, void* sks);
+
+void* rem_fhe_uint4(void* ct1, void* ct2, void* sks);
+
+void* rem_fhe_uint8(void* ct1, void* ct2, void* sks);
+
+void* rem_fhe_uint16(void* ct1, void* ct2, void* sks);
+
+void* rem_fhe_uint32(void* ct1, void* ct2, void* sks);
+
+void* rem_fhe_uint64(void* ct1, void* ct2, void* sks);
+
 void* scalar_div_fhe_uint4(void* ct, uint8_t pt, void* sks);
 
 void* scalar_div_fhe_uint8(void* ct, uint8_t pt, void* sks);
@@ -163,6 +272,12 @@ void* scalar_rem_fhe_uint32(void* ct, uint32_t pt, void* sks);
 
 void* scalar_rem_fhe_uint64(void* ct, uint64_t pt, void* sks);
 
+void* scalar_rem_fhe_uint128(void* ct, struct U128 pt, void* sks);
+
+void* scalar_rem_fhe_uint160(void* ct, struct U256 pt, void* sks);
+
+void* scalar_rem_fhe_uint256(void* ct, struct U256 pt, void* sks);
+
 void* bitand_fhe_bool(void* ct1, void* ct2, void* sks);
 
 void* bitand_fhe_uint4(void* ct1, void* ct2, void* sks);
@@ -511,6 +626,8 @@ int decrypt_fhe_uint32(void* cks, void* ct, uint32_t* res);
 
 int decrypt_fhe_uint64(void* cks, void* ct, uint64_t* res);
 
+int decrypt_fhe_uint128(void* cks, void* ct, struct U128* res);
+
 int decrypt_fhe_uint160(void* cks, void* ct, struct U256* res);
 
 int decrypt_fhe_uint2048(void* cks, void* ct, struct U2048* res);
@@ -527,6 +644,8 @@ void* public_key_encrypt_fhe_uint32(void* pks, uint32_t value);
 
 void* public_key_encrypt_fhe_uint64(void* pks, uint64_t value);
 
+void* public_key_encrypt_fhe_uint128(void* pks, struct U128 value);
+
 void* public_key_encrypt_fhe_uint160(void* pks, struct U256 *value);
 
 void* public_key_encrypt_fhe_uint2048(void* pks, struct U2048 *value);
@@ -543,6 +662,8 @@ void* trivial_encrypt_fhe_uint32(void* sks, uint32_t value);
 
 void* trivial_encrypt_fhe_uint64(void* sks, uint64_t value);
 
+void* trivial_encrypt_fhe_uint128(void* sks, struct U128 value);
+
 void* trivial_encrypt_fhe_uint160(void* sks, struct U256* value);
 
 void* trivial_encrypt_fhe_uint2048(void* sks, struct U2048* value);
@@ -623,6 +744,16 @@ void* cast_64_16(void* ct, void* sks);
 
 void* cast_64_32(void* ct, void* sks);
 
+void* cast_128_4(void* ct, void* sks);
+
+void* cast_128_8(void* ct, void* sks);
+
+void* cast_128_16(void* ct, void* sks);
+
+void* cast_128_32(void* ct, void* sks);
+
+void* cast_128_64(void* ct, void* sks);
+
 void* cast_160_4(void* ct, void* sks);
 
 void* cast_160_8(void* ct, void* sks);
@@ -632,3 +763,39 @@ void* cast_160_16(void* ct, void* sks);
 void* cast_160_32(void* ct, void* sks);
 
 void* cast_160_64(void* ct, void* sks);
+
+void* cast_160_128(void* ct, void* sks);
+
+void* cast_256_160(void* ct, void* sks);
+
+void* generate_random_fhe_bool(void* sks, uint64_t seed_low, uint64_t seed_high);
+
+void* generate_random_fhe_uint4(void* sks, uint64_t seed_low, uint64_t seed_high);
+
+void* generate_random_fhe_uint8(void* sks, uint64_t seed_low, uint64_t seed_high);
+
+void* generate_random_fhe_uint16(void* sks, uint64_t seed_low, uint64_t seed_high);
+
+void* generate_random_fhe_uint32(void* sks, uint64_t seed_low, uint64_t seed_high);
+
+void* generate_random_fhe_uint64(void* sks, uint64_t seed_low, uint64_t seed_high);
+
+void* generate_random_fhe_uint128(void* sks, uint64_t seed_low, uint64_t seed_high);
+
+void* generate_random_fhe_uint160(void* sks, uint64_t seed_low, uint64_t seed_high);
+
+void* generate_random_fhe_uint256(void* sks, uint64_t seed_low, uint64_t seed_high);
+
+void* generate_bounded_random_fhe_uint4(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits);
+
+void* generate_bounded_random_fhe_uint8(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits);
+
+void* generate_bounded_random_fhe_uint16(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits);
+
+void* generate_bounded_random_fhe_uint32(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits);
+
+void* generate_bounded_random_fhe_uint64(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits);
+
+void* generate_bounded_random_fhe_uint128(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits);
+
+void* generate_bounded_random_fhe_uint160(void* sks, uint64_t seed_low, uint64_t seed_high, uint64_t random_bits);